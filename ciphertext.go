@@ -1,9 +1,43 @@
 package lattigo_key
 
 import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math/bits"
 	"sync"
 
 	"github.com/tuneinsight/lattigo/v5/core/rlwe"
+	"github.com/tuneinsight/lattigo/v5/ring"
+	"github.com/tuneinsight/lattigo/v5/utils"
+	"github.com/tuneinsight/lattigo/v5/utils/buffer"
+)
+
+// ciphertextMagic and ciphertextVersion start the serialized form of a Ciphertext.
+// Version 2 precedes each ciphertext with a byte telling whether it is seeded, see
+// ciphertextSeed, and is only written for ciphertexts that have seeds. Version 3 is
+// version 2 with a flag of complex samples next to the packed flag, and is only
+// written for complex ciphertexts, which earlier readers would decrypt as real.
+const (
+	ciphertextMagic          = "HECT"
+	ciphertextVersion        = 1
+	seededCiphertextVersion  = 2
+	complexCiphertextVersion = 3
+)
+
+// maxModuli, maxRingDegree and maxCiphertextDegree bound the shape of the ciphertexts read
+// from a stream, which is otherwise given by lengths read from the stream itself.
+const (
+	maxModuli           = 128
+	maxRingDegree       = 1 << 17
+	maxCiphertextDegree = 7
+)
+
+// The flags of the byte of the serialized form that held the packed flag of version 1.
+const (
+	packedFlag  uint8 = 1 << 0
+	complexFlag uint8 = 1 << 1
 )
 
 type Ciphertext struct {
@@ -12,16 +46,115 @@ type Ciphertext struct {
 	interval int
 	constVal float64
 	space	 int
+	packed 	 bool	// Whether samples are packed side by side, each in a block of space slots
+	complex  bool	// Whether samples are complex, see NewComplexPlaintext
+	numSamples int	// The number of samples held across data
+	fingerprint Fingerprint	// The fingerprint of the Context that encrypted the data
+	seeds 	[]*ciphertextSeed	// The seeds of the symmetric encryptions of data, nil for the others
 }
 
 func (c *Ciphertext) GetData() []*rlwe.Ciphertext {
 	return c.data
 }
 
+// Size returns the number of values of each sample.
+func (c *Ciphertext) Size() int {
+	return c.size
+}
+
 func (c *Ciphertext) GetConst() float64 {
 	return c.constVal
 }
 
+func (c *Ciphertext) IsPacked() bool {
+	return c.packed
+}
+
+// IsComplex returns true if the samples are complex, whose imaginary parts Decrypt keeps.
+func (c *Ciphertext) IsComplex() bool {
+	return c.complex
+}
+
+// Slots returns the number of slots of the ciphertexts, N/2 under Standard parameters
+// and N under ConjugateInvariant ones, or 0 if there are none.
+func (c *Ciphertext) Slots() int {
+	if len(c.data) == 0 || c.data[0] == nil {
+		return 0
+	}
+	return c.data[0].Slots()
+}
+
+func (c *Ciphertext) NumSamples() int {
+	return c.numSamples
+}
+
+func (c *Ciphertext) Fingerprint() Fingerprint {
+	return c.fingerprint
+}
+
+// CheckCiphertext returns an ErrFingerprintMismatch if ctxt was not made under the
+// parameters of ctx, and an error if one of its ciphertexts does not have the shape
+// the evaluators of ctx take: a degree one ciphertext in the NTT domain, of the ring
+// degree of the parameters, at most at their maximum level and of at most their
+// dimensions. A ciphertext of untrusted input must be checked before it is evaluated,
+// as lattigo panics on such a ciphertext, also on goroutines a caller cannot recover.
+func (ctx *Context) CheckCiphertext(ctxt *Ciphertext) error {
+	if err := ctx.checkFingerprint("ciphertext", ctxt.fingerprint); err != nil {
+		return err
+	}
+	if len(ctxt.data) == 0 {
+		return fmt.Errorf("ciphertext holds no data")
+	}
+
+	maxDims := ctx.params.LogMaxDimensions()
+	for i, ct := range ctxt.data {
+		switch {
+		case ct == nil || ct.MetaData == nil:
+			return fmt.Errorf("ciphertext %d is missing", i)
+		case ct.Degree() != 1:
+			return fmt.Errorf("ciphertext %d is of degree %d, expected 1", i, ct.Degree())
+		case !ct.IsNTT:
+			return fmt.Errorf("ciphertext %d is not in the NTT domain", i)
+		case ct.Value[0].N() != ctx.params.N() || ct.Value[1].N() != ctx.params.N():
+			return fmt.Errorf("ciphertext %d is of ring degree %d, parameters use %d", i, ct.Value[0].N(), ctx.params.N())
+		case ct.Value[1].Level() != ct.Level() || ct.Level() > ctx.params.MaxLevel():
+			return fmt.Errorf("ciphertext %d is at level %d, parameters have %d", i, utils.Max(ct.Level(), ct.Value[1].Level()), ctx.params.MaxLevel())
+		case ct.LogDimensions.Rows > maxDims.Rows || ct.LogDimensions.Cols > maxDims.Cols:
+			return fmt.Errorf("ciphertext %d is of log dimensions %dx%d, parameters have %dx%d",
+				i, ct.LogDimensions.Rows, ct.LogDimensions.Cols, maxDims.Rows, maxDims.Cols)
+		}
+	}
+	return nil
+}
+
+// IsSeeded returns true if the ciphertext holds symmetric encryptions that are serialized
+// with the seed of their uniform component, see EncryptOptions.
+func (c *Ciphertext) IsSeeded() bool {
+	for _, s := range c.seeds {
+		if s != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// currentSeeds returns the seeds of the ciphertexts that still match them, nil for the
+// others, or nil if none does. The ciphertexts evaluated in place through GetData since
+// they were encrypted no longer match their seeds.
+func (c *Ciphertext) currentSeeds() (seeds []*ciphertextSeed) {
+	rings := map[string]*ring.Ring{}
+	for i, s := range c.seeds {
+		if s == nil || i >= len(c.data) || c.data[i] == nil || !s.matches(c.data[i], rings) {
+			continue
+		}
+		if seeds == nil {
+			seeds = make([]*ciphertextSeed, len(c.data))
+		}
+		seeds[i] = s
+	}
+	return
+}
+
 func (c *Ciphertext) CopyNew() *Ciphertext {
 	newData := make([]*rlwe.Ciphertext, len(c.data))
 	
@@ -43,5 +176,437 @@ func (c *Ciphertext) CopyNew() *Ciphertext {
 		interval: 	c.interval,
 		constVal: 	c.constVal,
 		space: 	  	c.space,
+		packed: 	c.packed,
+		complex: 	c.complex,
+		numSamples: c.numSamples,
+		fingerprint: c.fingerprint,
+		seeds: 		append([]*ciphertextSeed(nil), c.seeds...),
+	}
+}
+
+// BinarySize returns the serialized size of the ciphertext in bytes.
+func (c *Ciphertext) BinarySize() (size int) {
+	return c.binarySize(c.currentSeeds())
+}
+
+// version returns the version the ciphertext is written in with seeds.
+func (c *Ciphertext) version(seeds []*ciphertextSeed) uint8 {
+	switch {
+	case c.complex:
+		return complexCiphertextVersion
+	case seeds != nil:
+		return seededCiphertextVersion
+	default:
+		return ciphertextVersion
+	}
+}
+
+// binarySize returns the size of the ciphertext once written with seeds.
+func (c *Ciphertext) binarySize(seeds []*ciphertextSeed) (size int) {
+	// magic, version, fingerprint, size, interval, constVal, space, flags, numSamples, len(data)
+	size = len(ciphertextMagic) + 1 + len(c.fingerprint) + 8*4 + 1 + 8*2
+	forms := c.version(seeds) != ciphertextVersion
+	for i, ct := range c.data {
+		switch {
+		case !forms:
+			size += ct.BinarySize()
+		case seeds != nil && seeds[i] != nil:
+			size += 1 + seeds[i].seededBinarySize(ct)
+		default:
+			size += 1 + ct.BinarySize()
+		}
+	}
+	return
+}
+
+// WriteTo writes the ciphertext, preceded by a header holding its layout and
+// parameter fingerprint, to w. The symmetric encryptions of EncryptOptions are
+// written with the seed of their uniform component, which halves their size, unless
+// they were modified in place since. It implements the io.WriterTo interface.
+func (c *Ciphertext) WriteTo(w io.Writer) (n int64, err error) {
+	switch w := w.(type) {
+	case buffer.Writer:
+		return c.writeTo(w, c.currentSeeds())
+	default:
+		return c.WriteTo(bufio.NewWriter(w))
+	}
+}
+
+// writeTo writes the ciphertext to w, in seeded form for the ciphertexts that have seeds.
+func (c *Ciphertext) writeTo(w buffer.Writer, seeds []*ciphertextSeed) (n int64, err error) {
+	var inc int64
+
+	if inc, err = buffer.Write(w, []byte(ciphertextMagic)); err != nil {
+		return n + inc, err
+	}
+	n += inc
+
+	version := c.version(seeds)
+	if inc, err = buffer.WriteUint8(w, version); err != nil {
+		return n + inc, err
+	}
+	n += inc
+
+	if inc, err = buffer.Write(w, c.fingerprint[:]); err != nil {
+		return n + inc, err
+	}
+	n += inc
+
+	for _, v := range []int{c.size, c.interval} {
+		if inc, err = buffer.WriteAsUint64(w, v); err != nil {
+			return n + inc, err
+		}
+		n += inc
+	}
+
+	if inc, err = buffer.WriteAsUint64(w, c.constVal); err != nil {
+		return n + inc, err
+	}
+	n += inc
+
+	if inc, err = buffer.WriteAsUint64(w, c.space); err != nil {
+		return n + inc, err
+	}
+	n += inc
+
+	var flags uint8
+	if c.packed {
+		flags |= packedFlag
+	}
+	if c.complex {
+		flags |= complexFlag
+	}
+	if inc, err = buffer.WriteUint8(w, flags); err != nil {
+		return n + inc, err
+	}
+	n += inc
+
+	for _, v := range []int{c.numSamples, len(c.data)} {
+		if inc, err = buffer.WriteAsUint64(w, v); err != nil {
+			return n + inc, err
+		}
+		n += inc
+	}
+
+	for i, ct := range c.data {
+		if ct == nil {
+			return n, fmt.Errorf("cannot WriteTo: ciphertext %d is nil", i)
+		}
+		if version == ciphertextVersion {
+			if inc, err = ct.WriteTo(w); err != nil {
+				return n + inc, err
+			}
+			n += inc
+			continue
+		}
+
+		var s *ciphertextSeed
+		if seeds != nil {
+			s = seeds[i]
+		}
+		var form uint8
+		if s != nil {
+			form = 1
+		}
+		if inc, err = buffer.WriteUint8(w, form); err != nil {
+			return n + inc, err
+		}
+		n += inc
+		if s != nil {
+			inc, err = s.writeSeeded(w, ct)
+		} else {
+			inc, err = ct.WriteTo(w)
+		}
+		if err != nil {
+			return n + inc, err
+		}
+		n += inc
 	}
+
+	return n, w.Flush()
+}
+
+// ReadFrom reads a ciphertext written by WriteTo from r, expanding the uniform components
+// of seeded ciphertexts from their seeds. It implements the io.ReaderFrom interface.
+func (c *Ciphertext) ReadFrom(r io.Reader) (n int64, err error) {
+	switch r := r.(type) {
+	case buffer.Reader:
+		var inc int64
+
+		magic := make([]byte, len(ciphertextMagic))
+		if inc, err = buffer.Read(r, magic); err != nil {
+			return n + inc, err
+		}
+		n += inc
+		if string(magic) != ciphertextMagic {
+			return n, fmt.Errorf("cannot ReadFrom: not a serialized Ciphertext")
+		}
+
+		var version uint8
+		if inc, err = buffer.ReadUint8(r, &version); err != nil {
+			return n + inc, err
+		}
+		n += inc
+		if version < ciphertextVersion || version > complexCiphertextVersion {
+			return n, fmt.Errorf("cannot ReadFrom: unsupported Ciphertext version %d", version)
+		}
+
+		if inc, err = buffer.Read(r, c.fingerprint[:]); err != nil {
+			return n + inc, err
+		}
+		n += inc
+		if c.fingerprint == (Fingerprint{}) {
+			return n, fmt.Errorf("cannot ReadFrom: %w: Ciphertext header has no fingerprint", ErrFingerprintMismatch)
+		}
+
+		for _, v := range []*int{&c.size, &c.interval} {
+			if inc, err = buffer.ReadAsUint64(r, v); err != nil {
+				return n + inc, err
+			}
+			n += inc
+		}
+
+		if inc, err = buffer.ReadAsUint64(r, &c.constVal); err != nil {
+			return n + inc, err
+		}
+		n += inc
+
+		if inc, err = buffer.ReadAsUint64(r, &c.space); err != nil {
+			return n + inc, err
+		}
+		n += inc
+
+		var flags uint8
+		if inc, err = buffer.ReadUint8(r, &flags); err != nil {
+			return n + inc, err
+		}
+		n += inc
+		if version < complexCiphertextVersion && flags&^packedFlag != 0 || flags&^(packedFlag|complexFlag) != 0 {
+			return n, fmt.Errorf("cannot ReadFrom: invalid flags %#x of Ciphertext version %d", flags, version)
+		}
+		c.packed = flags&packedFlag != 0
+		c.complex = flags&complexFlag != 0
+
+		var numCtxt int
+		for _, v := range []*int{&c.numSamples, &numCtxt} {
+			if inc, err = buffer.ReadAsUint64(r, v); err != nil {
+				return n + inc, err
+			}
+			n += inc
+		}
+		if numCtxt < 1 || c.numSamples < 1 || c.interval < 1 || c.space < 1 || c.size < 1 {
+			return n, fmt.Errorf("cannot ReadFrom: invalid layout of %d samples of %d values in %d ciphertexts, space %d and interval %d",
+				c.numSamples, c.size, numCtxt, c.space, c.interval)
+		}
+
+		// The ciphertexts are appended as they are read, so that the memory follows the input
+		c.data = make([]*rlwe.Ciphertext, 0, utils.Min(numCtxt, 1024))
+		c.seeds = nil
+		rings := map[string]*ring.Ring{}
+		for i := 0; i < numCtxt; i++ {
+			var form uint8
+			if version != ciphertextVersion {
+				if inc, err = buffer.ReadUint8(r, &form); err != nil {
+					return n + inc, err
+				}
+				n += inc
+			}
+
+			var ct *rlwe.Ciphertext
+			var seed *ciphertextSeed
+			switch form {
+			case 0:
+				ct, inc, err = readRLWECiphertext(r)
+			case 1:
+				ct, seed, inc, err = readSeeded(r, rings)
+			default:
+				return n, fmt.Errorf("cannot ReadFrom: invalid form %d of ciphertext %d", form, i)
+			}
+			if err != nil {
+				return n + inc, err
+			}
+			n += inc
+			if seed != nil && c.seeds == nil {
+				c.seeds = make([]*ciphertextSeed, i, cap(c.data))
+			}
+			if c.seeds != nil {
+				c.seeds = append(c.seeds, seed)
+			}
+			c.data = append(c.data, ct)
+		}
+
+		if slots := c.Slots(); c.space > slots || c.interval > slots || c.space*c.interval > slots || c.size > slots || c.numSamples > numCtxt*slots {
+			return n, fmt.Errorf("cannot ReadFrom: %d samples of %d values in space %d at interval %d do not fit in %d ciphertexts of %d slots",
+				c.numSamples, c.size, c.space, c.interval, numCtxt, slots)
+		}
+		return n, nil
+
+	default:
+		return c.ReadFrom(bufio.NewReader(r))
+	}
+}
+
+// readRLWECiphertext reads an rlwe.Ciphertext written by its WriteTo from r. Unlike its
+// ReadFrom, it checks the lengths read from r against maxCiphertextDegree, maxModuli and
+// maxRingDegree before allocating, so that a corrupted or hostile stream returns an error
+// instead of exhausting the memory.
+func readRLWECiphertext(r buffer.Reader) (ct *rlwe.Ciphertext, n int64, err error) {
+	var inc int64
+	ct = &rlwe.Ciphertext{}
+
+	var hasMetaData uint8
+	if inc, err = buffer.ReadUint8(r, &hasMetaData); err != nil {
+		return nil, n + inc, err
+	}
+	n += inc
+	if hasMetaData != 1 {
+		return nil, n, fmt.Errorf("invalid ciphertext without metadata")
+	}
+	ct.MetaData = &rlwe.MetaData{}
+	if inc, err = ct.MetaData.ReadFrom(r); err != nil {
+		return nil, n + inc, err
+	}
+	n += inc
+
+	var degree, moduli, N int
+	if inc, err = buffer.ReadAsUint64(r, &degree); err != nil {
+		return nil, n + inc, err
+	}
+	n += inc
+	if degree < 1 || degree > maxCiphertextDegree+1 {
+		return nil, n, fmt.Errorf("invalid ciphertext of %d polynomials", degree)
+	}
+
+	ct.Value = make([]ring.Poly, degree)
+	for i := range ct.Value {
+		var rows int
+		if inc, err = buffer.ReadAsUint64(r, &rows); err != nil {
+			return nil, n + inc, err
+		}
+		n += inc
+		if rows < 1 || rows > maxModuli || i > 0 && rows != moduli {
+			return nil, n, fmt.Errorf("invalid ciphertext polynomial of %d moduli", rows)
+		}
+		moduli = rows
+
+		ct.Value[i].Coeffs = make([][]uint64, rows)
+		for j := range ct.Value[i].Coeffs {
+			var cols int
+			if inc, err = buffer.ReadAsUint64(r, &cols); err != nil {
+				return nil, n + inc, err
+			}
+			n += inc
+			if cols < 1 || cols > maxRingDegree || cols&(cols-1) != 0 || N != 0 && cols != N {
+				return nil, n, fmt.Errorf("invalid ciphertext polynomial of degree %d", cols)
+			}
+			if N == 0 {
+				if dims := ct.LogDimensions; dims.Rows < 0 || dims.Cols < 0 || dims.Rows+dims.Cols > bits.Len(uint(cols))-1 {
+					return nil, n, fmt.Errorf("invalid ciphertext of log dimensions %dx%d in degree %d", dims.Rows, dims.Cols, cols)
+				}
+			}
+			N = cols
+
+			ct.Value[i].Coeffs[j] = make([]uint64, cols)
+			if inc, err = buffer.ReadUint64Slice(r, ct.Value[i].Coeffs[j]); err != nil {
+				return nil, n + inc, err
+			}
+			n += inc
+		}
+	}
+	return ct, n, nil
+}
+
+// MarshalBinary encodes the ciphertext in the format written by WriteTo.
+func (c *Ciphertext) MarshalBinary() (data []byte, err error) {
+	seeds := c.currentSeeds()
+	buf := buffer.NewBufferSize(c.binarySize(seeds))
+	_, err = c.writeTo(buf, seeds)
+	return buf.Bytes(), err
+}
+
+// DecodeOptions are the options of UnmarshalBinaryWithOptions and
+// ReadCompressedFromWithOptions.
+type DecodeOptions struct {
+	// MaxDecompressedBytes bounds the size of the ciphertext once decompressed,
+	// DefaultMaxDecompressedBytes if it is zero. A compressed ciphertext of untrusted
+	// input can otherwise inflate to far more than the bound on its compressed size.
+	MaxDecompressedBytes int64
+}
+
+func (opts DecodeOptions) maxDecompressedBytes() int64 {
+	if opts.MaxDecompressedBytes == 0 {
+		return DefaultMaxDecompressedBytes
+	}
+	return opts.MaxDecompressedBytes
+}
+
+// UnmarshalBinary decodes a slice of bytes generated by MarshalBinary, WriteTo,
+// MarshalBinaryCompressed or WriteCompressedTo.
+func (c *Ciphertext) UnmarshalBinary(p []byte) (err error) {
+	return c.UnmarshalBinaryWithOptions(p, DecodeOptions{})
+}
+
+// UnmarshalBinaryWithOptions is UnmarshalBinary with the options of opts. A compressed
+// ciphertext is decompressed as it is decoded.
+func (c *Ciphertext) UnmarshalBinaryWithOptions(p []byte, opts DecodeOptions) (err error) {
+	if isCompressed(p) {
+		_, err = c.ReadCompressedFromWithOptions(bytes.NewReader(p), opts)
+		return
+	}
+	if max := opts.maxDecompressedBytes(); int64(len(p)) > max {
+		return fmt.Errorf("%w: %d bytes, more than %d", ErrDecompressedTooLarge, len(p), max)
+	}
+	_, err = c.ReadFrom(buffer.NewBuffer(p))
+	return
+}
+
+// WriteCompressedTo streams the ciphertext in the format written by WriteTo to w,
+// compressed with codec. It returns the number of compressed bytes written.
+func (c *Ciphertext) WriteCompressedTo(w io.Writer, codec Codec) (n int64, err error) {
+	cw := &countingWriter{w: w}
+	zw, err := NewCompressWriter(cw, codec)
+	if err != nil {
+		return cw.n, err
+	}
+	if _, err = c.WriteTo(zw); err != nil {
+		return cw.n, err
+	}
+	err = zw.Close()
+	return cw.n, err
+}
+
+// ReadCompressedFrom reads a ciphertext written by WriteCompressedTo or WriteTo from r,
+// decompressing it as it is read. It returns the size of the decompressed ciphertext.
+func (c *Ciphertext) ReadCompressedFrom(r io.Reader) (n int64, err error) {
+	return c.ReadCompressedFromWithOptions(r, DecodeOptions{})
+}
+
+// ReadCompressedFromWithOptions is ReadCompressedFrom with the options of opts.
+func (c *Ciphertext) ReadCompressedFromWithOptions(r io.Reader, opts DecodeOptions) (n int64, err error) {
+	dr, err := NewDecompressReader(r)
+	if err != nil {
+		return 0, err
+	}
+	defer dr.Close()
+	max := opts.maxDecompressedBytes()
+	return c.ReadFrom(&limitedReader{r: dr, n: max, max: max})
+}
+
+// MarshalBinaryCompressed encodes the ciphertext in the format written by WriteCompressedTo.
+func (c *Ciphertext) MarshalBinaryCompressed(codec Codec) (data []byte, err error) {
+	var buf bytes.Buffer
+	_, err = c.WriteCompressedTo(&buf, codec)
+	return buf.Bytes(), err
+}
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (n int, err error) {
+	n, err = cw.w.Write(p)
+	cw.n += int64(n)
+	return
 }
\ No newline at end of file
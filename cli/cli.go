@@ -0,0 +1,174 @@
+// Package cli implements the hekeys command, which manages the key directories written
+// by SaveKeys, and encrypts, evaluates on and decrypts CSV data, without a Go toolchain:
+//
+//	hekeys presets
+//	hekeys gen (-preset NAME | -params FILE) -out DIR [storage flags] [-seed HEX] [-force]
+//	hekeys inspect DIR
+//	hekeys verify [-galois-samples N] [-skip-bootstrap] DIR
+//	hekeys export-public -out DIR [storage flags] [-force] SRC
+//	hekeys convert -out DIR [storage flags] [-force] SRC
+//	hekeys encrypt -keys DIR -in FILE.csv -out FILE [-header] [-packed] [-codec CODEC]
+//	hekeys decrypt -keys DIR -in FILE -out FILE.csv [-precision N]
+//	hekeys eval -keys DIR -model FILE.json -in FILE -out FILE [-codec CODEC]
+//
+// where the storage flags -seed-compressed, -codec, -mapped and -workers select the
+// SaveOptions the keys are written with, and -params is a JSON or YAML file read by
+// LoadParametersConfig. Flags come before the directory arguments.
+//
+// encrypt reads a CSV file of one sample per row into a Plaintext and writes the
+// encrypted batch as Ciphertext.WriteCompressedTo does, decrypt writes the first
+// Size values of each sample of a batch to a CSV file, and eval runs an MLP model
+// file on a batch as the inference servers do. encrypt and eval only need the
+// evaluation keys written by export-public.
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/JihunSKKU/HE-CCFD/lattigo_key"
+)
+
+// ErrUsage is returned by Run when the command line is invalid.
+var ErrUsage = errors.New("invalid usage")
+
+type command struct {
+	name    string
+	args    string
+	summary string
+}
+
+// commands are the subcommands of Run, in the order of the usage.
+var commands = []command{
+	{"presets", "", "list the parameter presets and their security, precision and depth"},
+	{"gen", "(-preset NAME | -params FILE) -out DIR", "generate the keys of a parameter set"},
+	{"inspect", "DIR", "print the parameters, the key inventory and the sizes of a key directory"},
+	{"verify", "DIR", "check that the keys of a directory load and belong to its secret key"},
+	{"export-public", "-out DIR SRC", "write the keys of SRC without the secret key"},
+	{"convert", "-out DIR SRC", "rewrite the keys of SRC in another storage format"},
+	{"encrypt", "-keys DIR -in FILE.csv -out FILE", "encrypt the rows of a CSV file into a batch"},
+	{"decrypt", "-keys DIR -in FILE -out FILE.csv", "decrypt a batch into the rows of a CSV file"},
+	{"eval", "-keys DIR -model FILE.json -in FILE -out FILE", "run a model file on an encrypted batch"},
+}
+
+// env is the output of a command.
+type env struct {
+	stdout io.Writer
+	stderr io.Writer
+}
+
+func (e *env) printf(format string, a ...interface{}) {
+	fmt.Fprintf(e.stdout, format, a...)
+}
+
+// Run runs the command line args, without the program name, writing its output to
+// stdout and its usage messages to stderr.
+func Run(args []string, stdout, stderr io.Writer) error {
+	e := &env{stdout: stdout, stderr: stderr}
+	if len(args) == 0 {
+		e.usage()
+		return fmt.Errorf("%w: no command", ErrUsage)
+	}
+	if args[0] == "help" || args[0] == "-h" || args[0] == "-help" || args[0] == "--help" {
+		e.usage()
+		return nil
+	}
+	switch args[0] {
+	case "presets":
+		return runPresets(e, args[1:])
+	case "gen":
+		return runGen(e, args[1:])
+	case "inspect":
+		return runInspect(e, args[1:])
+	case "verify":
+		return runVerify(e, args[1:])
+	case "export-public":
+		return runExportPublic(e, args[1:])
+	case "convert":
+		return runConvert(e, args[1:])
+	case "encrypt":
+		return runEncrypt(e, args[1:])
+	case "decrypt":
+		return runDecrypt(e, args[1:])
+	case "eval":
+		return runEval(e, args[1:])
+	}
+	e.usage()
+	return fmt.Errorf("%w: unknown command %q", ErrUsage, args[0])
+}
+
+func (e *env) usage() {
+	fmt.Fprintln(e.stderr, "Usage: hekeys COMMAND [flags] [arguments]")
+	fmt.Fprintln(e.stderr, "\nCommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(e.stderr, "  %-14s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(e.stderr, "\nParameter presets: %s\n", strings.Join(lattigo_key.PresetNames(), ", "))
+	fmt.Fprintln(e.stderr, "Run 'hekeys COMMAND -h' for the flags of a command.")
+}
+
+// flagSet returns the flags of the command named name, which print their usage to stderr.
+func (e *env) flagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	fs.Usage = func() {
+		for _, cmd := range commands {
+			if cmd.name == name {
+				fmt.Fprintf(e.stderr, "Usage: hekeys %s [flags] %s\n\n%s.\n\nFlags:\n", name, cmd.args, strings.ToUpper(cmd.summary[:1])+cmd.summary[1:])
+			}
+		}
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parse parses the flags of fs and returns its nargs positional arguments.
+func parse(fs *flag.FlagSet, args []string, nargs int) ([]string, error) {
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %v", ErrUsage, err)
+	}
+	if fs.NArg() != nargs {
+		fs.Usage()
+		return nil, fmt.Errorf("%w: %s takes %d argument(s), got %d", ErrUsage, fs.Name(), nargs, fs.NArg())
+	}
+	return fs.Args(), nil
+}
+
+// storageFlags registers the flags selecting the SaveOptions of a command, and
+// returns a function building them once the flags are parsed.
+func storageFlags(fs *flag.FlagSet) func() (lattigo_key.SaveOptions, error) {
+	seedCompressed := fs.Bool("seed-compressed", false, "write the keys as their seeds and b components, which roughly halves the directory")
+	codec := fs.String("codec", "none", "compression of the key files: none, gzip or zstd")
+	mapped := fs.Bool("mapped", false, "write the galois and bootstrapping keys to memory-mapped files")
+	workers := fs.Int("workers", 0, "number of key files written at the same time, GOMAXPROCS if 0")
+
+	return func() (opts lattigo_key.SaveOptions, err error) {
+		if opts.Codec, err = lattigo_key.ParseCodec(*codec); err != nil {
+			return opts, fmt.Errorf("%w: %v", ErrUsage, err)
+		}
+		opts.SeedCompressed = *seedCompressed
+		opts.MemoryMapped = *mapped
+		opts.Workers = *workers
+		return opts, nil
+	}
+}
+
+// formatBytes returns size in B, KB, MB or GB.
+func formatBytes(size int64) string {
+	switch {
+	case size >= 1<<30:
+		return fmt.Sprintf("%.2f GB", float64(size)/(1<<30))
+	case size >= 1<<20:
+		return fmt.Sprintf("%.2f MB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.2f KB", float64(size)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", size)
+	}
+}
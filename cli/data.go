@@ -0,0 +1,275 @@
+package cli
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/JihunSKKU/HE-CCFD/lattigo_key"
+	"github.com/JihunSKKU/HE-CCFD/lattigo_key/server"
+)
+
+func runEncrypt(e *env, args []string) error {
+	fs := e.flagSet("encrypt")
+	keys := fs.String("keys", "", "key directory, which may hold the evaluation keys only")
+	in := fs.String("in", "", "CSV file of the samples, one row of features per sample")
+	out := fs.String("out", "", "file the encrypted batch is written to")
+	header := fs.Bool("header", false, "skip the first row of the CSV file, which holds the column names")
+	packed := fs.Bool("packed", false, "pack several samples side by side in each ciphertext")
+	symmetric := fs.Bool("symmetric", false, "encrypt under the secret key of -keys, which halves the size of the batch")
+	level := fs.Int("level", -1, "level of the ciphertexts, lower for smaller ciphertexts and shallow models, or the maximum level if negative")
+	codec := fs.String("codec", "none", "compression of the batch: none, gzip or zstd")
+	if _, err := parse(fs, args, 0); err != nil {
+		return err
+	}
+	if *keys == "" || *in == "" || *out == "" {
+		return fmt.Errorf("%w: encrypt takes -keys, -in and -out", ErrUsage)
+	}
+	c, err := lattigo_key.ParseCodec(*codec)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUsage, err)
+	}
+
+	rows, err := readCSV(*in, *header)
+	if err != nil {
+		return err
+	}
+	// Encrypt panics on samples larger than the slots, which is checked before loading the keys
+	params, _, err := lattigo_key.LoadParameters(*keys)
+	if err != nil {
+		return err
+	}
+	if len(rows[0]) > params.MaxSlots() {
+		return fmt.Errorf("%s: samples of %d features do not fit in the %d slots of the parameters", *in, len(rows[0]), params.MaxSlots())
+	}
+	opts := lattigo_key.EncryptOptions{Symmetric: *symmetric}
+	if *level >= 0 {
+		if *level > params.MaxLevel() {
+			return fmt.Errorf("%w: -level %d is above the maximum level %d of the parameters", ErrUsage, *level, params.MaxLevel())
+		}
+		opts.Level = level
+	}
+
+	if _, err := os.Stat(filepath.Join(*keys, "sk.key")); *symmetric && os.IsNotExist(err) {
+		return fmt.Errorf("%s has no secret key and cannot encrypt with -symmetric", *keys)
+	}
+
+	ctx, err := lattigo_key.LoadKeys(*keys)
+	if err != nil {
+		return fmt.Errorf("%s: %w", *keys, err)
+	}
+	defer ctx.Close()
+
+	ptxt := lattigo_key.NewPlaintext(rows)
+	if *packed {
+		ptxt = lattigo_key.NewPackedPlaintext(rows)
+	}
+	ctxt := ctx.EncryptWithOptions(ptxt, opts)
+	size, err := writeCiphertext(*out, ctxt, c)
+	if err != nil {
+		return err
+	}
+	e.printf("Encrypted %d samples of %d features into %d ciphertexts: %s, %s\n", len(rows), len(rows[0]), len(ctxt.GetData()), *out, formatBytes(size))
+	return nil
+}
+
+func runDecrypt(e *env, args []string) error {
+	fs := e.flagSet("decrypt")
+	keys := fs.String("keys", "", "key directory holding the secret key")
+	in := fs.String("in", "", "encrypted batch")
+	out := fs.String("out", "", "CSV file the samples are written to")
+	precision := fs.Int("precision", 6, "number of digits after the decimal point")
+	if _, err := parse(fs, args, 0); err != nil {
+		return err
+	}
+	if *keys == "" || *in == "" || *out == "" {
+		return fmt.Errorf("%w: decrypt takes -keys, -in and -out", ErrUsage)
+	}
+
+	if _, err := os.Stat(filepath.Join(*keys, "sk.key")); os.IsNotExist(err) {
+		return fmt.Errorf("%s has no secret key and cannot decrypt", *keys)
+	}
+
+	ctx, err := lattigo_key.LoadKeys(*keys)
+	if err != nil {
+		return fmt.Errorf("%s: %w", *keys, err)
+	}
+	defer ctx.Close()
+
+	ctxt, err := readCiphertext(*in, ctx)
+	if err != nil {
+		return err
+	}
+
+	// Every sample is decrypted to all the slots of its block, of which the first Size hold its values.
+	// A complex sample is written as its real parts followed by its imaginary parts.
+	ptxt := ctx.Decrypt(ctxt)
+	rows, imag := ptxt.GetData(), ptxt.GetImagData()
+	for i, row := range rows {
+		if len(row) > ctxt.Size() {
+			rows[i] = row[:ctxt.Size()]
+		}
+		if imag != nil {
+			rows[i] = append(rows[i][:len(rows[i]):len(rows[i])], imag[i][:len(rows[i])]...)
+		}
+	}
+	if err := writeCSV(*out, rows, *precision); err != nil {
+		return err
+	}
+	e.printf("Decrypted %d samples of %d values to %s\n", len(rows), ctxt.Size(), *out)
+	return nil
+}
+
+func runEval(e *env, args []string) error {
+	fs := e.flagSet("eval")
+	keys := fs.String("keys", "", "key directory, which may hold the evaluation keys only")
+	modelPath := fs.String("model", "", "JSON model file, in the format of LoadMLP")
+	in := fs.String("in", "", "encrypted batch")
+	out := fs.String("out", "", "file the encrypted outputs are written to")
+	codec := fs.String("codec", "none", "compression of the outputs: none, gzip or zstd")
+	if _, err := parse(fs, args, 0); err != nil {
+		return err
+	}
+	if *keys == "" || *modelPath == "" || *in == "" || *out == "" {
+		return fmt.Errorf("%w: eval takes -keys, -model, -in and -out", ErrUsage)
+	}
+	c, err := lattigo_key.ParseCodec(*codec)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUsage, err)
+	}
+
+	model, err := lattigo_key.LoadMLP(*modelPath)
+	if err != nil {
+		return err
+	}
+	ctx, err := lattigo_key.LoadKeys(*keys)
+	if err != nil {
+		return fmt.Errorf("%s: %w", *keys, err)
+	}
+	defer ctx.Close()
+
+	ctxt, err := readCiphertext(*in, ctx)
+	if err != nil {
+		return err
+	}
+	// The model runs as the inference servers run it
+	result, err := server.MLPModel(model).Evaluate(ctx, ctxt)
+	if err != nil {
+		return fmt.Errorf("model %s: %w", *modelPath, err)
+	}
+	size, err := writeCiphertext(*out, result, c)
+	if err != nil {
+		return err
+	}
+	e.printf("Evaluated %s on %d samples: %d outputs per sample, %s, %s\n", *modelPath, result.NumSamples(), result.Size(), *out, formatBytes(size))
+	return nil
+}
+
+// readCSV reads the rows of the CSV file at path, which must all have the same
+// number of values, skipping the first one if header is true.
+func readCSV(path string, header bool) ([][]float64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	r := csv.NewReader(bufio.NewReader(file))
+	r.TrimLeadingSpace = true
+	if header {
+		if _, err := r.Read(); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	var rows [][]float64
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// The csv package checks that the rows have the same number of fields
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		row := make([]float64, len(record))
+		for j, field := range record {
+			if row[j], err = strconv.ParseFloat(field, 64); err != nil {
+				line, _ := r.FieldPos(j)
+				return nil, fmt.Errorf("%s:%d: column %d is not a number: %q", path, line, j+1, field)
+			}
+		}
+		rows = append(rows, row)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("%s holds no samples", path)
+	}
+	return rows, nil
+}
+
+// writeCSV writes rows to the CSV file at path with precision digits after the decimal point.
+func writeCSV(path string, rows [][]float64, precision int) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := csv.NewWriter(file)
+	for _, row := range rows {
+		record := make([]string, len(row))
+		for j, v := range row {
+			record[j] = strconv.FormatFloat(v, 'f', precision, 64)
+		}
+		if err := w.Write(record); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// writeCiphertext writes ctxt to the file at path compressed with codec, and returns its size.
+func writeCiphertext(path string, ctxt *lattigo_key.Ciphertext, codec lattigo_key.Codec) (int64, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	n, err := ctxt.WriteCompressedTo(w, codec)
+	if err != nil {
+		return 0, err
+	}
+	if err := w.Flush(); err != nil {
+		return 0, err
+	}
+	return n, file.Close()
+}
+
+// readCiphertext reads the batch of the file at path, compressed or not, and checks
+// that it was encrypted under the parameters of ctx.
+func readCiphertext(path string, ctx *lattigo_key.Context) (*lattigo_key.Ciphertext, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	ctxt := new(lattigo_key.Ciphertext)
+	if _, err := ctxt.ReadCompressedFrom(bufio.NewReader(file)); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if fp := ctxt.Fingerprint(); fp != ctx.Fingerprint() {
+		return nil, fmt.Errorf("%w: %s was encrypted under parameters %s, keys use %s", lattigo_key.ErrFingerprintMismatch, path, fp, ctx.Fingerprint())
+	}
+	return ctxt, nil
+}
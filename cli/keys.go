@@ -0,0 +1,372 @@
+package cli
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/JihunSKKU/HE-CCFD/lattigo_key"
+	"github.com/tuneinsight/lattigo/v5/ring"
+)
+
+func runGen(e *env, args []string) error {
+	fs := e.flagSet("gen")
+	preset := fs.String("preset", "", "name of the parameter preset")
+	paramsPath := fs.String("params", "", "JSON or YAML parameter file")
+	out := fs.String("out", "", "directory the keys are written to")
+	seed := fs.String("seed", "", "hex seed every key is derived from, for reproducible test keys only: the seed is the secret key")
+	force := fs.Bool("force", false, "replace the directory -out if it exists")
+	securityFloor := fs.Int("security-floor", lattigo_key.DefaultSecurityFloor, "estimated security level, in bits, below which parameters are refused")
+	insecure := fs.Bool("insecure", false, "generate keys of parameters below the security floor, for tests only")
+	saveOptions := storageFlags(fs)
+	if _, err := parse(fs, args, 0); err != nil {
+		return err
+	}
+	opts, err := saveOptions()
+	if err != nil {
+		return err
+	}
+	if (*preset == "") == (*paramsPath == "") {
+		return fmt.Errorf("%w: gen takes one of -preset and -params", ErrUsage)
+	}
+	if err := checkOutput(*out, *force, ""); err != nil {
+		return err
+	}
+
+	var config *lattigo_key.ParametersConfig
+	if *preset != "" {
+		config, err = lattigo_key.Preset(*preset)
+	} else {
+		config, err = lattigo_key.LoadParametersConfig(*paramsPath)
+	}
+	if err != nil {
+		return err
+	}
+	params, btparams, err := config.NewParameters()
+	if err != nil {
+		return err
+	}
+	if *securityFloor <= 0 {
+		return fmt.Errorf("%w: -security-floor must be positive, -insecure disables the check", ErrUsage)
+	}
+	if !*insecure {
+		if err := lattigo_key.CheckSecurityFloor(params, btparams, *securityFloor); err != nil {
+			return fmt.Errorf("%w (-insecure generates them anyway)", err)
+		}
+	}
+
+	ctxOptions := lattigo_key.ContextOptions{SecurityFloor: *securityFloor, Insecure: *insecure}
+	if *seed != "" {
+		if ctxOptions.Seed, err = hex.DecodeString(*seed); err != nil || len(ctxOptions.Seed) == 0 {
+			return fmt.Errorf("%w: -seed is not a hex string", ErrUsage)
+		}
+	}
+	ctx := lattigo_key.NewContextWithOptions(params, btparams, ctxOptions)
+	defer ctx.Close()
+
+	if err := save(ctx, *out, opts); err != nil {
+		return err
+	}
+	e.printf("Generated the keys of parameters %s\n\n", ctx.Fingerprint())
+	return inspect(e, *out)
+}
+
+func runPresets(e *env, args []string) error {
+	fs := e.flagSet("presets")
+	if _, err := parse(fs, args, 0); err != nil {
+		return err
+	}
+
+	e.printf("%-16s %-9s %-10s %-6s %s\n", "NAME", "SECURITY", "PRECISION", "DEPTH", "DESCRIPTION")
+	for _, preset := range lattigo_key.Presets() {
+		security := "none"
+		if preset.SecurityBits > 0 {
+			security = fmt.Sprintf("%d bits", preset.SecurityBits)
+		}
+		e.printf("%-16s %-9s %-10s %-6d %s\n", preset.Name, security, fmt.Sprintf("%.0f bits", preset.Precision), preset.Depth, preset.Description)
+		if err := preset.Check(); err != nil {
+			e.printf("%-16s %v\n", "", err)
+		}
+	}
+	return nil
+}
+
+func runInspect(e *env, args []string) error {
+	fs := e.flagSet("inspect")
+	dirs, err := parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	return inspect(e, dirs[0])
+}
+
+// inspect prints the parameters of the keys in dirPath and, from the headers of
+// the key files, their format and size.
+func inspect(e *env, dirPath string) error {
+	params, btparams, err := lattigo_key.LoadParameters(dirPath)
+	if err != nil {
+		return err
+	}
+	fp, err := lattigo_key.NewFingerprint(params, btparams)
+	if err != nil {
+		return err
+	}
+
+	btpParams := btparams.BootstrappingParameters
+	e.printf("Directory      %s\n", dirPath)
+	e.printf("Fingerprint    %s\n", fp)
+	e.printf("Parameters     LogN %d, LogSlots %d, LogQP %.1f, %d levels, LogDefaultScale %d, %s ring, Xs %s, Xe %s\n",
+		params.LogN(), params.LogMaxSlots(), params.LogQP(), params.MaxLevel()+1, params.LogDefaultScale(), params.RingType(),
+		distribution(params.Xs()), distribution(params.Xe()))
+	e.printf("Bootstrapping  LogN %d, LogSlots %d, LogQP %.1f, depth %d, Xs %s\n",
+		btpParams.LogN(), btparams.LogMaxSlots(), btpParams.LogQP(), btparams.Depth(), distribution(btpParams.Xs()))
+	if bits, err := lattigo_key.ParametersSecurity(params, btparams); err != nil {
+		e.printf("Security       unknown, %v\n", err)
+	} else {
+		e.printf("Security       estimated %.0f bits\n", bits)
+	}
+
+	// The galois key files are listed as a whole
+	type entry struct {
+		name    string
+		files   int
+		size    int64
+		formats []string
+	}
+	var entries []*entry
+	galks := &entry{name: "galks/"}
+	var total int64
+	hasSecretKey := false
+
+	err = filepath.WalkDir(dirPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dirPath, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		hasSecretKey = hasSecretKey || rel == "sk.key"
+
+		format := "memory-mapped"
+		if !strings.HasSuffix(rel, ".mkeys") {
+			if format, err = fileFormat(path, fp); err != nil {
+				return err
+			}
+		}
+
+		ent := galks
+		if !strings.HasPrefix(rel, "galks/") {
+			ent = &entry{name: rel}
+			entries = append(entries, ent)
+		}
+		ent.files++
+		ent.size += info.Size()
+		total += info.Size()
+		for _, f := range ent.formats {
+			if f == format {
+				return nil
+			}
+		}
+		ent.formats = append(ent.formats, format)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if galks.files != 0 {
+		galks.name = fmt.Sprintf("galks/ (%d files)", galks.files)
+		entries = append(entries, galks)
+	}
+
+	if hasSecretKey {
+		e.printf("Secret key     present\n")
+	} else {
+		e.printf("Secret key     absent, evaluation keys only\n")
+	}
+	e.printf("\n%-26s %-28s %11s  %s\n", "FILE", "CONTENT", "SIZE", "FORMAT")
+	for _, ent := range entries {
+		e.printf("%-26s %-28s %11s  %s\n", ent.name, fileContent(ent.name), formatBytes(ent.size), strings.Join(ent.formats, " | "))
+	}
+	e.printf("%-26s %-28s %11s\n", "total", "", formatBytes(total))
+	return nil
+}
+
+// fileFormat describes the codec and the compression of the file at path, and
+// whether it was stamped with other parameters than fp.
+func fileFormat(path string, fp lattigo_key.Fingerprint) (string, error) {
+	info, err := lattigo_key.ReadKeyFileInfo(path)
+	if err != nil {
+		return "", err
+	}
+	format := info.Codec.String()
+	if info.SeedCompressed {
+		format += ", seed-compressed"
+	}
+	if info.Fingerprint != (lattigo_key.Fingerprint{}) && info.Fingerprint != fp {
+		format += ", OTHER PARAMETERS " + info.Fingerprint.String()[:16]
+	}
+	return format, nil
+}
+
+// fileContent describes the content of the file named name by SaveKeys.
+func fileContent(name string) string {
+	switch {
+	case name == "params":
+		return "parameters"
+	case name == "btparams":
+		return "bootstrapping parameters"
+	case name == "sk.key":
+		return "secret key"
+	case name == "pk.key":
+		return "public key"
+	case name == "rlk.key":
+		return "relinearization key"
+	case strings.HasPrefix(name, "galks/"), name == "galks.mkeys":
+		return "galois keys"
+	case name == "btp.key", name == "btp_memset.key", name == "btp.mkeys":
+		return "bootstrapping keys"
+	case strings.HasPrefix(name, "btp_"):
+		return "bootstrapping key"
+	case name == "test_ctxt":
+		return "test ciphertext"
+	default:
+		return "unknown"
+	}
+}
+
+// distribution returns the JSON encoding of d, as in parameter files.
+func distribution(d ring.DistributionParameters) string {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return fmt.Sprint(d)
+	}
+	return string(data)
+}
+
+func runVerify(e *env, args []string) error {
+	fs := e.flagSet("verify")
+	galoisSamples := fs.Int("galois-samples", 0, "number of galois keys checked, all of them if 0")
+	skipBootstrap := fs.Bool("skip-bootstrap", false, "skip the trial bootstrapping")
+	dirs, err := parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	dirPath := dirs[0]
+
+	// The files are checked against the fingerprint of the parameters as they are loaded
+	ctx, err := lattigo_key.LoadKeysWithOptions(dirPath, lattigo_key.LoadOptions{SkipValidation: true})
+	if err != nil {
+		return fmt.Errorf("%s: %w", dirPath, err)
+	}
+	defer ctx.Close()
+
+	if _, err := os.Stat(filepath.Join(dirPath, "sk.key")); os.IsNotExist(err) {
+		e.printf("%s has no secret key: the keys load and match the parameters %s, but cannot be checked against the secret key\n", dirPath, ctx.Fingerprint())
+		return nil
+	}
+
+	report, err := ctx.Validate(lattigo_key.ValidateOptions{GaloisSamples: *galoisSamples, SkipBootstrapping: *skipBootstrap})
+	if err != nil {
+		return err
+	}
+	e.printf("%s", report)
+	if !report.OK() {
+		return fmt.Errorf("%w in %s: %s", lattigo_key.ErrInconsistentKeys, dirPath, strings.Join(report.Inconsistent(), ", "))
+	}
+	e.printf("%s: the keys match the parameters %s and the secret key\n", dirPath, ctx.Fingerprint())
+	return nil
+}
+
+func runExportPublic(e *env, args []string) error {
+	return rewrite(e, "export-public", args, true)
+}
+
+func runConvert(e *env, args []string) error {
+	return rewrite(e, "convert", args, false)
+}
+
+// rewrite loads the keys of the source directory and saves them to -out with the
+// storage flags, without the secret key if evaluationOnly is true or if the source
+// has none.
+func rewrite(e *env, name string, args []string, evaluationOnly bool) error {
+	fs := e.flagSet(name)
+	out := fs.String("out", "", "directory the keys are written to")
+	force := fs.Bool("force", false, "replace the directory -out if it exists")
+	saveOptions := storageFlags(fs)
+	dirs, err := parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	opts, err := saveOptions()
+	if err != nil {
+		return err
+	}
+	src := dirs[0]
+	if err := checkOutput(*out, *force, src); err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(filepath.Join(src, "sk.key")); os.IsNotExist(err) {
+		evaluationOnly = true
+	}
+	opts.EvaluationOnly = evaluationOnly
+
+	ctx, err := lattigo_key.LoadKeys(src)
+	if err != nil {
+		return fmt.Errorf("%s: %w", src, err)
+	}
+	defer ctx.Close()
+
+	if err := save(ctx, *out, opts); err != nil {
+		return err
+	}
+	e.printf("Wrote the keys of %s\n\n", src)
+	return inspect(e, *out)
+}
+
+// save saves the keys of ctx to dirPath, and removes the directory if they cannot
+// all be saved, e.g. seed-compressed keys loaded from uncompressed files.
+func save(ctx *lattigo_key.Context, dirPath string, opts lattigo_key.SaveOptions) error {
+	if err := ctx.SaveKeysWithOptions(dirPath, opts); err != nil {
+		os.RemoveAll(dirPath)
+		return err
+	}
+	return nil
+}
+
+// checkOutput returns an error if out is not set, is the source directory src, or
+// exists while force is false, as SaveKeys replaces the directory it writes to.
+func checkOutput(out string, force bool, src string) error {
+	if out == "" {
+		return fmt.Errorf("%w: -out is required", ErrUsage)
+	}
+	if src != "" {
+		absOut, err := filepath.Abs(out)
+		if err != nil {
+			return err
+		}
+		absSrc, err := filepath.Abs(src)
+		if err != nil {
+			return err
+		}
+		if absOut == absSrc {
+			return fmt.Errorf("%w: -out is the source directory %s", ErrUsage, src)
+		}
+	}
+	if _, err := os.Stat(out); err == nil && !force {
+		return fmt.Errorf("%s exists, use -force to replace it", out)
+	} else if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+// Command hekeys generates, inspects, verifies and converts the key directories of
+// lattigo_key, and encrypts, evaluates on and decrypts CSV data with them. See
+// package cli for its usage.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/JihunSKKU/HE-CCFD/lattigo_key/cli"
+)
+
+func main() {
+	err := cli.Run(os.Args[1:], os.Stdout, os.Stderr)
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+	case errors.Is(err, cli.ErrUsage):
+		fmt.Fprintln(os.Stderr, "hekeys:", err)
+		os.Exit(2)
+	default:
+		fmt.Fprintln(os.Stderr, "hekeys:", err)
+		os.Exit(1)
+	}
+}
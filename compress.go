@@ -0,0 +1,158 @@
+package lattigo_key
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// compressedMagic starts compressed artifacts. It is followed by the Codec and
+// by the compressed stream, so that a compressed artifact can be decoded as it
+// is read.
+const compressedMagic = "HEZC"
+
+// DefaultMaxDecompressedBytes bounds the size of a ciphertext once decompressed when
+// DecodeOptions.MaxDecompressedBytes is zero.
+const DefaultMaxDecompressedBytes = 4 << 30
+
+// ErrDecompressedTooLarge is returned when a ciphertext decompresses to more than
+// DecodeOptions.MaxDecompressedBytes.
+var ErrDecompressedTooLarge = errors.New("decompressed data too large")
+
+// Codec is the compression of an artifact.
+type Codec uint8
+
+const (
+	CodecNone Codec = iota
+	CodecGzip
+	CodecZstd
+)
+
+func (c Codec) String() string {
+	switch c {
+	case CodecNone:
+		return "none"
+	case CodecGzip:
+		return "gzip"
+	case CodecZstd:
+		return "zstd"
+	default:
+		return fmt.Sprintf("Codec(%d)", uint8(c))
+	}
+}
+
+// ParseCodec returns the codec named s, as returned by Codec.String.
+func ParseCodec(s string) (Codec, error) {
+	for _, c := range []Codec{CodecNone, CodecGzip, CodecZstd} {
+		if strings.EqualFold(s, c.String()) {
+			return c, nil
+		}
+	}
+	return CodecNone, fmt.Errorf("unknown codec %q", s)
+}
+
+// NewCompressWriter returns a writer compressing what is written to it into w
+// with codec, after the header recording the codec. Close must be called to
+// flush the stream; it does not close w. With CodecNone, writes go to w as is.
+func NewCompressWriter(w io.Writer, codec Codec) (io.WriteCloser, error) {
+	if codec == CodecNone {
+		return nopWriteCloser{w}, nil
+	}
+
+	if _, err := w.Write(append([]byte(compressedMagic), byte(codec))); err != nil {
+		return nil, err
+	}
+
+	switch codec {
+	case CodecGzip:
+		return gzip.NewWriter(w), nil
+	case CodecZstd:
+		// The default level stores key coefficients uncompressed, the better level
+		// gets the unused high bits of each 64-bit coefficient
+		return zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.SpeedBetterCompression))
+	default:
+		return nil, fmt.Errorf("unknown codec %d", codec)
+	}
+}
+
+// NewDecompressReader returns a reader decompressing r according to its header.
+// Artifacts without the header were not compressed and are read as is.
+func NewDecompressReader(r io.Reader) (io.ReadCloser, error) {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+
+	header, err := br.Peek(len(compressedMagic) + 1)
+	if err != nil || string(header[:len(compressedMagic)]) != compressedMagic {
+		// Too short to be compressed, or not compressed
+		return io.NopCloser(br), nil
+	}
+	codec := Codec(header[len(compressedMagic)])
+	if _, err = br.Discard(len(header)); err != nil {
+		return nil, err
+	}
+
+	switch codec {
+	case CodecGzip:
+		return gzip.NewReader(br)
+	case CodecZstd:
+		dec, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return dec.IOReadCloser(), nil
+	default:
+		return nil, fmt.Errorf("unknown codec %d", codec)
+	}
+}
+
+// isCompressed returns true if data starts with the header of a compressed artifact.
+func isCompressed(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(compressedMagic))
+}
+
+// writeCompressed writes data to w compressed with codec.
+func writeCompressed(w io.Writer, codec Codec, data []byte) error {
+	cw, err := NewCompressWriter(w, codec)
+	if err != nil {
+		return err
+	}
+	if _, err = cw.Write(data); err != nil {
+		return err
+	}
+	return cw.Close()
+}
+
+// limitedReader reads at most max bytes from r, and fails with ErrDecompressedTooLarge
+// when more are read, unlike io.LimitReader, which ends the stream without error.
+type limitedReader struct {
+	r      io.Reader
+	n, max int64
+}
+
+func (l *limitedReader) Read(p []byte) (n int, err error) {
+	if l.n <= 0 {
+		return 0, fmt.Errorf("%w: more than %d bytes", ErrDecompressedTooLarge, l.max)
+	}
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+	}
+	n, err = l.r.Read(p)
+	l.n -= int64(n)
+	return
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
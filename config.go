@@ -0,0 +1,144 @@
+package lattigo_key
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tuneinsight/lattigo/v5/he/hefloat"
+	"github.com/tuneinsight/lattigo/v5/he/hefloat/bootstrapping"
+	"github.com/tuneinsight/lattigo/v5/ring"
+	"github.com/tuneinsight/lattigo/v5/schemes/ckks"
+	"gopkg.in/yaml.v3"
+)
+
+// ParametersConfig holds the literals from which the parameters and the bootstrapping
+// parameters of a Context are built. It is read from a JSON parameter file such as
+//
+//	{
+//	  "params": {
+//	    "LogN": 16,
+//	    "LogQ": [60, 45, 45, 45, 45, 45, 45, 45],
+//	    "LogP": [61, 61],
+//	    "LogDefaultScale": 45,
+//	    "Xs": {"Type": "Ternary", "H": 192}
+//	  },
+//	  "btparams": {
+//	    "LogN": 16,
+//	    "LogP": [61, 61, 61, 61],
+//	    "Xs": {"Type": "Ternary", "H": 192}
+//	  }
+//	}
+//
+// or from the same document in YAML, where the fields are those of hefloat.ParametersLiteral
+// and bootstrapping.ParametersLiteral, and the fields left out take their lattigo defaults.
+type ParametersConfig struct {
+	Params   hefloat.ParametersLiteral       `json:"params"`
+	BtParams bootstrapping.ParametersLiteral `json:"btparams"`
+}
+
+// UnmarshalJSON decodes a parameter file. The distributions Xs and Xe are given as
+// in the JSON encoding of lattigo parameters, e.g. {"Type": "Ternary", "H": 192}.
+func (c *ParametersConfig) UnmarshalJSON(data []byte) error {
+	var file struct {
+		Params   json.RawMessage `json:"params"`
+		BtParams json.RawMessage `json:"btparams"`
+	}
+	if err := decodeStrictJSON(data, &file); err != nil {
+		return err
+	}
+	if len(file.Params) == 0 {
+		return fmt.Errorf("parameter file has no params")
+	}
+
+	// hefloat.ParametersLiteral does not have the UnmarshalJSON of ckks.ParametersLiteral
+	var params ckks.ParametersLiteral
+	if err := json.Unmarshal(file.Params, &params); err != nil {
+		return fmt.Errorf("params: %w", err)
+	}
+
+	// The distributions of bootstrapping.ParametersLiteral are interfaces, which are
+	// decoded from maps as in ckks.ParametersLiteral
+	var btparams struct {
+		bootstrapping.ParametersLiteral
+		Xs map[string]interface{}
+		Xe map[string]interface{}
+	}
+	if len(file.BtParams) != 0 {
+		if err := decodeStrictJSON(file.BtParams, &btparams); err != nil {
+			return fmt.Errorf("btparams: %w", err)
+		}
+	}
+	var err error
+	if btparams.Xs != nil {
+		if btparams.ParametersLiteral.Xs, err = ring.ParametersFromMap(btparams.Xs); err != nil {
+			return fmt.Errorf("btparams: Xs: %w", err)
+		}
+	}
+	if btparams.Xe != nil {
+		if btparams.ParametersLiteral.Xe, err = ring.ParametersFromMap(btparams.Xe); err != nil {
+			return fmt.Errorf("btparams: Xe: %w", err)
+		}
+	}
+
+	c.Params = hefloat.ParametersLiteral(params)
+	c.BtParams = btparams.ParametersLiteral
+	return nil
+}
+
+// decodeStrictJSON decodes data into v and returns an error on fields v does not
+// have, so that a misspelled parameter is not silently replaced by its default.
+func decodeStrictJSON(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// UnmarshalYAML decodes a parameter file written in YAML, with the same fields as in JSON.
+func (c *ParametersConfig) UnmarshalYAML(value *yaml.Node) error {
+	// The YAML document is decoded through its JSON equivalent, so that both formats
+	// share the decoding of the distributions and the check of the field names
+	var doc interface{}
+	if err := value.Decode(&doc); err != nil {
+		return err
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return c.UnmarshalJSON(data)
+}
+
+// LoadParametersConfig reads the parameter file at path, in YAML if its extension
+// is .yaml or .yml and in JSON otherwise.
+func LoadParametersConfig(path string) (*ParametersConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := new(ParametersConfig)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, c)
+	default:
+		err = json.Unmarshal(data, c)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
+
+// NewParameters builds the parameters and the bootstrapping parameters of the config.
+func (c *ParametersConfig) NewParameters() (params hefloat.Parameters, btparams bootstrapping.Parameters, err error) {
+	if params, err = hefloat.NewParametersFromLiteral(c.Params); err != nil {
+		return params, btparams, fmt.Errorf("invalid params: %w", err)
+	}
+	if btparams, err = bootstrapping.NewParametersFromLiteral(params, c.BtParams); err != nil {
+		return params, btparams, fmt.Errorf("invalid btparams: %w", err)
+	}
+	return params, btparams, nil
+}
@@ -1,20 +1,22 @@
 package lattigo_key
 
 import (
-	"reflect"
+	"fmt"
 	"sync"
-	"unsafe"
 
 	"github.com/tuneinsight/lattigo/v5/core/rlwe"
 	"github.com/tuneinsight/lattigo/v5/he/hefloat"
 	"github.com/tuneinsight/lattigo/v5/he/hefloat/bootstrapping"
+	"github.com/tuneinsight/lattigo/v5/ring"
+	"github.com/tuneinsight/lattigo/v5/utils"
+	"github.com/tuneinsight/lattigo/v5/utils/sampling"
 )
 
 type Context struct {
 	params 		hefloat.Parameters
 	btparams 	bootstrapping.Parameters
 	ecd 		*hefloat.Encoder
-	kgen 		*rlwe.KeyGenerator
+	kgen 		keyGenerator
 	sk 			*rlwe.SecretKey
 	pk 			*rlwe.PublicKey
 	rlk 		*rlwe.RelinearizationKey
@@ -23,10 +25,29 @@ type Context struct {
 	dec 		*rlwe.Decryptor
 	eval 		*hefloat.Evaluator
 	evalPool 	*sync.Pool
+
+	// Copies of ecd, enc and dec for concurrent encryptions and decryptions
+	ecdPool 	*sync.Pool
+	encPool 	*sync.Pool
+	decPool 	*sync.Pool
 	
 	btpkeys 	*bootstrapping.EvaluationKeys
 	btpEval 	*bootstrapping.Evaluator
 	btpEvalPool *sync.Pool
+
+	fingerprint Fingerprint
+
+	// rlk and galKs are the keys of the bootstrapping parameters, see sharedEvaluationKeys
+	sharedKeys 	bool
+
+	// Seeds of the uniform components of the keys, by key name, from which
+	// SaveKeys writes seed-compressed keys
+	uniformSeed []byte
+	keySeeds 	map[string][]byte
+	keySeedsMu	sync.Mutex
+
+	// Releases the key files memory-mapped by LoadKeys
+	unmaps 		[]func() error
 }
 
 func (ctx *Context) GetEval() (eval *hefloat.Evaluator) {
@@ -38,60 +59,209 @@ func (ctx *Context) PutEval(eval *hefloat.Evaluator) (){
 	return
 }
 
+// GetEncoder returns an encoder of the pool of ctx, to be returned with PutEncoder.
+func (ctx *Context) GetEncoder() (ecd *hefloat.Encoder) {
+	ecd = ctx.ecdPool.Get().(*hefloat.Encoder)
+	return
+}
+func (ctx *Context) PutEncoder(ecd *hefloat.Encoder) (){
+	ctx.ecdPool.Put(ecd)
+	return
+}
+
+// GetEncryptor returns a public key encryptor of the pool of ctx, or nil if ctx has
+// no public key. It is returned with PutEncryptor.
+func (ctx *Context) GetEncryptor() (enc *rlwe.Encryptor) {
+	enc, _ = ctx.encPool.Get().(*rlwe.Encryptor)
+	return
+}
+func (ctx *Context) PutEncryptor(enc *rlwe.Encryptor) (){
+	if enc != nil {
+		ctx.encPool.Put(enc)
+	}
+	return
+}
+
+// GetDecryptor returns a decryptor of the pool of ctx, or nil if ctx has no secret key.
+// It is returned with PutDecryptor.
+func (ctx *Context) GetDecryptor() (dec *rlwe.Decryptor) {
+	dec, _ = ctx.decPool.Get().(*rlwe.Decryptor)
+	return
+}
+func (ctx *Context) PutDecryptor(dec *rlwe.Decryptor) (){
+	if dec != nil {
+		ctx.decPool.Put(dec)
+	}
+	return
+}
+
+// setEncryptionPools builds the pools of copies of the encoder, encryptor and decryptor
+// of ctx, those it does not have giving nil.
+func (ctx *Context) setEncryptionPools() {
+	ctx.ecdPool = &sync.Pool{
+		New: func() interface{} {
+			return ctx.ecd.ShallowCopy()
+		},
+	}
+	ctx.encPool = &sync.Pool{
+		New: func() interface{} {
+			if ctx.enc != nil {
+				return ctx.enc.ShallowCopy()
+			}
+			return nil
+		},
+	}
+	ctx.decPool = &sync.Pool{
+		New: func() interface{} {
+			if ctx.dec != nil {
+				return ctx.dec.ShallowCopy()
+			}
+			return nil
+		},
+	}
+}
+
+func (ctx *Context) GetBtpEval() (eval *bootstrapping.Evaluator) {
+	eval = ctx.btpEvalPool.Get().(*bootstrapping.Evaluator)
+	return
+}
+func (ctx *Context) PutBtpEval(eval *bootstrapping.Evaluator) (){
+	ctx.btpEvalPool.Put(eval)
+	return
+}
+
 func NewContext(params hefloat.Parameters, btparams bootstrapping.Parameters) (ctx *Context) {
 // func NewContext(params hefloat.Parameters) (ctx *Context) {
-	kgen := rlwe.NewKeyGenerator(params)
-	sk, pk := kgen.GenKeyPairNew()
+	return NewContextWithOptions(params, btparams, ContextOptions{})
+}
+
+// ContextOptions configures the key generation of NewContextWithOptions.
+type ContextOptions struct {
+	// Seed, if not empty, is the seed every key is derived from, see NewSeededContext.
+	Seed []byte
+
+	// SecurityFloor is the estimated security level, in bits, below which parameters
+	// are refused, DefaultSecurityFloor if it is zero.
+	SecurityFloor int
+
+	// Insecure generates the keys of parameters below SecurityFloor instead of
+	// panicking, for tests on small parameters only.
+	Insecure bool
+}
+
+// NewContextWithOptions is NewContext with the options of opts. It panics on parameters
+// below opts.SecurityFloor unless opts.Insecure is set.
+func NewContextWithOptions(params hefloat.Parameters, btparams bootstrapping.Parameters, opts ContextOptions) (ctx *Context) {
+	if !opts.Insecure {
+		floor := opts.SecurityFloor
+		if floor == 0 {
+			floor = DefaultSecurityFloor
+		}
+		if err := CheckSecurityFloor(params, btparams, floor); err != nil {
+			panic("heccfd: " + err.Error())
+		}
+	}
+
+	if len(opts.Seed) == 0 {
+		newKgen := func(params rlwe.ParameterProvider, _ string) keyGenerator {
+			return rlwe.NewKeyGenerator(params)
+		}
+		return newContext(params, btparams, newKgen, nil)
+	}
+	seed := opts.Seed
+	newKgen := func(params rlwe.ParameterProvider, label string) keyGenerator {
+		return newSeededKeyGenerator(params, seed, label)
+	}
+	return newContext(params, btparams, newKgen, deriveSeed(seed, "uniform"))
+}
+
+// keyGenerator generates the keys of a Context: it is a *rlwe.KeyGenerator, or a
+// *seededKeyGenerator for seeded contexts.
+type keyGenerator interface {
+	GenSecretKeyNew() *rlwe.SecretKey
+	GenSecretKeyWithHammingWeightNew(hw int) *rlwe.SecretKey
+	GenPublicKeyNew(sk *rlwe.SecretKey) *rlwe.PublicKey
+	GenRelinearizationKeyNew(sk *rlwe.SecretKey, evkParams ...rlwe.EvaluationKeyParameters) *rlwe.RelinearizationKey
+	GenGaloisKeyNew(galEl uint64, sk *rlwe.SecretKey, evkParams ...rlwe.EvaluationKeyParameters) *rlwe.GaloisKey
+	GenEvaluationKeyNew(skInput, skOutput *rlwe.SecretKey, evkParams ...rlwe.EvaluationKeyParameters) *rlwe.EvaluationKey
+	GenEvaluationKeysForRingSwapNew(skStd, skConjugateInvariant *rlwe.SecretKey, evkParams ...rlwe.EvaluationKeyParameters) (stdToci, ciToStd *rlwe.EvaluationKey)
+}
+
+// keyGeneratorFactory returns the key generator of the keys of params. The label
+// tells apart the key generators of a same Context.
+type keyGeneratorFactory func(params rlwe.ParameterProvider, label string) keyGenerator
+
+// newContext generates the keys of a Context with the key generators of newKgen.
+// The seeds of the uniform components of the keys are derived from uniformSeed, or
+// drawn from crypto/rand if it is nil.
+func newContext(params hefloat.Parameters, btparams bootstrapping.Parameters, newKgen keyGeneratorFactory, uniformSeed []byte) (ctx *Context) {
+	kgen := newKgen(params, "keys")
 
 	ctx = &Context{
-		params: params,
-		ecd: 	hefloat.NewEncoder(params),
-		kgen: 	kgen,
-		sk: 	sk,
-		pk: 	pk,
-		enc: 	rlwe.NewEncryptor(params, pk),
-		dec: 	rlwe.NewDecryptor(params, sk),
+		params: 	 params,
+		ecd: 		 hefloat.NewEncoder(params),
+		kgen: 		 kgen,
+		uniformSeed: uniformSeed,
+		keySeeds: 	 map[string][]byte{},
 	}
+	ctx.sk = kgen.GenSecretKeyNew()
+	ctx.pk = ctx.uniformKeyGenerator(kgen, "pk").GenPublicKeyNew(ctx.sk)
+	ctx.enc = rlwe.NewEncryptor(params, ctx.pk)
+	ctx.dec = rlwe.NewDecryptor(params, ctx.sk)
+	ctx.setEncryptionPools()
 
+	var err error
+	ctx.btparams = btparams
+	ctx.sharedKeys = sharedEvaluationKeys(params, btparams)
+	if ctx.fingerprint, err = NewFingerprint(params, btparams); err != nil {
+		panic(err)
+	}
+
+	var galEls []uint64
 	if params.PCount() != 0 {
-		ctx.rlk = kgen.GenRelinearizationKeyNew(sk)
 		slots := params.MaxSlots()
 		rots := genRots(slots)
-		var galEls []uint64
 		for i := 0; i < len(rots); i++ {
 			galEls = append(galEls, params.GaloisElement(rots[i]))
 		}
 
-		ctx.galKs = kgen.GenGaloisKeysNew(galEls, sk)
-
-		ctx.eval = hefloat.NewEvaluator(params, rlwe.NewMemEvaluationKeySet(
-				ctx.rlk, ctx.galKs...))
+		// With shared keys, the relinearization and galois keys are generated with the bootstrapping keys
+		if !ctx.sharedKeys {
+			ctx.rlk = ctx.uniformKeyGenerator(kgen, "rlk").GenRelinearizationKeyNew(ctx.sk)
 
-		ctx.evalPool = &sync.Pool{
-			New: func() interface{} {
-				if ctx.eval != nil {
-					return ctx.eval.ShallowCopy()
+			// Rotations by k and k - slots share their Galois element, hence their key
+			galKs := map[uint64]*rlwe.GaloisKey{}
+			for _, galEl := range galEls {
+				if _, ok := galKs[galEl]; !ok {
+					galKs[galEl] = ctx.uniformKeyGenerator(kgen, galoisKeySeedName("galk", galEl)).GenGaloisKeyNew(galEl, ctx.sk)
 				}
-				return nil
-			},
+				ctx.galKs = append(ctx.galKs, galKs[galEl])
+			}
 		}
-
-		ctx.fillPool()
 	}
 
-	var err error
-	ctx.btparams = btparams
-	ctx.btpkeys, _, err = ctx.btparams.GenEvaluationKeys(ctx.sk)
+	ctx.btpkeys, err = ctx.genBtpEvaluationKeys(newKgen, galEls)
 	if err != nil {
 		panic(err)
 	}
+	if ctx.sharedKeys {
+		ctx.rlk = ctx.btpkeys.RelinearizationKey
+		for _, galEl := range utils.GetSortedKeys(ctx.btpkeys.GaloisKeys) {
+			ctx.galKs = append(ctx.galKs, ctx.btpkeys.GaloisKeys[galEl])
+		}
+	}
+
+	if params.PCount() != 0 {
+		ctx.setEvaluator()
+	}
+
 	if ctx.btpEval, err = bootstrapping.NewEvaluator(ctx.btparams, ctx.btpkeys); err != nil {
 		panic(err)
 	}
 	ctx.btpEvalPool = &sync.Pool{
 		New: func() interface{} {
 			if ctx.btpEval != nil {
-				return ctx.btpEval.ShallowCopy()
+				return ctx.shallowCopyBtpEval()
 			}
 			return nil
 		},
@@ -100,6 +270,135 @@ func NewContext(params hefloat.Parameters, btparams bootstrapping.Parameters) (c
 	return ctx
 }
 
+// sharedEvaluationKeys returns true if the relinearization and galois keys of the
+// bootstrapping parameters also serve ciphertexts of params, in which case a Context
+// generates each of them once, under the bootstrapping parameters, and evaluates with
+// them. This holds when both have the same ring and the moduli of params are the first
+// moduli of the bootstrapping parameters; the auxiliary moduli P may differ, as the
+// evaluator of the Context is then built on the bootstrapping parameters.
+func sharedEvaluationKeys(params hefloat.Parameters, btparams bootstrapping.Parameters) bool {
+	paramsN2 := btparams.BootstrappingParameters
+	if params.PCount() == 0 || params.N() != paramsN2.N() || params.RingType() != paramsN2.RingType() || params.QCount() > paramsN2.QCount() {
+		return false
+	}
+	for i, qi := range params.Q() {
+		if paramsN2.Q()[i] != qi {
+			return false
+		}
+	}
+	return true
+}
+
+// evalParams returns the parameters of the evaluator of ctx: the bootstrapping
+// parameters if its keys are shared with the bootstrapping keys.
+func (ctx *Context) evalParams() hefloat.Parameters {
+	if ctx.sharedKeys {
+		return ctx.btparams.BootstrappingParameters
+	}
+	return ctx.params
+}
+
+// genBtpEvaluationKeys follows bootstrapping.Parameters.GenEvaluationKeys, which creates
+// key generators of its own, with the key generators of newKgen and a seed per key.
+func (ctx *Context) genBtpEvaluationKeys(newKgen keyGeneratorFactory, galEls []uint64) (*bootstrapping.EvaluationKeys, error) {
+	paramsN2 := ctx.btparams.BootstrappingParameters
+	kgen := newKgen(paramsN2, "btp")
+	btpkeys := &bootstrapping.EvaluationKeys{}
+
+	var skN2 *rlwe.SecretKey
+	if ctx.btparams.ResidualParameters.N() != paramsN2.N() {
+		skN2 = kgen.GenSecretKeyNew()
+		if ctx.btparams.ResidualParameters.RingType() == ring.ConjugateInvariant {
+			// Both keys are generated by one call, which is made once per key to give each its own seed
+			btpkeys.EvkCmplxToReal, _ = ctx.uniformKeyGenerator(kgen, "btp_cmplx_to_real").GenEvaluationKeysForRingSwapNew(skN2, ctx.sk)
+			_, btpkeys.EvkRealToCmplx = ctx.uniformKeyGenerator(kgen, "btp_real_to_cmplx").GenEvaluationKeysForRingSwapNew(skN2, ctx.sk)
+		} else {
+			btpkeys.EvkN1ToN2 = ctx.uniformKeyGenerator(kgen, "btp_n1_to_n2").GenEvaluationKeyNew(ctx.sk, skN2)
+			btpkeys.EvkN2ToN1 = ctx.uniformKeyGenerator(kgen, "btp_n2_to_n1").GenEvaluationKeyNew(skN2, ctx.sk)
+		}
+	} else {
+		skN2 = extendSecretKey(ctx.sk, paramsN2)
+	}
+
+	if ctx.btparams.EphemeralSecretWeight != 0 {
+		paramsSparse, err := rlwe.NewParametersFromLiteral(rlwe.ParametersLiteral{
+			LogN: paramsN2.LogN(),
+			Q:    paramsN2.Q()[:1],
+			P:    paramsN2.P()[:1],
+		})
+		if err != nil {
+			return nil, err
+		}
+		skSparse := newKgen(paramsSparse, "btp_sparse").GenSecretKeyWithHammingWeightNew(ctx.btparams.EphemeralSecretWeight)
+		kgenDense := newKgen(paramsN2, "btp_dense")
+		btpkeys.EvkDenseToSparse = ctx.uniformKeyGenerator(kgenDense, "btp_dense_to_sparse").GenEvaluationKeyNew(skN2, skSparse)
+		btpkeys.EvkSparseToDense = ctx.uniformKeyGenerator(kgenDense, "btp_sparse_to_dense").GenEvaluationKeyNew(skSparse, skN2)
+	}
+
+	rlkName, galkPrefix := "btp_rlk", "btp_galk"
+	btpGalEls := append(ctx.btparams.GaloisElements(paramsN2), paramsN2.GaloisElementForComplexConjugation())
+	if ctx.sharedKeys {
+		// One key set keyed by Galois element for both evaluators, saved as rlk.key and galks
+		rlkName, galkPrefix = "rlk", "galk"
+		btpGalEls = append(galEls, btpGalEls...)
+	}
+
+	btpkeys.MemEvaluationKeySet = rlwe.NewMemEvaluationKeySet(ctx.uniformKeyGenerator(kgen, rlkName).GenRelinearizationKeyNew(skN2))
+	for _, galEl := range btpGalEls {
+		if _, ok := btpkeys.GaloisKeys[galEl]; !ok {
+			btpkeys.GaloisKeys[galEl] = ctx.uniformKeyGenerator(kgen, galoisKeySeedName(galkPrefix, galEl)).GenGaloisKeyNew(galEl, skN2)
+		}
+	}
+
+	return btpkeys, nil
+}
+
+// extendSecretKey returns sk extended to the full modulus of paramsN2, which has the same ring degree.
+func extendSecretKey(sk *rlwe.SecretKey, paramsN2 hefloat.Parameters) *rlwe.SecretKey {
+	ringQ, ringP := paramsN2.RingQ(), paramsN2.RingP()
+	skN2 := rlwe.NewSecretKey(paramsN2)
+	buff := ringQ.NewPoly()
+	rlwe.ExtendBasisSmallNormAndCenterNTTMontgomery(ringQ, ringQ, sk.Value.Q, buff, skN2.Value.Q)
+	rlwe.ExtendBasisSmallNormAndCenterNTTMontgomery(ringQ, ringP, sk.Value.Q, buff, skN2.Value.P)
+	return skN2
+}
+
+// shallowCopyBtpEval returns a copy of ctx.btpEval that can be used concurrently.
+// bootstrapping.Evaluator.ShallowCopy drops the parameters and keys of the receiver,
+// so they are restored here. The ring switching buffers are unexported and cannot
+// be restored, hence a new evaluator is built when the ring degree or type changes.
+func (ctx *Context) shallowCopyBtpEval() *bootstrapping.Evaluator {
+	if ctx.btparams.ResidualParameters.N() != ctx.btparams.BootstrappingParameters.N() ||
+		ctx.btparams.ResidualParameters.RingType() != ctx.btparams.BootstrappingParameters.RingType() {
+		eval, err := bootstrapping.NewEvaluator(ctx.btparams, ctx.btpkeys)
+		if err != nil {
+			panic(err)
+		}
+		return eval
+	}
+
+	eval := ctx.btpEval.ShallowCopy()
+	eval.Parameters = ctx.btpEval.Parameters
+	eval.EvaluationKeys = ctx.btpEval.EvaluationKeys
+	return eval
+}
+
+// setEvaluator builds the evaluator of ctx and a new pool of copies of it from the
+// relinearization and galois keys of ctx.
+func (ctx *Context) setEvaluator() {
+	ctx.eval = hefloat.NewEvaluator(ctx.evalParams(), rlwe.NewMemEvaluationKeySet(ctx.rlk, ctx.galKs...))
+	ctx.evalPool = &sync.Pool{
+		New: func() interface{} {
+			if ctx.eval != nil {
+				return ctx.eval.ShallowCopy()
+			}
+			return nil
+		},
+	}
+
+	ctx.fillPool()
+}
+
 func (ctx *Context) fillPool() {
 	numEval := 16
 
@@ -127,41 +426,223 @@ func (ctx *Context) fillPool() {
 	return
 }
 
-func (ctx *Context) Encrypt(ptxt *Plaintext) (ctxt *Ciphertext) {
-	var err error
+// EncryptOptions are the options of EncryptWithOptions and Encode.
+type EncryptOptions struct {
+	// Symmetric encrypts under the secret key instead of the public key, with the
+	// uniform component of each ciphertext read from a seed of its own. The Ciphertext
+	// is then serialized with the seeds, which halves its size, and ReadFrom expands
+	// them back, so that the evaluation side needs no change.
+	Symmetric bool
+
+	// Workers is the number of ciphertexts encoded and encrypted at the same time,
+	// or GOMAXPROCS if zero.
+	Workers int
+
+	// Level is the level the values are encoded at, or the maximum level if nil. Lower
+	// levels give smaller ciphertexts for shallow computations, and match the level of
+	// the ciphertexts they are combined with.
+	Level *int
+
+	// Scale is the scale the values are encoded at, or the default scale if nil, e.g.
+	// the scale of the ciphertexts they are added to. Plaintext operands of a
+	// multiplication are usually encoded at the scale of the modulus of their level,
+	// see OperandScale, so that the product is rescaled back to the scale of the
+	// ciphertext.
+	Scale *rlwe.Scale
+}
+
+// encoding returns the level and scale of opts, and the number of samples of ptxt per
+// ciphertext and the number of ciphertexts. It panics on a level out of the parameters,
+// a non-positive scale, samples larger than the slots, or complex samples under
+// ConjugateInvariant parameters.
+func (ctx *Context) encoding(ptxt *Plaintext, opts EncryptOptions) (level int, scale rlwe.Scale, perCtxt, numCtxt int) {
+	level, scale = ctx.params.MaxLevel(), ctx.params.DefaultScale()
+	if opts.Level != nil {
+		if level = *opts.Level; level < 0 || level > ctx.params.MaxLevel() {
+			panic(fmt.Sprintf("heccfd: encryption level %d is out of the levels 0 to %d of the parameters", level, ctx.params.MaxLevel()))
+		}
+	}
+	if opts.Scale != nil {
+		if scale = *opts.Scale; scale.Value.Sign() <= 0 {
+			panic(fmt.Sprintf("heccfd: encryption scale %v is not positive", &scale.Value))
+		}
+	}
+
+	// The slots are the N/2 complex slots of Standard parameters, or the N real slots of
+	// ConjugateInvariant ones, which hold twice the samples in packed mode
+	if ptxt.imag != nil && ctx.params.RingType() == ring.ConjugateInvariant {
+		panic("heccfd: complex samples cannot be encrypted under ConjugateInvariant parameters, whose slots are real")
+	}
+	slots := ctx.params.MaxSlots()
+	if ptxt.interval < 1 {
+		panic(fmt.Sprintf("heccfd: Plaintext interval %d is not positive", ptxt.interval))
+	}
+	if slots < ptxt.space*ptxt.interval {
+		panic(fmt.Sprintf("heccfd: Plaintext space of %d values at interval %d is too large for the %d slots of the current context", ptxt.space, ptxt.interval, slots))
+	}
 
-	// Currently, it panics when the number of features in data is larger than slots
+	// In packed mode, each ciphertext holds slots/(space*interval) samples
+	perCtxt = 1
+	if ptxt.packed {
+		perCtxt = slots / (ptxt.space * ptxt.interval)
+	}
+	numCtxt = (len(ptxt.data) + perCtxt - 1) / perCtxt
+	return
+}
+
+// encode encodes the samples of the i-th ciphertext of ptxt at level and scale.
+func (ctx *Context) encode(ptxt *Plaintext, i, perCtxt, level int, scale rlwe.Scale) (encoded *rlwe.Plaintext, err error) {
+	re, im := ptxt.data[i], []float64(nil)
+	if ptxt.imag != nil {
+		im = ptxt.imag[i]
+	}
+	// A sample of its own takes the slots/interval values of a block of all the slots
 	slots := ctx.params.MaxSlots()
-	if slots < ptxt.space {
-		panic("heccfd: Plaintext space is too large for the current context")
+	first, last, space := i, i+1, slots/ptxt.interval
+	if ptxt.packed {
+		first, last, space = i*perCtxt, utils.Min(len(ptxt.data), (i+1)*perCtxt), ptxt.space
+	}
+	if ptxt.packed || ptxt.interval != 1 {
+		re = packSamples(ptxt.data[first:last], space, ptxt.interval, slots)
+		if ptxt.imag != nil {
+			im = packSamples(ptxt.imag[first:last], space, ptxt.interval, slots)
+		}
 	}
 
-	maxLevel := ctx.params.MaxLevel()
-	numImgs := len(ptxt.data)
+	ecd := ctx.GetEncoder()
+	defer ctx.PutEncoder(ecd)
+	encoded = hefloat.NewPlaintext(ctx.params, level)
+	encoded.Scale = scale
+	if im != nil {
+		err = ecd.Encode(complexValues(re, im), encoded)
+	} else {
+		err = ecd.Encode(re, encoded)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return encoded, nil
+}
+
+// OperandScale returns the scale of the modulus of level, at which a plaintext operand
+// multiplied with a ciphertext at level gives a product of the scale of the ciphertext
+// once rescaled.
+func (ctx *Context) OperandScale(level int) rlwe.Scale {
+	return rlwe.NewScale(ctx.params.Q()[level])
+}
+
+// Encode encodes the samples of ptxt, without encrypting them, into the plaintext operands
+// of the ciphertexts EncryptWithOptions gives with opts, e.g. to multiply them with
+// the ciphertexts of other samples. Symmetric is ignored.
+func (ctx *Context) Encode(ptxt *Plaintext, opts EncryptOptions) (operands []*rlwe.Plaintext) {
+	level, scale, perCtxt, numCtxt := ctx.encoding(ptxt, opts)
+
+	operands = make([]*rlwe.Plaintext, numCtxt)
+	tasks := make([]func() error, numCtxt)
+	for i := range tasks {
+		i := i
+		tasks[i] = func() (err error) {
+			operands[i], err = ctx.encode(ptxt, i, perCtxt, level, scale)
+			return err
+		}
+	}
+	if err := runTasks(opts.Workers, tasks); err != nil {
+		panic(err)
+	}
+	return
+}
+
+// Encrypt encrypts the samples of ptxt, one or, if it is packed, several per ciphertext,
+// with the encoders and encryptors of the pools of ctx. It is safe for concurrent use.
+func (ctx *Context) Encrypt(ptxt *Plaintext) (ctxt *Ciphertext) {
+	return ctx.EncryptWithOptions(ptxt, EncryptOptions{})
+}
+
+// EncryptWithOptions is Encrypt with opts.
+func (ctx *Context) EncryptWithOptions(ptxt *Plaintext, opts EncryptOptions) (ctxt *Ciphertext) {
+	if opts.Symmetric {
+		if ctx.sk == nil {
+			panic("heccfd: Context has no secret key and cannot encrypt symmetrically")
+		}
+	} else if ctx.enc == nil {
+		panic("heccfd: Context has no public key and cannot encrypt")
+	}
+
+	level, scale, perCtxt, numCtxt := ctx.encoding(ptxt, opts)
 
 	ctxt = &Ciphertext{
-		data: 		make([]*rlwe.Ciphertext, numImgs),
+		data: 		make([]*rlwe.Ciphertext, numCtxt),
 		size: 		ptxt.size,
 		interval: 	ptxt.interval,
 		constVal: 	ptxt.constVal,
 		space: 		ptxt.space,
+		packed: 	ptxt.packed,
+		complex: 	ptxt.imag != nil,
+		numSamples: len(ptxt.data),
+		fingerprint: ctx.fingerprint,
+	}
+	if opts.Symmetric {
+		ctxt.seeds = make([]*ciphertextSeed, numCtxt)
 	}
 
-	for i := 0; i < numImgs; i++ {
-		encoded := hefloat.NewPlaintext(ctx.params, maxLevel)
-		if err = ctx.ecd.Encode(ptxt.data[i], encoded); err != nil {
-			panic(err)
-		}
-		if ctxt.data[i], err = ctx.enc.EncryptNew(encoded); err != nil {
-			panic(err)
+	tasks := make([]func() error, numCtxt)
+	for i := range tasks {
+		i := i
+		tasks[i] = func() (err error) {
+			encoded, err := ctx.encode(ptxt, i, perCtxt, level, scale)
+			if err != nil {
+				return err
+			}
+
+			enc := ctx.GetEncryptor()
+			defer ctx.PutEncryptor(enc)
+			if !opts.Symmetric {
+				ctxt.data[i], err = enc.EncryptNew(encoded)
+				return err
+			}
+
+			// WithKey and WithPRNG share the buffers of enc, which this task holds until it is put back
+			if enc == nil {
+				enc = rlwe.NewEncryptor(ctx.params, ctx.sk)
+			}
+			ctxt.seeds[i] = newCiphertextSeed(*ctx.params.GetRLWEParameters(), level)
+			prng, err := sampling.NewKeyedPRNG(ctxt.seeds[i].seed)
+			if err != nil {
+				return err
+			}
+			ctxt.data[i], err = enc.WithKey(ctx.sk).WithPRNG(prng).EncryptNew(encoded)
+			return err
 		}
 	}
-		
+	if err := runTasks(opts.Workers, tasks); err != nil {
+		panic(err)
+	}
+
 	return
 }
 
+// DecryptOptions are the options of DecryptWithOptions.
+type DecryptOptions struct {
+	// Workers is the number of ciphertexts decrypted and decoded at the same time,
+	// or GOMAXPROCS if zero.
+	Workers int
+}
+
+// Decrypt decrypts the samples of ctxt with the decryptors and encoders of the pools
+// of ctx. The samples of a complex ciphertext keep their imaginary parts, see
+// Plaintext.GetComplexData. It is safe for concurrent use.
 func (ctx *Context) Decrypt(ctxt *Ciphertext) (ptxt *Plaintext) {
-	var err error
+	return ctx.DecryptWithOptions(ctxt, DecryptOptions{})
+}
+
+// DecryptWithOptions is Decrypt with opts.
+func (ctx *Context) DecryptWithOptions(ctxt *Ciphertext, opts DecryptOptions) (ptxt *Plaintext) {
+	if ctx.dec == nil {
+		panic("heccfd: Context has no secret key and cannot decrypt")
+	}
+	if err := ctx.checkFingerprint("ciphertext", ctxt.fingerprint); err != nil {
+		panic(err)
+	}
 
 	numCtxt := len(ctxt.data)
 
@@ -171,66 +652,55 @@ func (ctx *Context) Decrypt(ctxt *Ciphertext) (ptxt *Plaintext) {
 		interval: 	ctxt.interval,
 		constVal: 	ctxt.constVal,
 		space: 		ctxt.space,
+		packed: 	ctxt.packed,
+	}
+	if ctxt.complex {
+		ptxt.imag = make([][]float64, numCtxt)
 	}
 
-	ptxtC := make([][]complex128, numCtxt)
-	for i := 0; i < numCtxt; i++ {
-		decrypted := ctx.dec.DecryptNew(ctxt.data[i])
-		ptxtC[i] = make([]complex128, ctxt.data[i].Slots())
-		if err = ctx.ecd.Decode(decrypted, ptxtC[i]); err != nil {
-			panic(err)
+	tasks := make([]func() error, numCtxt)
+	for i := range tasks {
+		i := i
+		tasks[i] = func() error {
+			dec := ctx.GetDecryptor()
+			defer ctx.PutDecryptor(dec)
+			decrypted := dec.DecryptNew(ctxt.data[i])
+
+			ecd := ctx.GetEncoder()
+			defer ctx.PutEncoder(ecd)
+			values := make([]complex128, ctxt.data[i].Slots())
+			if err := ecd.Decode(decrypted, values); err != nil {
+				return err
+			}
+
+			// The imaginary parts of real samples are only noise, and are dropped
+			ptxt.data[i] = make([]float64, len(values))
+			for p := range values {
+				ptxt.data[i][p] = real(values[p])
+			}
+			if ctxt.complex {
+				ptxt.imag[i] = make([]float64, len(values))
+				for p := range values {
+					ptxt.imag[i][p] = imag(values[p])
+				}
+			}
+			return nil
 		}
 	}
+	if err := runTasks(opts.Workers, tasks); err != nil {
+		panic(err)
+	}
 
-	for i := 0; i < numCtxt; i++ {
-		ptxt.data[i] = make([]float64, ctxt.data[i].Slots())
-		for p := 0; p < ctxt.data[i].Slots(); p++ {
-			ptxt.data[i][p] = real(ptxtC[i][p])
+	space, numSamples := ctxt.space, ctxt.numSamples
+	if !ctxt.packed {
+		space, numSamples = ctxt.Slots()/ctxt.interval, numCtxt
+	}
+	if ctxt.packed || ctxt.interval != 1 {
+		ptxt.data = unpackSamples(ptxt.data, space, ctxt.interval, numSamples)
+		if ctxt.complex {
+			ptxt.imag = unpackSamples(ptxt.imag, space, ctxt.interval, numSamples)
 		}
 	}
 
 	return
 }
-
-func calculateDeepSize(v reflect.Value) uintptr {
-	if !v.IsValid() {
-		return 0
-	}
-
-	switch v.Kind() {
-	case reflect.Ptr, reflect.Interface:
-		if v.IsNil() {
-			return 0
-		}
-		if v.Kind() == reflect.Interface {
-			return calculateDeepSize(v.Elem())
-		}
-		ptr := v.Pointer()
-		return unsafe.Sizeof(ptr) + calculateDeepSize(v.Elem())
-
-	case reflect.Array, reflect.Slice:
-		size := v.Type().Size()
-		for i := 0; i < v.Len(); i++ {
-			size += calculateDeepSize(v.Index(i))
-		}
-		return size
-
-	case reflect.Struct:
-		size := v.Type().Size()
-		for i := 0; i < v.NumField(); i++ {
-			size += calculateDeepSize(v.Field(i))
-		}
-		return size
-
-	case reflect.Map:
-		size := v.Type().Size()
-		for _, key := range v.MapKeys() {
-			size += calculateDeepSize(key)
-			size += calculateDeepSize(v.MapIndex(key))
-		}
-		return size
-
-	default:
-		return v.Type().Size()
-	}
-}
\ No newline at end of file
@@ -0,0 +1,195 @@
+package lattigo_key
+
+import (
+	"sort"
+	"time"
+
+	"github.com/tuneinsight/lattigo/v5/core/rlwe"
+	"github.com/tuneinsight/lattigo/v5/he/hefloat"
+	"github.com/tuneinsight/lattigo/v5/he/hefloat/bootstrapping"
+	"github.com/tuneinsight/lattigo/v5/utils"
+)
+
+// KeyGenBytesPerSecond is the rate at which a single core generates key material,
+// used by EstimateKeyGen to predict the duration of the key generation.
+// It was measured around 200 MB/s on a recent x86-64 core and can be recalibrated.
+var KeyGenBytesPerSecond = 200e6
+
+// KeyGenEstimate predicts the resources needed by NewContext to generate keys.
+// The embedded report holds the size NewContext's keys will have, so that
+// it can be compared with the KeySizes of the generated Context.
+type KeyGenEstimate struct {
+	*KeySizeReport
+
+	// PeakMemoryBytes is the memory held by the keys plus the buffers of the key
+	// generation. It excludes the plaintext matrices of the bootstrapping evaluator.
+	PeakMemoryBytes int64 `json:"peak_memory_bytes"`
+
+	// Duration is the expected key generation time on one core.
+	Duration time.Duration `json:"duration"`
+}
+
+// EstimateKeyGen predicts the size of every key NewContext generates for params,
+// btparams and the given rotations, from the ring degree, moduli counts and
+// decomposition parameters only. If rots is nil, the rotations NewContext
+// generates by default are used.
+func EstimateKeyGen(params hefloat.Parameters, btparams bootstrapping.Parameters, rots []int) (*KeyGenEstimate, error) {
+	if rots == nil {
+		rots = genRots(params.MaxSlots())
+	}
+
+	r := &KeySizeReport{}
+
+	paramBytes, err := params.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	r.Params = ArtifactSize{Name: "params", DiskBytes: int64(len(paramBytes))}
+
+	btparamBytes, err := btparams.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	r.BtParams = ArtifactSize{Name: "btparams", DiskBytes: int64(len(btparamBytes))}
+
+	rlweParams := *params.GetRLWEParameters()
+	N, qCount, pCount := rlweParams.N(), rlweParams.QCount(), rlweParams.PCount()
+
+	r.SecretKey = keyArtifactSize("sk.key", qpPolyBinarySize(N, qCount, pCount), qpPolyMemorySize(N, qCount, pCount))
+	r.PublicKey = keyArtifactSize("pk.key", 8+2*qpPolyBinarySize(N, qCount, pCount), 2*qpPolyMemorySize(N, qCount, pCount))
+
+	// Bootstrapping keys are generated under the bootstrapping parameters
+	btpParams := *btparams.BootstrappingParameters.GetRLWEParameters()
+	btpEvkSize, btpEvkMemory := evaluationKeySize(btpParams)
+
+	btpGalEls := map[uint64]bool{}
+	for _, galEl := range append(btparams.GaloisElements(btparams.BootstrappingParameters), btparams.BootstrappingParameters.GaloisElementForComplexConjugation()) {
+		btpGalEls[galEl] = true
+	}
+
+	// Shared keys are generated once, under the bootstrapping parameters, for the
+	// Galois elements of the rotations and of the bootstrapping
+	shared := sharedEvaluationKeys(params, btparams)
+	evkSize, evkMemory := evaluationKeySize(rlweParams)
+	galEls := params.GaloisElements(rots)
+	if shared {
+		evkSize, evkMemory = btpEvkSize, btpEvkMemory
+		union := map[uint64]bool{}
+		for _, galEl := range galEls {
+			union[galEl] = true
+		}
+		for galEl := range btpGalEls {
+			union[galEl] = true
+		}
+		galEls = utils.GetSortedKeys(union)
+	}
+
+	var maxEvkMemory int64
+	if pCount != 0 {
+		r.RelinearizationKey = keyArtifactSize("rlk.key", evkSize, evkMemory)
+		maxEvkMemory = evkMemory
+
+		for i, galEl := range galEls {
+			size := GaloisKeySize{
+				GaloisElement: galEl,
+				ArtifactSize:  keyArtifactSize(galoisKeyFileName(i), evkSize+16, evkMemory),
+			}
+			r.GaloisKeys = append(r.GaloisKeys, size)
+			r.GaloisKeysDiskBytes += size.DiskBytes
+			r.GaloisKeysMemoryBytes += size.MemoryBytes
+		}
+	}
+	if btpEvkMemory > maxEvkMemory {
+		maxEvkMemory = btpEvkMemory
+	}
+
+	if !shared {
+		// MemEvaluationKeySet: flags, relinearization key, map size and one uint64 index per galois key
+		setSize := 1 + btpEvkSize + 1 + 4 + len(btpGalEls)*(8+btpEvkSize+16)
+		setMemory := int64(1+len(btpGalEls)) * btpEvkMemory
+		r.BootstrappingKeys = append(r.BootstrappingKeys,
+			keyArtifactSize("btp.key", setSize, 0),
+			keyArtifactSize("btp_memset.key", setSize, setMemory))
+	}
+
+	var evks []string
+	if btparams.ResidualParameters.N() != btparams.BootstrappingParameters.N() {
+		if btparams.ResidualParameters.RingType() == btparams.BootstrappingParameters.RingType() {
+			evks = append(evks, "btp_n1_to_n2", "btp_n2_to_n1")
+		} else {
+			evks = append(evks, "btp_real_to_cmplx", "btp_cmplx_to_real")
+		}
+	}
+	if btparams.EphemeralSecretWeight != 0 {
+		evks = append(evks, "btp_dense_to_sparse", "btp_sparse_to_dense")
+	}
+	for _, name := range evks {
+		r.BootstrappingKeys = append(r.BootstrappingKeys, keyArtifactSize(name+".key", btpEvkSize, btpEvkMemory))
+	}
+	sortArtifactSizes(r.BootstrappingKeys)
+
+	for _, size := range r.BootstrappingKeys {
+		r.BootstrappingKeysDiskBytes += size.DiskBytes
+		r.BootstrappingKeysMemoryBytes += size.MemoryBytes
+	}
+	for _, size := range []ArtifactSize{r.Params, r.BtParams, r.SecretKey, r.PublicKey, r.RelinearizationKey} {
+		r.TotalDiskBytes += size.DiskBytes
+		r.TotalMemoryBytes += size.MemoryBytes
+	}
+	r.TotalDiskBytes += r.GaloisKeysDiskBytes + r.BootstrappingKeysDiskBytes
+	r.TotalMemoryBytes += r.GaloisKeysMemoryBytes + r.BootstrappingKeysMemoryBytes
+
+	// The key generator holds the extended secret key of the bootstrapping
+	// parameters and one key under construction on top of the generated keys.
+	btpQCount, btpPCount := btpParams.QCount(), btpParams.PCount()
+	peak := r.TotalMemoryBytes + qpPolyMemorySize(btpParams.N(), btpQCount, btpPCount) + maxEvkMemory
+
+	generated := r.TotalMemoryBytes + qpPolyMemorySize(btpParams.N(), btpQCount, btpPCount)
+
+	return &KeyGenEstimate{
+		KeySizeReport:   r,
+		PeakMemoryBytes: peak,
+		Duration:        time.Duration(float64(generated) / KeyGenBytesPerSecond * float64(time.Second)),
+	}, nil
+}
+
+// polyBinarySize returns the BinarySize of a ring.Poly of N coefficients over the given number of moduli.
+func polyBinarySize(N, moduli int) int {
+	return 8 + moduli*(8+8*N)
+}
+
+func qpPolyBinarySize(N, qCount, pCount int) int {
+	return polyBinarySize(N, qCount) + polyBinarySize(N, pCount)
+}
+
+func qpPolyMemorySize(N, qCount, pCount int) int64 {
+	return 8 * int64(N) * int64(qCount+pCount)
+}
+
+// evaluationKeySize returns the BinarySize and memory of an evaluation key at the
+// maximum levels of params without base two decomposition, as generated by NewContext.
+func evaluationKeySize(params rlwe.Parameters) (size int, memory int64) {
+	N, qCount, pCount := params.N(), params.QCount(), params.PCount()
+	levelQ, levelP := params.MaxLevelQ(), params.MaxLevelP()
+
+	// A degree one VectorQP holds two polynomials
+	vectorSize := 8 + 2*qpPolyBinarySize(N, qCount, pCount)
+	vectorMemory := 2 * qpPolyMemorySize(N, qCount, pCount)
+
+	// BaseTwoDecomposition and the size of the gadget matrix, which has one row
+	// per RNS decomposition element
+	size = 8 + 8
+	cols := params.BaseTwoDecompositionVectorSize(levelQ, levelP, 0)
+	for i := 0; i < params.BaseRNSDecompositionVectorSize(levelQ, levelP); i++ {
+		size += 8 + cols[i]*vectorSize
+		memory += int64(cols[i]) * vectorMemory
+	}
+
+	return
+}
+
+func sortArtifactSizes(sizes []ArtifactSize) {
+	sort.Slice(sizes, func(i, j int) bool {
+		return sizes[i].Name < sizes[j].Name
+	})
+}
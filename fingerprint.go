@@ -0,0 +1,173 @@
+package lattigo_key
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/tuneinsight/lattigo/v5/he/hefloat"
+	"github.com/tuneinsight/lattigo/v5/he/hefloat/bootstrapping"
+)
+
+// keyFileMagic starts the header stamped on every key file written by SaveKeys.
+const keyFileMagic = "HEKY"
+
+// ErrFingerprintMismatch is returned when objects made under different parameters are combined.
+var ErrFingerprintMismatch = errors.New("parameter fingerprint mismatch")
+
+// Fingerprint is a SHA-256 hash identifying the parameters and bootstrapping
+// parameters of a Context.
+type Fingerprint [32]byte
+
+// NewFingerprint hashes the marshalled params and btparams.
+func NewFingerprint(params hefloat.Parameters, btparams bootstrapping.Parameters) (fp Fingerprint, err error) {
+	paramBytes, err := params.MarshalBinary()
+	if err != nil {
+		return fp, err
+	}
+	btparamBytes, err := btparams.MarshalBinary()
+	if err != nil {
+		return fp, err
+	}
+
+	h := sha256.New()
+	h.Write(paramBytes)
+	h.Write(btparamBytes)
+	copy(fp[:], h.Sum(nil))
+
+	return fp, nil
+}
+
+func (fp Fingerprint) String() string {
+	return hex.EncodeToString(fp[:])
+}
+
+func (ctx *Context) Fingerprint() Fingerprint {
+	return ctx.fingerprint
+}
+
+// checkFingerprint returns an ErrFingerprintMismatch naming what if fp was made
+// under other parameters than the context, or is zero, i.e. missing.
+func (ctx *Context) checkFingerprint(what string, fp Fingerprint) error {
+	if fp == (Fingerprint{}) {
+		return fmt.Errorf("%w: %s has no parameter fingerprint, context uses %s", ErrFingerprintMismatch, what, ctx.fingerprint)
+	}
+	if fp != ctx.fingerprint {
+		return fmt.Errorf("%w: %s was made under parameters %s, context uses %s", ErrFingerprintMismatch, what, fp, ctx.fingerprint)
+	}
+	return nil
+}
+
+// writeKeyFile writes data to path, compressed with codec, preceded by a header stamping fp.
+// The header is left uncompressed so that the fingerprint can be checked without decompressing.
+func writeKeyFile(path string, fp Fingerprint, codec Codec, data []byte) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err = file.Write([]byte(keyFileMagic)); err != nil {
+		return err
+	}
+	if _, err = file.Write(fp[:]); err != nil {
+		return err
+	}
+
+	if err = writeCompressed(file, codec, data); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// readKeyFile reads a file written by writeKeyFile, checks that it was stamped with fp
+// and decompresses it. Files written before fingerprints were introduced have no header,
+// and are returned as is if legacy is true, see LoadOptions.Legacy.
+func readKeyFile(path string, fp Fingerprint, legacy bool) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	r := bufio.NewReader(file)
+
+	if magic, err := r.Peek(len(keyFileMagic)); err != nil || string(magic) != keyFileMagic {
+		if !legacy {
+			return nil, fmt.Errorf("%w: %s has no fingerprint header, which only the key files of LoadOptions.Legacy lack", ErrFingerprintMismatch, path)
+		}
+		return io.ReadAll(r)
+	}
+	if _, err = r.Discard(len(keyFileMagic)); err != nil {
+		return nil, err
+	}
+
+	var stamped Fingerprint
+	if _, err = io.ReadFull(r, stamped[:]); err != nil {
+		return nil, fmt.Errorf("%s: truncated key file header", path)
+	}
+	if stamped == (Fingerprint{}) {
+		return nil, fmt.Errorf("%w: %s has a header without fingerprint", ErrFingerprintMismatch, path)
+	}
+	if stamped != fp {
+		return nil, fmt.Errorf("%w: %s was made under parameters %s, expected %s", ErrFingerprintMismatch, path, stamped, fp)
+	}
+
+	dr, err := NewDecompressReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	defer dr.Close()
+	data, err := io.ReadAll(dr)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return data, nil
+}
+
+// KeyFileInfo describes the format of a file written by SaveKeys.
+type KeyFileInfo struct {
+	Fingerprint    Fingerprint // Zero if the file has no fingerprint header, e.g. params
+	Codec          Codec
+	SeedCompressed bool
+}
+
+// ReadKeyFileInfo reads the format of the file at path written by SaveKeys, other than
+// the memory-mapped galks.mkeys and btp.mkeys, by decompressing only its first bytes.
+func ReadKeyFileInfo(path string) (info KeyFileInfo, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return info, err
+	}
+	defer file.Close()
+	r := bufio.NewReader(file)
+
+	if magic, err := r.Peek(len(keyFileMagic)); err == nil && string(magic) == keyFileMagic {
+		if _, err = r.Discard(len(keyFileMagic)); err != nil {
+			return info, err
+		}
+		if _, err = io.ReadFull(r, info.Fingerprint[:]); err != nil {
+			return info, fmt.Errorf("%s: truncated key file header", path)
+		}
+		if info.Fingerprint == (Fingerprint{}) {
+			return info, fmt.Errorf("%w: %s has a header without fingerprint", ErrFingerprintMismatch, path)
+		}
+	}
+	if header, err := r.Peek(len(compressedMagic) + 1); err == nil && string(header[:len(compressedMagic)]) == compressedMagic {
+		info.Codec = Codec(header[len(compressedMagic)])
+	}
+
+	dr, err := NewDecompressReader(r)
+	if err != nil {
+		return info, fmt.Errorf("%s: %w", path, err)
+	}
+	defer dr.Close()
+	magic := make([]byte, len(seededKeyMagic))
+	if _, err := io.ReadFull(dr, magic); err == nil {
+		info.SeedCompressed = string(magic) == seededKeyMagic
+	}
+	return info, nil
+}
@@ -1,16 +1,25 @@
 package lattigo_key
 
 import (
+	"fmt"
+
 	"github.com/tuneinsight/lattigo/v5/core/rlwe"
 	"github.com/tuneinsight/lattigo/v5/he/hefloat"
 )
 
 // Rotation rotates the input ciphertext op0 by k positions and stores the result in opOut.
+// The positions are those of the slots of op0, N/2 complex slots under Standard parameters
+// and N real slots under ConjugateInvariant ones.
 func (ctx *Context) Rotation(op0 *rlwe.Ciphertext, k int, opOut *rlwe.Ciphertext) (err error) {
 	eval := ctx.evalPool.Get().(*hefloat.Evaluator)
 	defer ctx.evalPool.Put(eval)
 
-	rots := optimizeRotation(k, ctx.params.MaxSlots())
+	// Rotations added with AddRotations have their own key, the others are composed
+	// of the rotations of genRots modulo the slots of op0
+	rots := []int{k}
+	if _, err := eval.CheckAndGetGaloisKey(ctx.params.GaloisElement(k)); err != nil {
+		rots = optimizeRotation(k, op0.Slots())
+	}
 	if err := eval.Rotate(op0, rots[0], opOut); err != nil {
 		return err
 	}
@@ -33,4 +42,16 @@ func (ctx *Context) RotationNew(op0 *rlwe.Ciphertext, k int) (opOut *rlwe.Cipher
 	}
 
 	return opOut, nil
-}
\ No newline at end of file
+}
+
+// Bootstrap refreshes op0 to the maximum level of the residual parameters.
+func (ctx *Context) Bootstrap(op0 *rlwe.Ciphertext) (opOut *rlwe.Ciphertext, err error) {
+	if ctx.btpEvalPool == nil {
+		return nil, fmt.Errorf("context has no bootstrapping keys")
+	}
+
+	eval := ctx.GetBtpEval()
+	defer ctx.PutBtpEval(eval)
+
+	return eval.Bootstrap(op0)
+}
@@ -2,7 +2,11 @@ module github.com/JihunSKKU/HE-CCFD/lattigo_key
 
 go 1.19
 
-require github.com/tuneinsight/lattigo/v5 v5.0.2
+require (
+	github.com/klauspost/compress v1.17.4
+	github.com/tuneinsight/lattigo/v5 v5.0.2
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
 	github.com/ALTree/bigfloat v0.0.0-20220102081255-38c8b72a9924 // indirect
@@ -14,5 +18,4 @@ require (
 	golang.org/x/crypto v0.0.0-20220926161630-eccd6366d1be // indirect
 	golang.org/x/exp v0.0.0-20230321023759-10a507213a29 // indirect
 	golang.org/x/sys v0.1.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,418 @@
+package lattigo_key
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/tuneinsight/lattigo/v5/core/rlwe"
+	"github.com/tuneinsight/lattigo/v5/he/hefloat"
+	"github.com/tuneinsight/lattigo/v5/he/hefloat/bootstrapping"
+)
+
+// Magics of the serialized evaluation key requests and responses.
+const (
+	keyRequestMagic  = "HERQ"
+	keyResponseMagic = "HERS"
+)
+
+// A server evaluating on ciphertexts of a client does not need every key of genRots.
+// It lists the rotations it needs in an EvaluationKeyRequest, and the client, which
+// holds the secret key, answers with an EvaluationKeyResponse holding exactly their keys.
+//
+// A serialized request is
+//
+//	magic, fingerprint, relinearization, count, then for each rotation: rotation
+//
+// and a serialized response is
+//
+//	magic, fingerprint, rlk length, rlk, count, then for each galois key: length, key
+//
+// where relinearization is one byte, a rotation is an int64 and every other integer
+// is a uint64, all little-endian. Keys are in the format of the key files of SaveKeys,
+// seed-compressed or not, and an empty rlk stands for no relinearization key.
+
+// EvaluationKeyRequest lists the evaluation keys a server needs from the client.
+type EvaluationKeyRequest struct {
+	Fingerprint     Fingerprint // The fingerprint of the parameters of the server
+	Rotations       []int       // The rotations to send a galois key for
+	Relinearization bool        // Whether to send the relinearization key
+}
+
+// Empty returns true if the request asks for no key.
+func (req *EvaluationKeyRequest) Empty() bool {
+	return len(req.Rotations) == 0 && !req.Relinearization
+}
+
+func (req *EvaluationKeyRequest) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(keyRequestMagic)
+	buf.Write(req.Fingerprint[:])
+	if req.Relinearization {
+		buf.WriteByte(1)
+	} else {
+		buf.WriteByte(0)
+	}
+	buf.Write(binary.LittleEndian.AppendUint64(nil, uint64(len(req.Rotations))))
+	for _, rot := range req.Rotations {
+		buf.Write(binary.LittleEndian.AppendUint64(nil, uint64(int64(rot))))
+	}
+	return buf.Bytes(), nil
+}
+
+func (req *EvaluationKeyRequest) UnmarshalBinary(data []byte) error {
+	mr := messageReader{data: data, what: "evaluation key request"}
+	if magic := mr.read(len(keyRequestMagic)); mr.err == nil && string(magic) != keyRequestMagic {
+		return fmt.Errorf("not a serialized evaluation key request")
+	}
+	copy(req.Fingerprint[:], mr.read(len(req.Fingerprint)))
+	flag := mr.read(1)
+	count := mr.readCount(8)
+	if mr.err != nil {
+		return mr.err
+	}
+	req.Relinearization = flag[0] == 1
+	req.Rotations = make([]int, count)
+	for i := range req.Rotations {
+		req.Rotations[i] = int(int64(mr.readUint64()))
+	}
+	return mr.end()
+}
+
+// EvaluationKeyResponse holds the evaluation keys the client sends for an EvaluationKeyRequest.
+type EvaluationKeyResponse struct {
+	Fingerprint        Fingerprint // The fingerprint of the parameters of the client
+	RelinearizationKey []byte      // The relinearization key, or nil if it was not requested
+	GaloisKeys         [][]byte    // The galois keys of the requested rotations
+}
+
+func (resp *EvaluationKeyResponse) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(keyResponseMagic)
+	buf.Write(resp.Fingerprint[:])
+	buf.Write(binary.LittleEndian.AppendUint64(nil, uint64(len(resp.RelinearizationKey))))
+	buf.Write(resp.RelinearizationKey)
+	buf.Write(binary.LittleEndian.AppendUint64(nil, uint64(len(resp.GaloisKeys))))
+	for i, galk := range resp.GaloisKeys {
+		if len(galk) == 0 {
+			return nil, fmt.Errorf("galois key %d of the response is empty", i)
+		}
+		buf.Write(binary.LittleEndian.AppendUint64(nil, uint64(len(galk))))
+		buf.Write(galk)
+	}
+	return buf.Bytes(), nil
+}
+
+func (resp *EvaluationKeyResponse) UnmarshalBinary(data []byte) error {
+	mr := messageReader{data: data, what: "evaluation key response"}
+	if magic := mr.read(len(keyResponseMagic)); mr.err == nil && string(magic) != keyResponseMagic {
+		return fmt.Errorf("not a serialized evaluation key response")
+	}
+	copy(resp.Fingerprint[:], mr.read(len(resp.Fingerprint)))
+	resp.RelinearizationKey = nil
+	if rlk := mr.read(mr.readCount(1)); len(rlk) != 0 {
+		resp.RelinearizationKey = append([]byte(nil), rlk...)
+	}
+	count := mr.readCount(8)
+	if mr.err != nil {
+		return mr.err
+	}
+	resp.GaloisKeys = make([][]byte, count)
+	for i := range resp.GaloisKeys {
+		resp.GaloisKeys[i] = append([]byte(nil), mr.read(mr.readCount(1))...)
+	}
+	return mr.end()
+}
+
+// messageReader reads the fields of a serialized message. The first error is kept,
+// after which reads return zero values.
+type messageReader struct {
+	data []byte
+	what string
+	err  error
+}
+
+func (mr *messageReader) read(n int) []byte {
+	if mr.err != nil {
+		return make([]byte, n)
+	}
+	if n > len(mr.data) {
+		mr.err = fmt.Errorf("truncated %s", mr.what)
+		return make([]byte, n)
+	}
+	p := mr.data[:n]
+	mr.data = mr.data[n:]
+	return p
+}
+
+func (mr *messageReader) readUint64() uint64 {
+	return binary.LittleEndian.Uint64(mr.read(8))
+}
+
+// readCount reads the number of the following items of at least size bytes each,
+// which must fit in the rest of the message.
+func (mr *messageReader) readCount(size int) int {
+	count := mr.readUint64()
+	if mr.err == nil && count > uint64(len(mr.data)/size) {
+		mr.err = fmt.Errorf("truncated %s", mr.what)
+	}
+	if mr.err != nil {
+		return 0
+	}
+	return int(count)
+}
+
+// end returns the first error, or an error if data is left after the message.
+func (mr *messageReader) end() error {
+	if mr.err == nil && len(mr.data) != 0 {
+		return fmt.Errorf("trailing data after %s", mr.what)
+	}
+	return mr.err
+}
+
+// NewEvaluationContext returns a Context without keys for params and btparams, on
+// the side of a server evaluating on ciphertexts of a client. Its evaluation keys are
+// obtained from the client with NewEvaluationKeyRequest and ApplyEvaluationKeyResponse.
+// It can neither encrypt, decrypt nor bootstrap.
+func NewEvaluationContext(params hefloat.Parameters, btparams bootstrapping.Parameters) (ctx *Context, err error) {
+	ctx = &Context{
+		params:   params,
+		btparams: btparams,
+		ecd:      hefloat.NewEncoder(params),
+		keySeeds: map[string][]byte{},
+	}
+	ctx.sharedKeys = sharedEvaluationKeys(params, btparams)
+	if ctx.fingerprint, err = NewFingerprint(params, btparams); err != nil {
+		return nil, err
+	}
+	ctx.setEvaluator()
+	ctx.setEncryptionPools()
+	return ctx, nil
+}
+
+// NewEvaluationKeyRequest returns a request for the galois keys of the rotations rots
+// that ctx does not have yet, one per Galois element, and for the relinearization key
+// if ctx has none.
+func (ctx *Context) NewEvaluationKeyRequest(rots []int) *EvaluationKeyRequest {
+	have := map[uint64]bool{}
+	for _, galk := range ctx.galKs {
+		have[galk.GaloisElement] = true
+	}
+
+	req := &EvaluationKeyRequest{
+		Fingerprint:     ctx.fingerprint,
+		Relinearization: ctx.rlk == nil,
+	}
+	for _, rot := range rots {
+		if galEl := ctx.params.GaloisElement(rot); !have[galEl] {
+			have[galEl] = true
+			req.Rotations = append(req.Rotations, rot)
+		}
+	}
+	return req
+}
+
+// RespondEvaluationKeys returns the keys asked for by req, which must be made under
+// the parameters of ctx. The galois keys ctx has are sent as they are, the others are
+// generated with the secret key of ctx but not added to it. With seedCompressed, keys
+// are sent seed-compressed, as SaveOptions.SeedCompressed saves them.
+func (ctx *Context) RespondEvaluationKeys(req *EvaluationKeyRequest, seedCompressed bool) (*EvaluationKeyResponse, error) {
+	if err := ctx.checkFingerprint("evaluation key request", req.Fingerprint); err != nil {
+		return nil, err
+	}
+	if ctx.sk == nil {
+		return nil, fmt.Errorf("cannot generate evaluation keys without the secret key")
+	}
+	if ctx.params.PCount() == 0 {
+		return nil, fmt.Errorf("cannot generate evaluation keys for parameters without auxiliary moduli")
+	}
+
+	resp := &EvaluationKeyResponse{Fingerprint: ctx.fingerprint}
+
+	var err error
+	if req.Relinearization {
+		if ctx.rlk == nil {
+			return nil, fmt.Errorf("context has no relinearization key")
+		}
+		if seedCompressed {
+			resp.RelinearizationKey, err = ctx.marshalSeededEvaluationKey("rlk", &ctx.rlk.EvaluationKey)
+		} else {
+			resp.RelinearizationKey, err = ctx.rlk.MarshalBinary()
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	galKs := map[uint64]*rlwe.GaloisKey{}
+	for _, galk := range ctx.galKs {
+		galKs[galk.GaloisElement] = galk
+	}
+	var genGaloisKey func(galEl uint64) *rlwe.GaloisKey
+
+	sent := map[uint64]bool{}
+	for _, rot := range req.Rotations {
+		galEl := ctx.params.GaloisElement(rot)
+		if sent[galEl] {
+			continue
+		}
+		sent[galEl] = true
+
+		galk, ok := galKs[galEl]
+		if !ok {
+			if genGaloisKey == nil {
+				genGaloisKey = ctx.galoisKeyGenerator()
+			}
+			galk = genGaloisKey(galEl)
+		}
+
+		var galkBytes []byte
+		if seedCompressed {
+			galkBytes, err = ctx.marshalSeededGaloisKey("galk", galk)
+		} else {
+			galkBytes, err = galk.MarshalBinary()
+		}
+		if err != nil {
+			return nil, err
+		}
+		resp.GaloisKeys = append(resp.GaloisKeys, galkBytes)
+	}
+
+	return resp, nil
+}
+
+// ApplyEvaluationKeyResponse adds the keys of resp, which must be made under the
+// parameters of ctx, to ctx and rebuilds the evaluator and its pool with them. Keys
+// ctx already has are kept. ApplyEvaluationKeyResponse must not be called while ctx
+// is evaluating.
+func (ctx *Context) ApplyEvaluationKeyResponse(resp *EvaluationKeyResponse) error {
+	rlk, added, err := ctx.readEvaluationKeyResponse(resp)
+	if err != nil {
+		return err
+	}
+
+	if rlk == nil && len(added) == 0 {
+		return nil
+	}
+	if rlk != nil {
+		ctx.rlk = rlk
+	}
+	ctx.galKs = append(ctx.galKs, added...)
+	if ctx.sharedKeys && ctx.btpkeys != nil {
+		ctx.btpkeys.RelinearizationKey = ctx.rlk
+		for _, galk := range added {
+			ctx.btpkeys.GaloisKeys[galk.GaloisElement] = galk
+		}
+	}
+	ctx.setEvaluator()
+
+	return nil
+}
+
+// WithEvaluationKeyResponse returns a Context evaluating with the keys of ctx and those
+// of resp, which must be made under the parameters of ctx, and leaves ctx unchanged, so
+// that the keys a client sends only serve its own ciphertexts. The returned Context
+// shares the keys, the encryption and the bootstrapping of ctx, which does not use the
+// keys of resp. It is ctx itself if resp holds no key ctx does not have.
+func (ctx *Context) WithEvaluationKeyResponse(resp *EvaluationKeyResponse) (*Context, error) {
+	with := &Context{
+		params:      ctx.params,
+		btparams:    ctx.btparams,
+		ecd:         ctx.ecd,
+		kgen:        ctx.kgen,
+		sk:          ctx.sk,
+		pk:          ctx.pk,
+		rlk:         ctx.rlk,
+		galKs:       ctx.galKs[:len(ctx.galKs):len(ctx.galKs)],
+		enc:         ctx.enc,
+		dec:         ctx.dec,
+		ecdPool:     ctx.ecdPool,
+		encPool:     ctx.encPool,
+		decPool:     ctx.decPool,
+		btpkeys:     ctx.btpkeys,
+		btpEval:     ctx.btpEval,
+		btpEvalPool: ctx.btpEvalPool,
+		fingerprint: ctx.fingerprint,
+		sharedKeys:  ctx.sharedKeys,
+		uniformSeed: ctx.uniformSeed,
+		keySeeds:    map[string][]byte{},
+	}
+
+	// The seeds of the keys of resp are recorded in the returned Context only
+	rlk, added, err := with.readEvaluationKeyResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+	if rlk == nil && len(added) == 0 {
+		return ctx, nil
+	}
+	if rlk != nil {
+		with.rlk = rlk
+	}
+	with.galKs = append(with.galKs, added...)
+	with.setEvaluator()
+	return with, nil
+}
+
+// readEvaluationKeyResponse returns the relinearization key of resp if ctx has none,
+// and the galois keys of resp whose Galois element ctx has no key for.
+func (ctx *Context) readEvaluationKeyResponse(resp *EvaluationKeyResponse) (rlk *rlwe.RelinearizationKey, added []*rlwe.GaloisKey, err error) {
+	if err := ctx.checkFingerprint("evaluation key response", resp.Fingerprint); err != nil {
+		return nil, nil, err
+	}
+	params := *ctx.evalParams().GetRLWEParameters()
+
+	if len(resp.RelinearizationKey) != 0 && ctx.rlk == nil {
+		rlk = new(rlwe.RelinearizationKey)
+		if isSeededKey(resp.RelinearizationKey) {
+			evk, err := ctx.unmarshalSeededEvaluationKey("rlk", resp.RelinearizationKey, params)
+			if err != nil {
+				return nil, nil, fmt.Errorf("relinearization key: %w", err)
+			}
+			rlk.EvaluationKey = *evk
+		} else if err := rlk.UnmarshalBinary(resp.RelinearizationKey); err != nil {
+			return nil, nil, fmt.Errorf("relinearization key: %w", err)
+		}
+		if err := checkEvaluationKeyRing(&rlk.EvaluationKey, params); err != nil {
+			return nil, nil, fmt.Errorf("relinearization key: %w", err)
+		}
+	}
+
+	have := map[uint64]bool{}
+	for _, galk := range ctx.galKs {
+		have[galk.GaloisElement] = true
+	}
+	for i, galkBytes := range resp.GaloisKeys {
+		var galk *rlwe.GaloisKey
+		var err error
+		if isSeededKey(galkBytes) {
+			galk, err = ctx.unmarshalSeededGaloisKey("galk", galkBytes, params)
+		} else {
+			galk = new(rlwe.GaloisKey)
+			err = galk.UnmarshalBinary(galkBytes)
+		}
+		if err == nil {
+			err = checkEvaluationKeyRing(&galk.EvaluationKey, params)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("galois key %d: %w", i, err)
+		}
+		if !have[galk.GaloisElement] {
+			have[galk.GaloisElement] = true
+			added = append(added, galk)
+		}
+	}
+	return rlk, added, nil
+}
+
+// checkEvaluationKeyRing returns an error if evk is not a key of the ring of params.
+func checkEvaluationKeyRing(evk *rlwe.EvaluationKey, params rlwe.Parameters) error {
+	if len(evk.Value) == 0 || len(evk.Value[0]) == 0 {
+		return fmt.Errorf("empty key")
+	}
+	N, qCount, pCount, _ := mappedKeyShape(evk)
+	if N != params.N() || qCount != params.QCount() || pCount != params.PCount() {
+		return fmt.Errorf("key of ring degree %d with %d+%d moduli, expected %d with %d+%d", N, qCount, pCount, params.N(), params.QCount(), params.PCount())
+	}
+	return nil
+}
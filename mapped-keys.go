@@ -0,0 +1,424 @@
+package lattigo_key
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"unsafe"
+
+	"github.com/tuneinsight/lattigo/v5/core/rlwe"
+	"github.com/tuneinsight/lattigo/v5/he/hefloat/bootstrapping"
+	"github.com/tuneinsight/lattigo/v5/ring"
+	"github.com/tuneinsight/lattigo/v5/ring/ringqp"
+	"github.com/tuneinsight/lattigo/v5/utils"
+	"github.com/tuneinsight/lattigo/v5/utils/structs"
+)
+
+// mappedKeyMagic starts the key files that LoadKeys memory-maps.
+const mappedKeyMagic = "HEMK"
+
+// mappedPageSize aligns the coefficients of each key in a mapped key file. It is
+// the page size of common hosts; hosts with larger pages still map the file, the
+// keys just do not start on their own pages.
+const mappedPageSize = 4096
+
+// Names of the mapped key files of SaveOptions.MemoryMapped, which replace the
+// galks directory and the bootstrapping key files.
+const (
+	mappedGaloisKeysFile = "galks.mkeys"
+	mappedBtpKeysFile    = "btp.mkeys"
+)
+
+// A mapped key file is
+//
+//	magic, fingerprint, count, then for each key: descriptor
+//	zero padding, then for each key at its offset: coefficients, zero padding
+//
+// where a descriptor is
+//
+//	name length, name, GaloisElement, NthRoot, BaseTwoDecomposition, N, levelQ+1, levelP+1,
+//	rows, cols of each row, offset
+//
+// and the coefficients are, for each row, col and component of the gadget ciphertext,
+// the moduli of Q then the moduli of P, each N little-endian uint64. Offsets are
+// multiples of mappedPageSize, so that the polynomials of a mapped key point into the
+// mapping. Keys that share an offset are the same key, e.g. the duplicate galois keys
+// of ctx.galKs. All the integers of the header are little-endian uint64.
+
+// mappedKey is a key of a mapped key file. GaloisElement and NthRoot are zero for
+// keys that are not galois keys.
+type mappedKey struct {
+	name          string
+	galoisElement uint64
+	nthRoot       uint64
+	evk           *rlwe.EvaluationKey
+}
+
+// mappedKeyShape returns N, the number of moduli of Q and of P and the number of
+// columns of each row of the gadget ciphertext of evk.
+func mappedKeyShape(evk *rlwe.EvaluationKey) (N, qCount, pCount int, cols []int) {
+	v := evk.Value
+	cols = make([]int, len(v))
+	for i := range v {
+		cols[i] = len(v[i])
+	}
+	q, p := v[0][0][0].Q, v[0][0][0].P
+	return q.N(), q.Level() + 1, p.Level() + 1, cols
+}
+
+// mappedKeySize returns the size in bytes of the coefficients of evk.
+func mappedKeySize(evk *rlwe.EvaluationKey) (size int) {
+	N, qCount, pCount, cols := mappedKeyShape(evk)
+	for _, c := range cols {
+		size += 2 * c * (qCount + pCount) * N * 8
+	}
+	return
+}
+
+// alignPage rounds offset up to a multiple of mappedPageSize.
+func alignPage(offset int) int {
+	return (offset + mappedPageSize - 1) / mappedPageSize * mappedPageSize
+}
+
+// mappedKeyHeader returns the header of a mapped key file holding keys at offsets.
+func mappedKeyHeader(fp Fingerprint, keys []mappedKey, offsets []int) []byte {
+	var buf bytes.Buffer
+	writeUint64 := func(v uint64) {
+		var b [8]byte
+		binary.LittleEndian.PutUint64(b[:], v)
+		buf.Write(b[:])
+	}
+
+	buf.WriteString(mappedKeyMagic)
+	buf.Write(fp[:])
+	writeUint64(uint64(len(keys)))
+	for i, key := range keys {
+		N, qCount, pCount, cols := mappedKeyShape(key.evk)
+		writeUint64(uint64(len(key.name)))
+		buf.WriteString(key.name)
+		writeUint64(key.galoisElement)
+		writeUint64(key.nthRoot)
+		writeUint64(uint64(key.evk.BaseTwoDecomposition))
+		writeUint64(uint64(N))
+		writeUint64(uint64(qCount))
+		writeUint64(uint64(pCount))
+		writeUint64(uint64(len(cols)))
+		for _, c := range cols {
+			writeUint64(uint64(c))
+		}
+		writeUint64(uint64(offsets[i]))
+	}
+	return buf.Bytes()
+}
+
+// writeMappedKeys writes keys to path in the page-aligned layout of mapped key files.
+func writeMappedKeys(path string, fp Fingerprint, keys []mappedKey) error {
+	// The header only depends on the number of keys and their shapes, so its size
+	// is known before the offsets are
+	offsets := make([]int, len(keys))
+	offset := alignPage(len(mappedKeyHeader(fp, keys, offsets)))
+	written := map[*rlwe.EvaluationKey]int{}
+	for i, key := range keys {
+		if o, ok := written[key.evk]; ok {
+			offsets[i] = o
+			continue
+		}
+		offsets[i], written[key.evk] = offset, offset
+		offset = alignPage(offset + mappedKeySize(key.evk))
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	w := bufio.NewWriterSize(file, 1<<20)
+
+	header := mappedKeyHeader(fp, keys, offsets)
+	if _, err = w.Write(header); err != nil {
+		return err
+	}
+	position := len(header)
+	var b []byte
+	for i, key := range keys {
+		if offsets[i] < position {
+			// Already written
+			continue
+		}
+		if _, err = w.Write(make([]byte, offsets[i]-position)); err != nil {
+			return err
+		}
+		for _, row := range key.evk.Value {
+			for _, vec := range row {
+				for _, poly := range vec {
+					for _, coeffs := range append(poly.Q.Coeffs, poly.P.Coeffs...) {
+						b = b[:0]
+						for _, c := range coeffs {
+							b = binary.LittleEndian.AppendUint64(b, c)
+						}
+						if _, err = w.Write(b); err != nil {
+							return err
+						}
+					}
+				}
+			}
+		}
+		position = offsets[i] + mappedKeySize(key.evk)
+	}
+	if _, err = w.Write(make([]byte, alignPage(position)-position)); err != nil {
+		return err
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// hostLittleEndian is true if uint64 are stored little-endian in memory, in which
+// case the coefficients of mapped key files are used in place.
+var hostLittleEndian = func() bool {
+	v := uint64(1)
+	return *(*byte)(unsafe.Pointer(&v)) == 1
+}()
+
+// parseMappedKeys returns the keys of the mapped key file data, which must be stamped
+// with fp. Their polynomials point into data, which must outlive them and must not be
+// written to.
+func parseMappedKeys(path string, data []byte, fp Fingerprint) ([]mappedKey, error) {
+	pos := 0
+	truncated := fmt.Errorf("%s: truncated mapped key file", path)
+	readUint64 := func() (v uint64, err error) {
+		if len(data)-pos < 8 {
+			return 0, truncated
+		}
+		v = binary.LittleEndian.Uint64(data[pos:])
+		pos += 8
+		return v, nil
+	}
+
+	if !bytes.HasPrefix(data, []byte(mappedKeyMagic)) {
+		return nil, fmt.Errorf("%s: not a mapped key file", path)
+	}
+	pos = len(mappedKeyMagic)
+	if len(data)-pos < len(fp) {
+		return nil, truncated
+	}
+	var stamped Fingerprint
+	pos += copy(stamped[:], data[pos:])
+	if stamped != fp {
+		return nil, fmt.Errorf("%w: %s was made under parameters %s, expected %s", ErrFingerprintMismatch, path, stamped, fp)
+	}
+
+	count, err := readUint64()
+	if err != nil {
+		return nil, err
+	}
+	var keys []mappedKey
+	parsed := map[uint64]*rlwe.EvaluationKey{}
+	for k := uint64(0); k < count; k++ {
+		nameLen, err := readUint64()
+		if err != nil {
+			return nil, err
+		}
+		if uint64(len(data)-pos) < nameLen {
+			return nil, truncated
+		}
+		key := mappedKey{name: string(data[pos : pos+int(nameLen)])}
+		pos += int(nameLen)
+
+		// GaloisElement, NthRoot, BaseTwoDecomposition, N, levelQ+1, levelP+1
+		var fields [6]uint64
+		for i := range fields {
+			if fields[i], err = readUint64(); err != nil {
+				return nil, err
+			}
+		}
+		key.galoisElement, key.nthRoot = fields[0], fields[1]
+		base2, N, qCount, pCount := int(fields[2]), int(fields[3]), int(fields[4]), int(fields[5])
+
+		rows, err := readUint64()
+		if err != nil {
+			return nil, err
+		}
+		if rows > uint64(len(data)) {
+			return nil, truncated
+		}
+		cols := make([]int, rows)
+		for i := range cols {
+			c, err := readUint64()
+			if err != nil {
+				return nil, err
+			}
+			if c > uint64(len(data)) {
+				return nil, truncated
+			}
+			cols[i] = int(c)
+		}
+		offset, err := readUint64()
+		if err != nil {
+			return nil, err
+		}
+
+		if evk, ok := parsed[offset]; ok {
+			key.evk = evk
+			keys = append(keys, key)
+			continue
+		}
+		// Bounds well above any ring degree and modulus count, which keep the sizes from overflowing
+		if offset%mappedPageSize != 0 || rows == 0 || N <= 0 || N > 1<<20 || qCount <= 0 || pCount < 0 || qCount+pCount > 1<<12 {
+			return nil, fmt.Errorf("%s: invalid descriptor of key %s", path, key.name)
+		}
+		if offset > uint64(len(data)) {
+			return nil, truncated
+		}
+		available := uint64(len(data)) - offset
+		polySize := uint64(2 * (qCount + pCount) * N * 8)
+		for _, c := range cols {
+			if c == 0 || uint64(c) > available/polySize {
+				return nil, fmt.Errorf("%s: invalid descriptor of key %s", path, key.name)
+			}
+			available -= uint64(c) * polySize
+		}
+		key.evk = &rlwe.EvaluationKey{GadgetCiphertext: rlwe.GadgetCiphertext{BaseTwoDecomposition: base2}}
+
+		coeffs := data[offset:]
+		poly := func(moduli int) ring.Poly {
+			p := ring.Poly{Coeffs: make([][]uint64, moduli)}
+			for i := range p.Coeffs {
+				if hostLittleEndian {
+					p.Coeffs[i] = unsafe.Slice((*uint64)(unsafe.Pointer(&coeffs[0])), N)
+				} else {
+					p.Coeffs[i] = make([]uint64, N)
+					for j := range p.Coeffs[i] {
+						p.Coeffs[i][j] = binary.LittleEndian.Uint64(coeffs[8*j:])
+					}
+				}
+				coeffs = coeffs[8*N:]
+			}
+			return p
+		}
+		key.evk.Value = make(structs.Matrix[rlwe.VectorQP], rows)
+		for i := range key.evk.Value {
+			key.evk.Value[i] = make([]rlwe.VectorQP, cols[i])
+			for j := range key.evk.Value[i] {
+				key.evk.Value[i][j] = rlwe.VectorQP{
+					ringqp.Poly{Q: poly(qCount), P: poly(pCount)},
+					ringqp.Poly{Q: poly(qCount), P: poly(pCount)},
+				}
+			}
+		}
+		parsed[offset] = key.evk
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// galoisKey returns key as a galois key.
+func (key mappedKey) galoisKey() *rlwe.GaloisKey {
+	return &rlwe.GaloisKey{GaloisElement: key.galoisElement, NthRoot: key.nthRoot, EvaluationKey: *key.evk}
+}
+
+// mappedGaloisKeys returns galks as the keys of a mapped key file, named prefix.
+func mappedGaloisKeys(prefix string, galks []*rlwe.GaloisKey) []mappedKey {
+	keys := make([]mappedKey, len(galks))
+	for i, galk := range galks {
+		keys[i] = mappedKey{name: prefix, galoisElement: galk.GaloisElement, nthRoot: galk.NthRoot, evk: &galk.EvaluationKey}
+	}
+	return keys
+}
+
+// galoisKeysFromMapped returns the galois keys named prefix of the mapped key file at path.
+// Keys mapped from the same offset are the same galois key.
+func galoisKeysFromMapped(path, prefix string, keys []mappedKey) ([]*rlwe.GaloisKey, error) {
+	galks := make([]*rlwe.GaloisKey, len(keys))
+	seen := map[*rlwe.EvaluationKey]*rlwe.GaloisKey{}
+	for i, key := range keys {
+		if key.name != prefix {
+			return nil, fmt.Errorf("%s: unexpected key %s", path, key.name)
+		}
+		if galks[i] = seen[key.evk]; galks[i] == nil {
+			galks[i] = key.galoisKey()
+			seen[key.evk] = galks[i]
+		}
+	}
+	return galks, nil
+}
+
+// mappedBtpKeys returns the bootstrapping keys as the keys of a mapped key file: the
+// relinearization key and the galois keys of their MemEvaluationKeySet, named btp_rlk
+// and btp_galk, unless it is shared with the Context, then the other evaluation keys
+// named as their key files.
+func mappedBtpKeys(btpkeys *bootstrapping.EvaluationKeys, shared bool) (keys []mappedKey) {
+	if !shared {
+		if rlk := btpkeys.MemEvaluationKeySet.RelinearizationKey; rlk != nil {
+			keys = append(keys, mappedKey{name: "btp_rlk", evk: &rlk.EvaluationKey})
+		}
+		galks := btpkeys.MemEvaluationKeySet.GaloisKeys
+		for _, galEl := range utils.GetSortedKeys(galks) {
+			keys = append(keys, mappedGaloisKeys("btp_galk", []*rlwe.GaloisKey{galks[galEl]})...)
+		}
+	}
+
+	evks := btpEvaluationKeys(btpkeys)
+	for _, name := range utils.GetSortedKeys(evks) {
+		if evk := *evks[name]; evk != nil {
+			keys = append(keys, mappedKey{name: name, evk: evk})
+		}
+	}
+	return
+}
+
+// btpKeysFromMapped returns the bootstrapping keys of the mapped key file at path,
+// written from mappedBtpKeys, and whether their MemEvaluationKeySet is shared with
+// the Context, i.e. was not written.
+func btpKeysFromMapped(path string, keys []mappedKey) (btpkeys *bootstrapping.EvaluationKeys, shared bool, err error) {
+	btpkeys = &bootstrapping.EvaluationKeys{MemEvaluationKeySet: rlwe.NewMemEvaluationKeySet(nil)}
+	evks := btpEvaluationKeys(btpkeys)
+	shared = true
+	for _, key := range keys {
+		switch evk, ok := evks[key.name]; {
+		case key.name == "btp_rlk":
+			btpkeys.RelinearizationKey = &rlwe.RelinearizationKey{EvaluationKey: *key.evk}
+			shared = false
+		case key.name == "btp_galk":
+			btpkeys.GaloisKeys[key.galoisElement] = key.galoisKey()
+			shared = false
+		case ok:
+			*evk = key.evk
+		default:
+			return nil, false, fmt.Errorf("%s: unexpected key %s", path, key.name)
+		}
+	}
+	return btpkeys, shared, nil
+}
+
+// mapKeys memory-maps the mapped key file at path and returns its keys. The mapping
+// is released by ctx.Close.
+func (ctx *Context) mapKeys(path string) ([]mappedKey, error) {
+	data, unmap, err := mapFile(path)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := parseMappedKeys(path, data, ctx.fingerprint)
+	if err != nil {
+		unmap()
+		return nil, err
+	}
+	ctx.unmaps = append(ctx.unmaps, unmap)
+	return keys, nil
+}
+
+// Close releases the key files memory-mapped by LoadKeys. The keys of ctx must not be
+// used afterwards. Close does nothing if no key file was mapped.
+func (ctx *Context) Close() error {
+	var err error
+	for _, unmap := range ctx.unmaps {
+		if e := unmap(); e != nil && err == nil {
+			err = e
+		}
+	}
+	ctx.unmaps = nil
+	return err
+}
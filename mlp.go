@@ -0,0 +1,309 @@
+package lattigo_key
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/tuneinsight/lattigo/v5/core/rlwe"
+	"github.com/tuneinsight/lattigo/v5/he/hefloat"
+	"github.com/tuneinsight/lattigo/v5/utils"
+	"github.com/tuneinsight/lattigo/v5/utils/bignum"
+)
+
+// MLPTolerance is the maximum absolute error expected between EvaluateMLP and
+// the float64 reference MLP.Evaluate when inputs and intermediate activations
+// stay within [-1, 1], the input range of the bootstrapping circuit.
+const MLPTolerance = 1e-3
+
+// DenseLayer is a fully connected layer computing act(Weights * x + Bias).
+type DenseLayer struct {
+	Weights    [][]float64 `json:"weights"`              // Weights[j][i] connects input i to output j
+	Bias       []float64   `json:"bias"`                 // One bias per output
+	Activation []float64   `json:"activation,omitempty"` // Monomial coefficients of the activation, identity if empty
+}
+
+// MLP is a dense multi-layer perceptron with polynomial activations.
+type MLP struct {
+	Layers []DenseLayer `json:"layers"`
+}
+
+// LoadMLP reads a model from a JSON file of the form
+// {"layers": [{"weights": [[...], ...], "bias": [...], "activation": [c0, c1, ...]}, ...]}.
+func LoadMLP(path string) (*MLP, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	model := new(MLP)
+	if err := json.Unmarshal(data, model); err != nil {
+		return nil, fmt.Errorf("failed to parse model %s: %v", path, err)
+	}
+	if err := model.validate(); err != nil {
+		return nil, err
+	}
+
+	return model, nil
+}
+
+// Save writes the model to path in the format read by LoadMLP.
+func (m *MLP) Save(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// InputSize returns the number of features expected by the first layer.
+func (m *MLP) InputSize() int {
+	return len(m.Layers[0].Weights[0])
+}
+
+// OutputSize returns the number of outputs of the last layer.
+func (m *MLP) OutputSize() int {
+	return len(m.Layers[len(m.Layers)-1].Weights)
+}
+
+// validate checks that the layer dimensions are consistent.
+func (m *MLP) validate() error {
+	if len(m.Layers) == 0 {
+		return fmt.Errorf("model has no layers")
+	}
+
+	in := 0
+	for l, layer := range m.Layers {
+		if len(layer.Weights) == 0 || len(layer.Weights[0]) == 0 {
+			return fmt.Errorf("layer %d has no weights", l)
+		}
+		if l > 0 && len(layer.Weights[0]) != in {
+			return fmt.Errorf("layer %d expects %d inputs but layer %d has %d outputs", l, len(layer.Weights[0]), l-1, in)
+		}
+		for j, row := range layer.Weights {
+			if len(row) != len(layer.Weights[0]) {
+				return fmt.Errorf("layer %d: row %d has %d weights, expected %d", l, j, len(row), len(layer.Weights[0]))
+			}
+		}
+		if len(layer.Activation) == 1 {
+			return fmt.Errorf("layer %d has a constant activation", l)
+		}
+		if len(layer.Bias) != len(layer.Weights) {
+			return fmt.Errorf("layer %d has %d biases for %d outputs", l, len(layer.Bias), len(layer.Weights))
+		}
+		in = len(layer.Weights)
+	}
+
+	return nil
+}
+
+// Evaluate is the float64 reference implementation of the model.
+func (m *MLP) Evaluate(x []float64) []float64 {
+	for _, layer := range m.Layers {
+		y := make([]float64, len(layer.Weights))
+		for j, row := range layer.Weights {
+			y[j] = layer.Bias[j]
+			for i, w := range row {
+				y[j] += w * x[i]
+			}
+			if len(layer.Activation) > 0 {
+				y[j] = evalPoly(layer.Activation, y[j])
+			}
+		}
+		x = y
+	}
+	return x
+}
+
+// evalPoly evaluates the monomial-basis polynomial coeffs at x with Horner's rule.
+func evalPoly(coeffs []float64, x float64) (y float64) {
+	for i := len(coeffs) - 1; i >= 0; i-- {
+		y = y*x + coeffs[i]
+	}
+	return
+}
+
+// MLPOptions are the options of EvaluateMLPWithOptions.
+type MLPOptions struct {
+	// Workers is the number of ciphertexts evaluated at the same time, or GOMAXPROCS
+	// if zero. Each holds an evaluator, and a bootstrapper when it is bootstrapped.
+	Workers int
+}
+
+// EvaluateMLP runs the model on every sample of ctxt and returns the encrypted outputs.
+// Each layer is computed with the diagonal matrix-vector product followed by the
+// polynomial activation. A ciphertext is bootstrapped before a layer whenever it
+// has fewer levels left than the layer consumes.
+func (ctx *Context) EvaluateMLP(model *MLP, ctxt *Ciphertext) (*Ciphertext, error) {
+	return ctx.EvaluateMLPWithOptions(model, ctxt, MLPOptions{})
+}
+
+// EvaluateMLPWithOptions is EvaluateMLP with the options of opts. A panic met on a
+// ciphertext is returned as an error.
+func (ctx *Context) EvaluateMLPWithOptions(model *MLP, ctxt *Ciphertext, opts MLPOptions) (*Ciphertext, error) {
+	if err := model.validate(); err != nil {
+		return nil, err
+	}
+	if err := ctx.CheckCiphertext(ctxt); err != nil {
+		return nil, err
+	}
+	if ctxt.packed || ctxt.interval != 1 {
+		return nil, fmt.Errorf("EvaluateMLP requires one sample per ciphertext with interval 1")
+	}
+	if ctxt.complex {
+		return nil, fmt.Errorf("EvaluateMLP requires real samples, but ciphertext holds complex ones")
+	}
+	if ctxt.size != model.InputSize() {
+		return nil, fmt.Errorf("model expects %d features but ciphertext holds %d", model.InputSize(), ctxt.size)
+	}
+
+	slots := ctx.params.MaxSlots()
+	for l, layer := range model.Layers {
+		if d := largestPowerOfTwoLessThan(utils.Max(len(layer.Weights), len(layer.Weights[0]))); 2*d > slots {
+			return nil, fmt.Errorf("layer %d of dimension %d does not fit in %d slots", l, d, slots)
+		}
+		if depth := mlpLayerDepth(layer); depth > ctx.params.MaxLevel() {
+			return nil, fmt.Errorf("layer %d needs %d levels but parameters only have %d", l, depth, ctx.params.MaxLevel())
+		}
+	}
+
+	numCtxt := len(ctxt.data)
+	out := &Ciphertext{
+		data:        make([]*rlwe.Ciphertext, numCtxt),
+		size:        model.OutputSize(),
+		interval:    1,
+		constVal:    ctxt.constVal,
+		space:       largestPowerOfTwoLessThan(model.OutputSize()),
+		numSamples:  ctxt.numSamples,
+		fingerprint: ctxt.fingerprint,
+	}
+
+	tasks := make([]func() error, numCtxt)
+	for i := range tasks {
+		i := i
+		tasks[i] = func() (err error) {
+			if out.data[i], err = ctx.evaluateMLPSample(model, ctxt.data[i]); err != nil {
+				return fmt.Errorf("sample %d: %v", i, err)
+			}
+			return nil
+		}
+	}
+	if err := runTasks(opts.Workers, tasks); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// mlpLayerDepth returns the number of levels consumed by a layer.
+func mlpLayerDepth(layer DenseLayer) int {
+	depth := 1
+	if len(layer.Activation) > 0 {
+		depth += bignum.NewPolynomial(bignum.Monomial, layer.Activation, nil).Depth()
+	}
+	return depth
+}
+
+func (ctx *Context) evaluateMLPSample(model *MLP, ct *rlwe.Ciphertext) (*rlwe.Ciphertext, error) {
+	var err error
+	for l, layer := range model.Layers {
+		if ct.Level() < mlpLayerDepth(layer) {
+			if l == 0 {
+				return nil, fmt.Errorf("input ciphertext at level %d cannot evaluate layer 0", ct.Level())
+			}
+			if ct, err = ctx.Bootstrap(ct); err != nil {
+				return nil, err
+			}
+		}
+		if ct, err = ctx.evaluateDenseLayer(layer, ct); err != nil {
+			return nil, fmt.Errorf("layer %d: %v", l, err)
+		}
+	}
+	return ct, nil
+}
+
+// evaluateDenseLayer computes act(W * x + b) on a ciphertext holding x in its first slots
+// and zeros elsewhere. The result holds act(W * x + b) in its first slots and zeros elsewhere.
+func (ctx *Context) evaluateDenseLayer(layer DenseLayer, ct *rlwe.Ciphertext) (*rlwe.Ciphertext, error) {
+	eval := ctx.GetEval()
+	defer ctx.PutEval(eval)
+
+	out, in := len(layer.Weights), len(layer.Weights[0])
+	d := largestPowerOfTwoLessThan(utils.Max(out, in))
+
+	// Replicates x once so that rotations by 0 <= r < d read x cyclically in the first d slots.
+	rot, err := ctx.RotationNew(ct, -d)
+	if err != nil {
+		return nil, err
+	}
+	if err = eval.Add(rot, ct, rot); err != nil {
+		return nil, err
+	}
+
+	// Halevi-Shoup diagonal method: W * x = sum_r diag_r(W) * rot(x, r).
+	var acc *rlwe.Ciphertext
+	tmp := hefloat.NewCiphertext(ctx.params, 1, rot.Level())
+	diag := make([]float64, d)
+	for r := 0; r < d; r++ {
+		if r > 0 {
+			if err = ctx.Rotation(rot, 1, rot); err != nil {
+				return nil, err
+			}
+		}
+
+		zero := true
+		for j := 0; j < d; j++ {
+			diag[j] = 0
+			if i := (j + r) % d; j < out && i < in {
+				diag[j] = layer.Weights[j][i]
+			}
+			zero = zero && diag[j] == 0
+		}
+		if zero && r > 0 {
+			continue
+		}
+
+		if acc == nil {
+			if acc, err = eval.MulNew(rot, diag); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err = eval.Mul(rot, diag, tmp); err != nil {
+			return nil, err
+		}
+		if err = eval.Add(acc, tmp, acc); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = eval.Rescale(acc, acc); err != nil {
+		return nil, err
+	}
+	if err = eval.Add(acc, layer.Bias, acc); err != nil {
+		return nil, err
+	}
+
+	if len(layer.Activation) == 0 {
+		return acc, nil
+	}
+
+	poly := bignum.NewPolynomial(bignum.Monomial, layer.Activation, nil)
+	if acc, err = hefloat.NewPolynomialEvaluator(ctx.params, eval).Evaluate(acc, poly, ctx.params.DefaultScale()); err != nil {
+		return nil, err
+	}
+
+	// The activation maps the zero padding to act(0), which is cleared here so that
+	// the next layer's replication reads zeros.
+	if c := layer.Activation[0]; c != 0 {
+		pad := make([]float64, ctx.params.MaxSlots())
+		for j := out; j < len(pad); j++ {
+			pad[j] = -c
+		}
+		if err = eval.Add(acc, pad, acc); err != nil {
+			return nil, err
+		}
+	}
+
+	return acc, nil
+}
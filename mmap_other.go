@@ -0,0 +1,14 @@
+//go:build !unix
+
+package lattigo_key
+
+import "os"
+
+// mapFile reads the file at path, as memory mapping is only implemented on unix.
+func mapFile(path string) ([]byte, func() error, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, func() error { return nil }, nil
+}
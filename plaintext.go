@@ -2,16 +2,45 @@ package lattigo_key
 
 type Plaintext struct {
 	data     [][]float64 	// The actual plaintext data
+	imag     [][]float64 	// The imaginary parts of complex data, nil for real data
 	size     int     		// The size of the data
-	interval int  			// The interval of the data
+	interval int  			// The interval of the data, the number of slots between two values of a sample
 	constVal float64      	// A constant value associated with the data
 	space 	 int     		// The space size of the data
+	packed 	 bool 			// Whether Encrypt packs MaxSlots/space samples per ciphertext
 }
 
 func (p *Plaintext) GetData() [][]float64 {
 	return p.data
 }
 
+// GetComplexData returns the samples as complex values, of imaginary part zero for
+// real samples.
+func (p *Plaintext) GetComplexData() [][]complex128 {
+	data := make([][]complex128, len(p.data))
+	for i, re := range p.data {
+		data[i] = make([]complex128, len(re))
+		for j := range re {
+			if p.imag != nil {
+				data[i][j] = complex(re[j], p.imag[i][j])
+			} else {
+				data[i][j] = complex(re[j], 0)
+			}
+		}
+	}
+	return data
+}
+
+// GetImagData returns the imaginary parts of the samples, or nil for real samples.
+func (p *Plaintext) GetImagData() [][]float64 {
+	return p.imag
+}
+
+// IsComplex returns true if the samples are complex, see NewComplexPlaintext.
+func (p *Plaintext) IsComplex() bool {
+	return p.imag != nil
+}
+
 func NewPlaintext(data [][]float64) *Plaintext {
 	return &Plaintext{
 		data:     data,
@@ -20,4 +49,81 @@ func NewPlaintext(data [][]float64) *Plaintext {
 		constVal: 1,
 		space: 	  largestPowerOfTwoLessThan(len(data[0])),
 	}
-}
\ No newline at end of file
+}
+
+// NewPackedPlaintext is like NewPlaintext, but Encrypt places MaxSlots/(space*interval)
+// samples side by side in each ciphertext, sample k starting at slot k*space*interval.
+func NewPackedPlaintext(data [][]float64) *Plaintext {
+	p := NewPlaintext(data)
+	p.packed = true
+	return p
+}
+
+// NewComplexPlaintext is like NewPlaintext for complex samples, which are encrypted in
+// the complex slots of Standard parameters. The real and imaginary parts of a sample
+// may hold two real vectors, e.g. two samples, which are then encrypted in one ciphertext.
+// ConjugateInvariant parameters, whose slots are real, cannot encrypt complex samples.
+func NewComplexPlaintext(data [][]complex128) *Plaintext {
+	re, im := make([][]float64, len(data)), make([][]float64, len(data))
+	for i, sample := range data {
+		re[i], im[i] = make([]float64, len(sample)), make([]float64, len(sample))
+		for j, v := range sample {
+			re[i][j], im[i][j] = real(v), imag(v)
+		}
+	}
+	p := NewPlaintext(re)
+	p.imag = im
+	return p
+}
+
+// NewPackedComplexPlaintext is NewComplexPlaintext with the layout of NewPackedPlaintext.
+func NewPackedComplexPlaintext(data [][]complex128) *Plaintext {
+	p := NewComplexPlaintext(data)
+	p.packed = true
+	return p
+}
+
+func (p *Plaintext) IsPacked() bool {
+	return p.packed
+}
+
+// packSamples places the samples side by side in a vector of slots values, each in a
+// block of space*interval slots: value j of sample k is at slot (k*space+j)*interval.
+func packSamples(samples [][]float64, space, interval, slots int) []float64 {
+	values := make([]float64, slots)
+	for k, sample := range samples {
+		for j := 0; j < len(sample) && j < space; j++ {
+			values[(k*space+j)*interval] = sample[j]
+		}
+	}
+	return values
+}
+
+// unpackSamples splits packed vectors back into numSamples rows of space values.
+func unpackSamples(packed [][]float64, space, interval, numSamples int) [][]float64 {
+	block := space * interval
+	rows := make([][]float64, 0, numSamples)
+	for _, values := range packed {
+		for k := 0; k+block <= len(values) && len(rows) < numSamples; k += block {
+			if interval == 1 {
+				rows = append(rows, values[k:k+space])
+				continue
+			}
+			row := make([]float64, space)
+			for j := range row {
+				row[j] = values[k+j*interval]
+			}
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+// complexValues returns the complex vector of the real parts re and imaginary parts im.
+func complexValues(re, im []float64) []complex128 {
+	values := make([]complex128, len(re))
+	for j := range re {
+		values[j] = complex(re[j], im[j])
+	}
+	return values
+}
@@ -0,0 +1,241 @@
+package lattigo_key
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/tuneinsight/lattigo/v5/core/rlwe"
+	"github.com/tuneinsight/lattigo/v5/he/hefloat"
+	"github.com/tuneinsight/lattigo/v5/he/hefloat/bootstrapping"
+	"github.com/tuneinsight/lattigo/v5/ring"
+	"github.com/tuneinsight/lattigo/v5/utils"
+)
+
+// ParameterPreset is a named parameter set of the catalog of Preset, with the targets
+// Check holds it to.
+type ParameterPreset struct {
+	Name        string
+	Description string
+
+	// SecurityBits is the security level both rings must reach according to EstimateSecurity.
+	// Zero marks insecure parameters for tests, whose security is not checked.
+	SecurityBits int
+
+	// Precision is the minimum number of bits of precision of fresh encryptions, as
+	// bounded by EncryptionPrecision.
+	Precision float64
+
+	// Depth is the minimum number of levels of the parameters, i.e. of multiplications
+	// between two bootstrappings.
+	Depth int
+
+	config func() ParametersConfig
+}
+
+// presets is the catalog of Preset, sorted by name.
+var presets = []ParameterPreset{
+	{
+		Name:         "fast-depth7",
+		Description:  "depth 7 at N=2^15 for fast evaluation, bootstrapped at N=2^16",
+		SecurityBits: 128,
+		Precision:    20,
+		Depth:        7,
+		config: func() ParametersConfig {
+			return ParametersConfig{
+				// The moduli are NTT-friendly for the bootstrapping ring of degree 2^16
+				Params: hefloat.ParametersLiteral{
+					LogN:            15,
+					LogNthRoot:      17,
+					LogQ:            []int{60, 45, 45, 45, 45, 45, 45, 45},
+					LogP:            []int{61, 61},
+					LogDefaultScale: 45,
+					RingType:        ring.Standard,
+				},
+				BtParams: bootstrapping.ParametersLiteral{
+					LogN: utils.Pointy(16),
+					LogP: []int{61, 61, 61, 61},
+				},
+			}
+		},
+	},
+	{
+		Name:         "fast-depth7-real",
+		Description:  "fast-depth7 over real slots: 2^15 ConjugateInvariant slots at N=2^15, bootstrapped at N=2^16",
+		SecurityBits: 128,
+		Precision:    20,
+		Depth:        7,
+		config: func() ParametersConfig {
+			return ParametersConfig{
+				// The NTT of a ConjugateInvariant ring of degree 2^15 is of order 2^17, as for the bootstrapping ring
+				Params: hefloat.ParametersLiteral{
+					LogN:            15,
+					LogQ:            []int{60, 45, 45, 45, 45, 45, 45, 45},
+					LogP:            []int{61, 61},
+					LogDefaultScale: 45,
+					RingType:        ring.ConjugateInvariant,
+				},
+				BtParams: bootstrapping.ParametersLiteral{
+					LogN: utils.Pointy(16),
+					LogP: []int{61, 61, 61, 61},
+				},
+			}
+		},
+	},
+	{
+		Name:        "insecure-n10",
+		Description: "small parameters for tests and demonstrations, NOT secure",
+		Precision:   20,
+		Depth:       5,
+		config: func() ParametersConfig {
+			return ParametersConfig{
+				Params: hefloat.ParametersLiteral{
+					LogN:            10,
+					LogQ:            []int{60, 40, 40, 40, 40, 40},
+					LogP:            []int{61, 61},
+					LogDefaultScale: 40,
+					RingType:        ring.Standard,
+				},
+				// The message ratio is raised to keep the bootstrapping precision of N=2^16
+				BtParams: bootstrapping.ParametersLiteral{
+					LogN:            utils.Pointy(10),
+					LogMessageRatio: utils.Pointy(8 + 16 - 10),
+				},
+			}
+		},
+	},
+	{
+		Name:        "insecure-n10-real",
+		Description: "insecure-n10 over 2^10 real slots, bootstrapped at N=2^11, NOT secure",
+		Precision:   20,
+		Depth:       5,
+		config: func() ParametersConfig {
+			return ParametersConfig{
+				Params: hefloat.ParametersLiteral{
+					LogN:            10,
+					LogQ:            []int{60, 40, 40, 40, 40, 40},
+					LogP:            []int{61, 61},
+					LogDefaultScale: 40,
+					RingType:        ring.ConjugateInvariant,
+				},
+				// ConjugateInvariant parameters are bootstrapped in the Standard ring of twice their degree
+				BtParams: bootstrapping.ParametersLiteral{
+					LogN:            utils.Pointy(11),
+					LogMessageRatio: utils.Pointy(8 + 16 - 11),
+				},
+			}
+		},
+	},
+	{
+		Name:         "n16-bootstrap",
+		Description:  "the N=2^16 bootstrapping parameters of the keys of the HE-CCFD models",
+		SecurityBits: 128,
+		Precision:    15,
+		Depth:        9,
+		config: func() ParametersConfig {
+			params := bootstrapping.N16QP1546H192H32.SchemeParams
+			return ParametersConfig{
+				Params: params,
+				BtParams: bootstrapping.ParametersLiteral{
+					LogN: utils.Pointy(16),
+					LogP: []int{61, 61, 61, 61},
+					Xs:   params.Xs,
+				},
+			}
+		},
+	},
+}
+
+// Presets returns the catalog of parameter presets, sorted by name.
+func Presets() []ParameterPreset {
+	return append([]ParameterPreset(nil), presets...)
+}
+
+// PresetNames returns the names of the parameter presets, sorted.
+func PresetNames() (names []string) {
+	for _, preset := range presets {
+		names = append(names, preset.Name)
+	}
+	return
+}
+
+// Preset returns the parameters of the preset named name, one of PresetNames, once
+// they are checked against the targets of the preset.
+func Preset(name string) (*ParametersConfig, error) {
+	for _, preset := range presets {
+		if preset.Name == name {
+			if err := preset.Check(); err != nil {
+				return nil, err
+			}
+			return preset.Config(), nil
+		}
+	}
+	return nil, fmt.Errorf("unknown parameter preset %q", name)
+}
+
+// Config returns the parameters of the preset.
+func (p ParameterPreset) Config() *ParametersConfig {
+	c := p.config()
+	return &c
+}
+
+// Check returns an error if the parameters of the preset miss its security level,
+// precision or depth.
+func (p ParameterPreset) Check() error {
+	params, btparams, err := p.Config().NewParameters()
+	if err != nil {
+		return fmt.Errorf("preset %s: %w", p.Name, err)
+	}
+
+	if p.SecurityBits > 0 {
+		rings := []struct {
+			name   string
+			params rlwe.Parameters
+		}{
+			{"params", *params.GetRLWEParameters()},
+			{"btparams", *btparams.BootstrappingParameters.GetRLWEParameters()},
+		}
+		for _, r := range rings {
+			bits, err := ringSecurity(r.params)
+			if err != nil {
+				return fmt.Errorf("preset %s: %s: %w", p.Name, r.name, err)
+			}
+			if bits < float64(p.SecurityBits) {
+				return fmt.Errorf("preset %s: %s of LogN %d and LogQP %.1f reach an estimated %.0f bits of security, below the target of %d bits",
+					p.Name, r.name, r.params.LogN(), r.params.LogQP(), bits, p.SecurityBits)
+			}
+		}
+	}
+
+	if precision := EncryptionPrecision(params); precision < p.Precision {
+		return fmt.Errorf("preset %s: fresh encryptions have %.1f bits of precision, below the target of %.1f", p.Name, precision, p.Precision)
+	}
+	if params.MaxLevel() < p.Depth {
+		return fmt.Errorf("preset %s: parameters have %d levels, below the target depth of %d", p.Name, params.MaxLevel(), p.Depth)
+	}
+	return nil
+}
+
+// EncryptionPrecision returns a lower bound on the number of bits of precision of the
+// values of a fresh public key encryption under params, log2 of the default scale over
+// the bound 8*sqrt(2)*sigma*N + 6*sigma*sqrt(N) + 16*sigma*sqrt(h*N) of the encryption
+// error of the CKKS paper, where sigma is the standard deviation of the error and h the
+// Hamming weight of the secret.
+func EncryptionPrecision(params hefloat.Parameters) float64 {
+	N := float64(params.N())
+
+	sigma := rlwe.DefaultNoise
+	if xe, ok := params.Xe().(ring.DiscreteGaussian); ok {
+		sigma = xe.Sigma
+	}
+	h := N
+	if xs, ok := params.Xs().(ring.Ternary); ok {
+		if xs.H > 0 {
+			h = float64(xs.H)
+		} else {
+			h = xs.P * N
+		}
+	}
+
+	bound := 8*math.Sqrt2*sigma*N + 6*sigma*math.Sqrt(N) + 16*sigma*math.Sqrt(h*N)
+	return float64(params.LogDefaultScale()) - math.Log2(bound)
+}
@@ -0,0 +1,128 @@
+package lattigo_key
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/tuneinsight/lattigo/v5/core/rlwe"
+)
+
+// AddRotations generates the galois keys of the rotations rots that ctx does not
+// have yet, with the secret key of ctx, and rebuilds the evaluator and its pool
+// with them. Existing keys and ciphertexts stay valid. AddRotations must not be
+// called while ctx is evaluating.
+func (ctx *Context) AddRotations(rots []int) error {
+	_, err := ctx.addRotations(rots)
+	return err
+}
+
+// AddRotationsToDir adds the rotations rots to ctx as AddRotations does and saves
+// the new galois keys, and only them, into dirPath, which must hold the keys of ctx
+// as written by SaveKeys. New keys are appended to galks with opts; a galks.mkeys
+// file is rewritten instead, as its layout cannot be appended to.
+func (ctx *Context) AddRotationsToDir(dirPath string, rots []int, opts SaveOptions) error {
+	mappedPath := dirPath + "/" + mappedGaloisKeysFile
+	_, err := os.Stat(mappedPath)
+	mapped := err == nil
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if !mapped {
+		count, err := countGaloisKeyFiles(dirPath)
+		if err != nil {
+			return err
+		}
+		if count != len(ctx.galKs) {
+			return fmt.Errorf("%s holds %d galois keys, the context has %d", dirPath, count, len(ctx.galKs))
+		}
+	}
+
+	first := len(ctx.galKs)
+	added, err := ctx.addRotations(rots)
+	if err != nil || len(added) == 0 {
+		return err
+	}
+
+	if mapped {
+		// The keys of ctx may point into the current file, which is kept until they are unmapped
+		tmpPath := mappedPath + ".tmp"
+		if err := writeMappedKeys(tmpPath, ctx.fingerprint, mappedGaloisKeys("galk", ctx.galKs)); err != nil {
+			os.Remove(tmpPath)
+			return err
+		}
+		return os.Rename(tmpPath, mappedPath)
+	}
+
+	for i, galk := range added {
+		name := galoisKeyFileName(first + i)
+		var galkBytes []byte
+		if opts.SeedCompressed {
+			galkBytes, err = ctx.marshalSeededGaloisKey("galk", galk)
+		} else {
+			galkBytes, err = galk.MarshalBinary()
+		}
+		if err != nil {
+			return err
+		}
+		if err := writeKeyFile(dirPath+"/"+name, ctx.fingerprint, opts.codec(name), galkBytes); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("Successfully saved %d galois keys\n", len(added))
+
+	return nil
+}
+
+// addRotations generates the missing galois keys of rots, appends them to ctx.galKs,
+// and to the bootstrapping keys if they are shared, and returns them.
+func (ctx *Context) addRotations(rots []int) (added []*rlwe.GaloisKey, err error) {
+	if ctx.sk == nil {
+		return nil, fmt.Errorf("cannot generate galois keys without the secret key")
+	}
+	if ctx.params.PCount() == 0 {
+		return nil, fmt.Errorf("cannot generate galois keys for parameters without auxiliary moduli")
+	}
+
+	have := map[uint64]bool{}
+	for _, galk := range ctx.galKs {
+		have[galk.GaloisElement] = true
+	}
+
+	genGaloisKey := ctx.galoisKeyGenerator()
+	for _, galEl := range ctx.params.GaloisElements(rots) {
+		if have[galEl] {
+			continue
+		}
+		have[galEl] = true
+
+		galk := genGaloisKey(galEl)
+		added = append(added, galk)
+		ctx.galKs = append(ctx.galKs, galk)
+		if ctx.sharedKeys && ctx.btpkeys != nil {
+			ctx.btpkeys.GaloisKeys[galEl] = galk
+		}
+	}
+
+	if len(added) != 0 {
+		ctx.setEvaluator()
+	}
+	return added, nil
+}
+
+// galoisKeyGenerator returns a function generating the galois key of a Galois element
+// for the evaluator of ctx, with a recorded seed. The keys are generated under the
+// parameters of the evaluator, with the secret key extended to them if they are the
+// bootstrapping parameters. ctx must have its secret key.
+func (ctx *Context) galoisKeyGenerator() func(galEl uint64) *rlwe.GaloisKey {
+	params := ctx.evalParams()
+	sk := ctx.sk
+	if ctx.sharedKeys {
+		sk = extendSecretKey(ctx.sk, params)
+	}
+	kgen := rlwe.NewKeyGenerator(params)
+
+	return func(galEl uint64) *rlwe.GaloisKey {
+		return ctx.uniformKeyGenerator(kgen, galoisKeySeedName("galk", galEl)).GenGaloisKeyNew(galEl, sk)
+	}
+}
@@ -2,17 +2,98 @@ package lattigo_key
 
 import (
 	"fmt"
+	"io"
 	"os"
-	"reflect"
+	"strings"
 	"sync"
-	"unsafe"
 
 	"github.com/tuneinsight/lattigo/v5/core/rlwe"
 	"github.com/tuneinsight/lattigo/v5/he/hefloat"
 	"github.com/tuneinsight/lattigo/v5/he/hefloat/bootstrapping"
 )
 
+// SaveOptions selects how SaveKeysWithOptions writes the keys.
+type SaveOptions struct {
+	// SeedCompressed writes the public, relinearization, galois and bootstrapping
+	// keys as their b components and the seed of their uniform a components, which
+	// roughly halves the directory. LoadKeys expands them back.
+	SeedCompressed bool
+
+	// Codec compresses every artifact that has no codec in ArtifactCodecs.
+	Codec Codec
+
+	// ArtifactCodecs selects the codec of an artifact by its path relative to the
+	// directory, e.g. "sk.key" or "galks/galk_0.key", or of all the artifacts of a
+	// subdirectory, e.g. "galks/".
+	ArtifactCodecs map[string]Codec
+
+	// MemoryMapped writes the galois keys and the bootstrapping keys to the
+	// page-aligned galks.mkeys and btp.mkeys files instead, which LoadKeys maps
+	// into memory rather than reads. These files are never compressed.
+	MemoryMapped bool
+
+	// Workers is the number of artifacts serialized and written at the same time,
+	// GOMAXPROCS if it is zero or negative.
+	Workers int
+
+	// EvaluationOnly leaves out sk.key and test_ctxt, so that the directory can be
+	// handed to a server that evaluates on ciphertexts but cannot decrypt them.
+	// LoadKeys loads it as a Context without secret key.
+	EvaluationOnly bool
+}
+
+// codec returns the codec of the artifact at path name relative to the directory.
+func (opts SaveOptions) codec(name string) Codec {
+	if codec, ok := opts.ArtifactCodecs[name]; ok {
+		return codec
+	}
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		if codec, ok := opts.ArtifactCodecs[name[:i+1]]; ok {
+			return codec
+		}
+	}
+	return opts.Codec
+}
+
+// writeArtifactFile writes data to path, compressed with codec.
+func writeArtifactFile(path string, codec Codec, data []byte) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err = writeCompressed(file, codec, data); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// readArtifactFile reads a file written by writeArtifactFile.
+func readArtifactFile(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	r, err := NewDecompressReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
 func (ctx *Context) SaveKeys(dirPath string) error {
+	return ctx.SaveKeysWithOptions(dirPath, SaveOptions{})
+}
+
+func (ctx *Context) SaveKeysWithOptions(dirPath string, opts SaveOptions) error {
+	if ctx.sk == nil && !opts.EvaluationOnly {
+		return fmt.Errorf("context has no secret key and can only be saved with EvaluationOnly")
+	}
+
 	// 기존 폴더 삭제 및 재생성
 	if _, err := os.Stat(dirPath); err == nil {
         err = os.RemoveAll(dirPath)
@@ -29,261 +110,446 @@ func (ctx *Context) SaveKeys(dirPath string) error {
 		return fmt.Errorf("failed to create directory: %v", err)
 	}
 
-	// Parameters 저장
-	paramFile, err := os.Create(dirPath + "/params")
-    if err != nil {
-        return err
-    }
-    defer paramFile.Close()
-    paramBytes, err := ctx.params.MarshalBinary()
-    if err != nil {
-        return err
-    }
-    paramFile.Write(paramBytes)
-	fmt.Println("Successfully saved parameters")
-
-	btparamFile, err := os.Create(dirPath + "/btparams")
-	if err != nil {
-		return err
+	// 각 artifact는 opts.Workers개씩 동시에 저장하고, 모두 저장된 후 순서대로 출력
+	var tasks []func() error
+	var messages []string
+	saveArtifact := func(name string, marshal func() ([]byte, error)) {
+		tasks = append(tasks, func() error {
+			data, err := marshal()
+			if err != nil {
+				return err
+			}
+			return writeArtifactFile(dirPath+"/"+name, opts.codec(name), data)
+		})
 	}
-	defer btparamFile.Close()
-	btparamBytes, err := ctx.btparams.MarshalBinary()
-	if err != nil {
-		return err
+	saveKey := func(name string, marshal func() ([]byte, error)) {
+		tasks = append(tasks, func() error {
+			data, err := marshal()
+			if err != nil {
+				return err
+			}
+			return writeKeyFile(dirPath+"/"+name, ctx.fingerprint, opts.codec(name), data)
+		})
 	}
-	btparamFile.Write(btparamBytes)
-	fmt.Println("Successfully saved bootstrapping parameters")
+
+	// Parameters 저장
+	saveArtifact("params", ctx.params.MarshalBinary)
+	messages = append(messages, "Successfully saved parameters")
+
+	saveArtifact("btparams", ctx.btparams.MarshalBinary)
+	messages = append(messages, "Successfully saved bootstrapping parameters")
 
 	// SecretKey 저장
-    skFile, err := os.Create(dirPath + "/sk.key")
-    if err != nil {
-        return err
-    }
-    defer skFile.Close()
-    skBytes, err := ctx.sk.MarshalBinary()
-    if err != nil {
-        return err
-    }
-    skFile.Write(skBytes)
-	fmt.Println("Successfully saved secret key")
+	if !opts.EvaluationOnly {
+		saveKey("sk.key", ctx.sk.MarshalBinary)
+		messages = append(messages, "Successfully saved secret key")
+	}
 
     // PublicKey 저장
-    pkFile, err := os.Create(dirPath + "/pk.key")
-    if err != nil {
-        return err
-    }
-    defer pkFile.Close()
-    pkBytes, err := ctx.pk.MarshalBinary()
-    if err != nil {
-        return err
-    }
-    pkFile.Write(pkBytes)
-	fmt.Println("Successfully saved public key")
+	saveKey("pk.key", func() ([]byte, error) {
+		if opts.SeedCompressed {
+			return ctx.marshalSeededPublicKey(ctx.pk)
+		}
+		return ctx.pk.MarshalBinary()
+	})
+	messages = append(messages, "Successfully saved public key")
 
     // RelinearizationKey 저장
-    rlkFile, err := os.Create(dirPath + "/rlk.key")
-    if err != nil {
-        return err
-    }
-    defer rlkFile.Close()
-    rlkBytes, err := ctx.rlk.MarshalBinary()
-    if err != nil {
-        return err
-    }
-    rlkFile.Write(rlkBytes)
-	fmt.Println("Successfully saved relinearization key")
+	saveKey("rlk.key", func() ([]byte, error) {
+		if opts.SeedCompressed {
+			return ctx.marshalSeededEvaluationKey("rlk", &ctx.rlk.EvaluationKey)
+		}
+		return ctx.rlk.MarshalBinary()
+	})
+	messages = append(messages, "Successfully saved relinearization key")
 
     // GaloisKeys 저장
-    for i, galk := range ctx.galKs {
-        galkFile, err := os.Create(fmt.Sprintf("%s/galks/galk_%d.key", dirPath, i))
-        if err != nil {
-            return err
-        }
-        defer galkFile.Close()
-        galkBytes, err := galk.MarshalBinary()
-        if err != nil {
-            return err
-        }
-        galkFile.Write(galkBytes)
-    }
-	fmt.Println("Successfully saved galois keys")
+	if opts.MemoryMapped {
+		tasks = append(tasks, func() error {
+			return writeMappedKeys(dirPath+"/"+mappedGaloisKeysFile, ctx.fingerprint, mappedGaloisKeys("galk", ctx.galKs))
+		})
+	} else {
+		for i, galk := range ctx.galKs {
+			galk := galk
+			saveKey(galoisKeyFileName(i), func() ([]byte, error) {
+				if opts.SeedCompressed {
+					return ctx.marshalSeededGaloisKey("galk", galk)
+				}
+				return galk.MarshalBinary()
+			})
+		}
+	}
+	messages = append(messages, "Successfully saved galois keys")
 
     // Bootstrapping Evaluation Key 저장
-    btpFile, err := os.Create(dirPath + "/btp.key")
-    if err != nil {
-        return err
-    }
-    defer btpFile.Close()
-    btBytes, err := ctx.btpkeys.MarshalBinary()
-    if err != nil {
-        return err
-    }
-    btpFile.Write(btBytes)
+	if opts.MemoryMapped {
+		tasks = append(tasks, func() error {
+			return writeMappedKeys(dirPath+"/"+mappedBtpKeysFile, ctx.fingerprint, mappedBtpKeys(ctx.btpkeys, ctx.sharedKeys))
+		})
+		messages = append(messages, "Successfully saved bootstrapping evaluation keys")
+	} else {
+		// bootstrapping key와 공유하는 경우 MemEvaluationKeySet은 rlk.key와 galks에 이미 저장됨
+		if !ctx.sharedKeys {
+			// btp.key는 btp_memset.key와 같은 내용이므로 압축 시에는 저장하지 않음
+			if !opts.SeedCompressed {
+				saveKey("btp.key", ctx.btpkeys.MarshalBinary)
+			}
 
-	btpMemSetFile, err := os.Create(dirPath + "/btp_memset.key")
-	if err != nil {
-		return err
-	}
-	defer btpMemSetFile.Close()
-	btpMemSetBytes, err := ctx.btpkeys.MemEvaluationKeySet.MarshalBinary()
-	if err != nil {
-		return err
+			saveKey("btp_memset.key", func() ([]byte, error) {
+				if opts.SeedCompressed {
+					return ctx.marshalSeededKeySet("btp", ctx.btpkeys.MemEvaluationKeySet)
+				}
+				return ctx.btpkeys.MemEvaluationKeySet.MarshalBinary()
+			})
+		}
+
+		// MemEvaluationKeySet에 포함되지 않는 bootstrapping evaluation key 저장
+		for name, evk := range btpEvaluationKeys(ctx.btpkeys) {
+			name, evk := name, *evk
+			if evk == nil {
+				continue
+			}
+			saveKey(name+".key", func() ([]byte, error) {
+				if opts.SeedCompressed {
+					return ctx.marshalSeededEvaluationKey(name, evk)
+				}
+				return evk.MarshalBinary()
+			})
+		}
+		messages = append(messages, "Successfully saved bootstrapping evaluation keys")
 	}
-	btpMemSetFile.Write(btpMemSetBytes)
-	fmt.Println("Successfully saved bootstrapping evaluation keys")
 
 	// 암호문 생성 및 저장
-    values := []float64{1.0, 2.0, 3.0, 4.0, 5.0}
-    ptxt := hefloat.NewPlaintext(ctx.params, ctx.params.MaxLevel())
-    ctx.ecd.Encode(values, ptxt)
-    ctxt, err := ctx.enc.EncryptNew(ptxt)
-    if err != nil {
-        return err
-    }
-    
-    ctxtBytes, err := ctxt.MarshalBinary()
-    if err != nil {
-        return err
-    }
-    err = os.WriteFile(dirPath+"/test_ctxt", ctxtBytes, 0644)
-    if err != nil {
-        return err
-    }
+	if !opts.EvaluationOnly {
+		saveKey("test_ctxt", func() ([]byte, error) {
+			values := []float64{1.0, 2.0, 3.0, 4.0, 5.0}
+			ptxt := hefloat.NewPlaintext(ctx.params, ctx.params.MaxLevel())
+			ctx.ecd.Encode(values, ptxt)
+			ctxt, err := ctx.enc.EncryptNew(ptxt)
+			if err != nil {
+				return nil, err
+			}
+			return ctxt.MarshalBinary()
+		})
+	}
+
+	if err := runTasks(opts.Workers, tasks); err != nil {
+		return err
+	}
+	for _, msg := range messages {
+		fmt.Println(msg)
+	}
 
     return nil
 }
 
+// btpEvaluationKeys maps the file names of the bootstrapping evaluation keys
+// that are not part of their MemEvaluationKeySet to the keys.
+func btpEvaluationKeys(btpkeys *bootstrapping.EvaluationKeys) map[string]**rlwe.EvaluationKey {
+	return map[string]**rlwe.EvaluationKey{
+		"btp_n1_to_n2": 		&btpkeys.EvkN1ToN2,
+		"btp_n2_to_n1": 		&btpkeys.EvkN2ToN1,
+		"btp_real_to_cmplx": 	&btpkeys.EvkRealToCmplx,
+		"btp_cmplx_to_real": 	&btpkeys.EvkCmplxToReal,
+		"btp_dense_to_sparse": 	&btpkeys.EvkDenseToSparse,
+		"btp_sparse_to_dense": 	&btpkeys.EvkSparseToDense,
+	}
+}
+
+// LoadOptions selects how LoadKeysWithOptions reads the keys.
+type LoadOptions struct {
+	// Workers is the number of key files read and decoded at the same time,
+	// GOMAXPROCS if it is zero or negative.
+	Workers int
+
+	// SkipValidation skips the check of a sample of the keys against the secret key
+	// and the decryption of test_ctxt, e.g. to run a complete Validate instead.
+	SkipValidation bool
+
+	// Legacy reads the key files written before fingerprints were introduced, which have
+	// no fingerprint header and whose parameters are therefore not checked. The files of
+	// SaveKeys are refused without header otherwise.
+	Legacy bool
+}
+
+// countGaloisKeyFiles returns the number of consecutive galois key files from galk_0.key in dirPath.
+func countGaloisKeyFiles(dirPath string) (int, error) {
+	count := 0
+	for {
+		_, err := os.Stat(dirPath + "/" + galoisKeyFileName(count))
+		if os.IsNotExist(err) {
+			return count, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		count++
+	}
+}
+
+// LoadParameters reads the parameters and the bootstrapping parameters of the keys
+// saved in dirPath, without reading the keys.
+func LoadParameters(dirPath string) (params hefloat.Parameters, btparams bootstrapping.Parameters, err error) {
+	paramBytes, err := readArtifactFile(dirPath + "/params")
+	if err != nil {
+		return params, btparams, err
+	}
+	if err = params.UnmarshalBinary(paramBytes); err != nil {
+		return params, btparams, err
+	}
+
+	btparamBytes, err := readArtifactFile(dirPath + "/btparams")
+	if err != nil {
+		return params, btparams, err
+	}
+	if err = btparams.UnmarshalBinary(btparamBytes); err != nil {
+		return params, btparams, err
+	}
+	return params, btparams, nil
+}
+
 func LoadKeys(dirPath string) (*Context, error) {
-    ctx := &Context{}
+	return LoadKeysWithOptions(dirPath, LoadOptions{})
+}
 
-    // Parameters 로드
-    paramBytes, err := os.ReadFile(dirPath + "/params")
-    if err != nil {
-        return nil, err
-    }
-    ctx.params = hefloat.Parameters{}
-    if err := ctx.params.UnmarshalBinary(paramBytes); err != nil {
-        return nil, err
-    }
+func LoadKeysWithOptions(dirPath string, opts LoadOptions) (*Context, error) {
+    ctx := &Context{keySeeds: map[string][]byte{}}
+
+	// 로드에 실패하면 memory-map한 키 파일 해제
+	loaded := false
+	defer func() {
+		if !loaded {
+			ctx.Close()
+		}
+	}()
+
+    // Parameters, Bootstrapping Parameters 로드
+	var err error
+	if ctx.params, ctx.btparams, err = LoadParameters(dirPath); err != nil {
+		return nil, err
+	}
 	fmt.Println("Successfully loaded parameters")
+	fmt.Println("Successfully loaded bootstrapping parameters")
 
-	// Bootstrapping Parameters 로드
-	btparamBytes, err := os.ReadFile(dirPath + "/btparams")
-	if err != nil {
+	if ctx.fingerprint, err = NewFingerprint(ctx.params, ctx.btparams); err != nil {
 		return nil, err
 	}
-	ctx.btparams = bootstrapping.Parameters{}
-	if err := ctx.btparams.UnmarshalBinary(btparamBytes); err != nil {
+
+	// btp_memset.key가 없거나 btp.mkeys에 MemEvaluationKeySet이 없으면
+	// rlk.key와 galks가 bootstrapping parameter로 생성되어 bootstrapping key를 겸함
+	if _, err := os.Stat(dirPath + "/" + mappedBtpKeysFile); err == nil {
+		keys, err := ctx.mapKeys(dirPath + "/" + mappedBtpKeysFile)
+		if err != nil {
+			return nil, err
+		}
+		if ctx.btpkeys, ctx.sharedKeys, err = btpKeysFromMapped(dirPath+"/"+mappedBtpKeysFile, keys); err != nil {
+			return nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	} else if _, err := os.Stat(dirPath + "/btp_memset.key"); os.IsNotExist(err) {
+		ctx.sharedKeys = true
+	} else if err != nil {
+		return nil, err
+	}
+	if ctx.sharedKeys && !sharedEvaluationKeys(ctx.params, ctx.btparams) {
+		return nil, fmt.Errorf("%s: btp_memset.key is missing and the keys of the parameters cannot be shared with the bootstrapping keys", dirPath)
+	}
+
+	// 키 파일은 opts.Workers개씩 동시에 로드하고, 모두 로드된 후 순서대로 출력
+	var tasks []func() error
+	var messages []string
+
+	// sk.key가 없으면 SaveOptions.EvaluationOnly로 저장된 evaluation 전용 키
+	evaluationOnly := false
+	if _, err := os.Stat(dirPath + "/sk.key"); os.IsNotExist(err) {
+		evaluationOnly = true
+	} else if err != nil {
 		return nil, err
 	}
-	fmt.Println("Successfully loaded bootstrapping parameters")
 
     // SecretKey 로드
-    skBytes, err := os.ReadFile(dirPath + "/sk.key")
-    if err != nil {
-        return nil, err
-    }
-    ctx.sk = new(rlwe.SecretKey)
-    if err := ctx.sk.UnmarshalBinary(skBytes); err != nil {
-        return nil, err
-    }
-	fmt.Println("Successfully loaded secret key")
+	if !evaluationOnly {
+		tasks = append(tasks, func() error {
+			skBytes, err := readKeyFile(dirPath+"/sk.key", ctx.fingerprint, opts.Legacy)
+			if err != nil {
+				return err
+			}
+			ctx.sk = new(rlwe.SecretKey)
+			return ctx.sk.UnmarshalBinary(skBytes)
+		})
+		messages = append(messages, "Successfully loaded secret key")
+	}
 
     // PublicKey 로드
-    pkBytes, err := os.ReadFile(dirPath + "/pk.key")
-    if err != nil {
-        return nil, err
-    }
-    ctx.pk = new(rlwe.PublicKey)
-    if err := ctx.pk.UnmarshalBinary(pkBytes); err != nil {
-        return nil, err
-    }
-	fmt.Println("Successfully loaded public key")
+	tasks = append(tasks, func() error {
+		pkBytes, err := readKeyFile(dirPath+"/pk.key", ctx.fingerprint, opts.Legacy)
+		if err != nil {
+			return err
+		}
+		if isSeededKey(pkBytes) {
+			if ctx.pk, err = ctx.unmarshalSeededPublicKey(pkBytes); err != nil {
+				return fmt.Errorf("pk.key: %w", err)
+			}
+			return nil
+		}
+		ctx.pk = new(rlwe.PublicKey)
+		return ctx.pk.UnmarshalBinary(pkBytes)
+	})
+	messages = append(messages, "Successfully loaded public key")
 
     // RelinearizationKey 로드
-    rlkBytes, err := os.ReadFile(dirPath + "/rlk.key")
-    if err != nil {
-        return nil, err
-    }
-    ctx.rlk = new(rlwe.RelinearizationKey)
-    if err := ctx.rlk.UnmarshalBinary(rlkBytes); err != nil {
-        return nil, err
-    }
-	fmt.Println("Successfully loaded relinearization key")
-
-    // GaloisKeys 로드
-    i := 0
-    for {
-        galkBytes, err := os.ReadFile(fmt.Sprintf("%s/galks/galk_%d.key", dirPath, i))
-        if os.IsNotExist(err) {
-            break
-        }
-        if err != nil {
-            return nil, err
-        }
-        galk := new(rlwe.GaloisKey)
-        if err := galk.UnmarshalBinary(galkBytes); err != nil {
-            return nil, err
-        }
-        ctx.galKs = append(ctx.galKs, galk)
-        i++
-    }
-	fmt.Println("Successfully loaded galois keys")
-
-    // Bootstrapping Evaluation Key 로드
-	btMemSetBytes, err := os.ReadFile(dirPath + "/btp_memset.key")
-	if err != nil {
+	tasks = append(tasks, func() error {
+		rlkBytes, err := readKeyFile(dirPath+"/rlk.key", ctx.fingerprint, opts.Legacy)
+		if err != nil {
+			return err
+		}
+		ctx.rlk = new(rlwe.RelinearizationKey)
+		if isSeededKey(rlkBytes) {
+			evk, err := ctx.unmarshalSeededEvaluationKey("rlk", rlkBytes, *ctx.evalParams().GetRLWEParameters())
+			if err != nil {
+				return fmt.Errorf("rlk.key: %w", err)
+			}
+			ctx.rlk.EvaluationKey = *evk
+			return nil
+		}
+		return ctx.rlk.UnmarshalBinary(rlkBytes)
+	})
+	messages = append(messages, "Successfully loaded relinearization key")
+
+    // GaloisKeys 로드: galks.mkeys가 있으면 memory-map, 없으면 galk_0.key부터 연속된 파일
+	if _, err := os.Stat(dirPath + "/" + mappedGaloisKeysFile); err == nil {
+		keys, err := ctx.mapKeys(dirPath + "/" + mappedGaloisKeysFile)
+		if err != nil {
+			return nil, err
+		}
+		if ctx.galKs, err = galoisKeysFromMapped(dirPath+"/"+mappedGaloisKeysFile, "galk", keys); err != nil {
+			return nil, err
+		}
+	} else if !os.IsNotExist(err) {
 		return nil, err
+	} else {
+		galkCount, err := countGaloisKeyFiles(dirPath)
+		if err != nil {
+			return nil, err
+		}
+		ctx.galKs = make([]*rlwe.GaloisKey, galkCount)
+		for i := range ctx.galKs {
+			i := i
+			tasks = append(tasks, func() error {
+				galkBytes, err := readKeyFile(dirPath+"/"+galoisKeyFileName(i), ctx.fingerprint, opts.Legacy)
+				if err != nil {
+					return err
+				}
+				if isSeededKey(galkBytes) {
+					if ctx.galKs[i], err = ctx.unmarshalSeededGaloisKey("galk", galkBytes, *ctx.evalParams().GetRLWEParameters()); err != nil {
+						return fmt.Errorf("%s: %w", galoisKeyFileName(i), err)
+					}
+					return nil
+				}
+				ctx.galKs[i] = new(rlwe.GaloisKey)
+				return ctx.galKs[i].UnmarshalBinary(galkBytes)
+			})
+		}
 	}
-    ctx.btpkeys = new(bootstrapping.EvaluationKeys)
-	ctx.btpkeys.MemEvaluationKeySet = new(rlwe.MemEvaluationKeySet)
-	if err := ctx.btpkeys.MemEvaluationKeySet.UnmarshalBinary(btMemSetBytes); err != nil {
-		return nil, err
+	messages = append(messages, "Successfully loaded galois keys")
+
+    // Bootstrapping Evaluation Key 로드 (btp.mkeys는 위에서 memory-map)
+	if ctx.btpkeys == nil {
+		// btp.key는 btp_memset.key와 나머지 evaluation key 파일을 합친 내용이므로 읽지 않음
+		btpParams := *ctx.btparams.BootstrappingParameters.GetRLWEParameters()
+		ctx.btpkeys = new(bootstrapping.EvaluationKeys)
+		if !ctx.sharedKeys {
+			tasks = append(tasks, func() error {
+				btMemSetBytes, err := readKeyFile(dirPath+"/btp_memset.key", ctx.fingerprint, opts.Legacy)
+				if err != nil {
+					return err
+				}
+				if isSeededKey(btMemSetBytes) {
+					if ctx.btpkeys.MemEvaluationKeySet, err = ctx.unmarshalSeededKeySet("btp", btMemSetBytes, btpParams); err != nil {
+						return fmt.Errorf("btp_memset.key: %w", err)
+					}
+					return nil
+				}
+				ctx.btpkeys.MemEvaluationKeySet = new(rlwe.MemEvaluationKeySet)
+				return ctx.btpkeys.MemEvaluationKeySet.UnmarshalBinary(btMemSetBytes)
+			})
+		}
+
+		for name, evk := range btpEvaluationKeys(ctx.btpkeys) {
+			name, evk := name, evk
+			tasks = append(tasks, func() error {
+				evkBytes, err := readKeyFile(dirPath+"/"+name+".key", ctx.fingerprint, opts.Legacy)
+				if os.IsNotExist(err) {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				if isSeededKey(evkBytes) {
+					if *evk, err = ctx.unmarshalSeededEvaluationKey(name, evkBytes, btpParams); err != nil {
+						return fmt.Errorf("%s.key: %w", name, err)
+					}
+					return nil
+				}
+				*evk = new(rlwe.EvaluationKey)
+				return (*evk).UnmarshalBinary(evkBytes)
+			})
+		}
 	}
+	messages = append(messages, "Successfully loaded bootstrapping evaluation keys")
 
-    btBytes, err := os.ReadFile(dirPath + "/btp.key")
-    if err != nil {
-        return nil, err
-    }
-	ctx.btpkeys.MemEvaluationKeySet = rlwe.NewMemEvaluationKeySet(ctx.rlk, ctx.galKs...)
-	if err := ctx.btpkeys.UnmarshalBinary(btBytes); err != nil {
-        return nil, err
-    }
-	fmt.Println("Successfully loaded bootstrapping evaluation keys")
-
-
-    // 암호문 로드 및 테스트
-    ctxtBytes, err := os.ReadFile(dirPath + "/test_ctxt")
-    if err != nil {
-        return nil, err
-    }
+    // 암호문 로드
     ctxt := new(rlwe.Ciphertext)
-    if err := ctxt.UnmarshalBinary(ctxtBytes); err != nil {
-        return nil, err
-    }
-    
-    ctx.enc = rlwe.NewEncryptor(ctx.params, ctx.pk)
-    ctx.dec = rlwe.NewDecryptor(ctx.params, ctx.sk)
-	ctx.ecd = hefloat.NewEncoder(ctx.params)
-	ctx.eval = hefloat.NewEvaluator(ctx.params, ctx.btpkeys.MemEvaluationKeySet)
-	ctx.evalPool = &sync.Pool{
-		New: func() interface{} {
-			if ctx.eval != nil {
-				return ctx.eval.ShallowCopy()
+	if !evaluationOnly {
+		tasks = append(tasks, func() error {
+			ctxtBytes, err := readKeyFile(dirPath+"/test_ctxt", ctx.fingerprint, opts.Legacy)
+			if err != nil {
+				return err
 			}
-			return nil
-		},
+			return ctxt.UnmarshalBinary(ctxtBytes)
+		})
 	}
 
-	ctx.fillPool()
+	if err := runTasks(opts.Workers, tasks); err != nil {
+		return nil, err
+	}
+	if ctx.sharedKeys {
+		ctx.btpkeys.MemEvaluationKeySet = rlwe.NewMemEvaluationKeySet(ctx.rlk, ctx.galKs...)
+	}
+	for _, msg := range messages {
+		fmt.Println(msg)
+	}
 
-    // 암호문 복호화 테스트
-    ptxt := ctx.dec.DecryptNew(ctxt)
-    values := make([]float64, ctxt.Slots())
-    if err := ctx.ecd.Decode(ptxt, values); err != nil {
-        return nil, err
-    }
-    fmt.Println("Decrypted values:", values[:6])
+    ctx.enc = rlwe.NewEncryptor(ctx.params, ctx.pk)
+	ctx.ecd = hefloat.NewEncoder(ctx.params)
+	ctx.setEvaluator()
+
+	// 비밀키가 없으면 키 일관성 확인과 복호화 테스트를 할 수 없음
+	if !evaluationOnly {
+		ctx.dec = rlwe.NewDecryptor(ctx.params, ctx.sk)
+	}
+	ctx.setEncryptionPools()
+	if !evaluationOnly && !opts.SkipValidation {
+
+		// 키 일관성 확인 (bootstrapping은 Validate로 별도 확인)
+		report, err := ctx.Validate(ValidateOptions{GaloisSamples: 4, SkipBootstrapping: true})
+		if err != nil {
+			return nil, err
+		}
+		if !report.OK() {
+			return nil, fmt.Errorf("%w in %s: %s", ErrInconsistentKeys, dirPath, strings.Join(report.Inconsistent(), ", "))
+		}
+		fmt.Println("Successfully validated keys")
+
+		// 암호문 복호화 테스트
+		ptxt := ctx.dec.DecryptNew(ctxt)
+		values := make([]float64, ctxt.Slots())
+		if err := ctx.ecd.Decode(ptxt, values); err != nil {
+			return nil, err
+		}
+		fmt.Println("Decrypted values:", values[:6])
+	}
 
 	
 	// Bootstrapping test (Error)
@@ -291,6 +557,14 @@ func LoadKeys(dirPath string) (*Context, error) {
 	if err != nil {
 		return nil, err
 	}
+	ctx.btpEvalPool = &sync.Pool{
+		New: func() interface{} {
+			if ctx.btpEval != nil {
+				return ctx.shallowCopyBtpEval()
+			}
+			return nil
+		},
+	}
 
 	// fmt.Println("Bootstrapping test")
 	// btCtxt, err := ctx.btpEval.Bootstrap(ctxt)
@@ -306,16 +580,24 @@ func LoadKeys(dirPath string) (*Context, error) {
 	// }
 	// fmt.Println("Bootstrapped values:", btValues[:6])
 
+	loaded = true
     return ctx, nil
 }
 
 
 func (ctx *Context) PrintKeySizes() {
-	fmt.Printf("params size: %d Bytes\n", unsafe.Sizeof(ctx.params))
-
-	fmt.Printf("sk size: %.2f MB\n", float64(calculateDeepSize(reflect.ValueOf(ctx.sk)))/1048576)
-	fmt.Printf("pk size: %.2f MB\n", float64(calculateDeepSize(reflect.ValueOf(ctx.pk)))/1048576)
-	fmt.Printf("rlk size: %.2f MB\n", float64(calculateDeepSize(reflect.ValueOf(ctx.rlk)))/1048576)
-	fmt.Printf("galks size: %.2f GB\n", float64(calculateDeepSize(reflect.ValueOf(ctx.galKs)))/1073741824)
-	fmt.Printf("btpkeys size: %.2f GB\n", float64(calculateDeepSize(reflect.ValueOf(ctx.btpkeys)))/1073741824)
-}
\ No newline at end of file
+	report, err := ctx.KeySizes()
+	if err != nil {
+		fmt.Println("Failed to compute key sizes:", err)
+		return
+	}
+
+	fmt.Printf("params size: %d Bytes\n", report.Params.DiskBytes)
+	fmt.Printf("btparams size: %d Bytes\n", report.BtParams.DiskBytes)
+	for _, size := range []ArtifactSize{report.SecretKey, report.PublicKey, report.RelinearizationKey} {
+		fmt.Printf("%s size: %.2f MB on disk, %.2f MB in memory\n", size.Name, float64(size.DiskBytes)/1048576, float64(size.MemoryBytes)/1048576)
+	}
+	fmt.Printf("galks size (%d keys): %.2f GB on disk, %.2f GB in memory\n", len(report.GaloisKeys), float64(report.GaloisKeysDiskBytes)/1073741824, float64(report.GaloisKeysMemoryBytes)/1073741824)
+	fmt.Printf("btpkeys size: %.2f GB on disk, %.2f GB in memory\n", float64(report.BootstrappingKeysDiskBytes)/1073741824, float64(report.BootstrappingKeysMemoryBytes)/1073741824)
+	fmt.Printf("total size: %.2f GB on disk, %.2f GB in memory\n", float64(report.TotalDiskBytes)/1073741824, float64(report.TotalMemoryBytes)/1073741824)
+}
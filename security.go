@@ -0,0 +1,145 @@
+package lattigo_key
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/tuneinsight/lattigo/v5/core/rlwe"
+	"github.com/tuneinsight/lattigo/v5/he/hefloat"
+	"github.com/tuneinsight/lattigo/v5/he/hefloat/bootstrapping"
+	"github.com/tuneinsight/lattigo/v5/ring"
+)
+
+// DefaultSecurityFloor is the estimated security level, in bits, below which NewContext
+// and NewSeededContext refuse parameters, see CheckSecurity. ContextOptions.SecurityFloor
+// sets another floor, and ContextOptions.Insecure generates the keys of parameters
+// below it anyway, e.g. for tests on small parameters.
+const DefaultSecurityFloor = 128
+
+// ErrInsecureParameters is returned by CheckSecurity for parameters below the floor.
+var ErrInsecureParameters = errors.New("insecure parameters")
+
+// securityLevels are the security levels of maxLogQP, in bits, in increasing order.
+var securityLevels = []int{128, 192, 256}
+
+// maxLogQP holds, by security level in bits and by LogN, the largest log2(QP) of a
+// ring with a uniform ternary secret and a Gaussian error of standard deviation 3.2
+// that reaches the security level against classical attacks. The values are those of
+// the HomomorphicEncryption.org security standard, computed with the lattice estimator
+// and extended to LogN 16 as in OpenFHE.
+var maxLogQP = map[int]map[int]float64{
+	128: {10: 27, 11: 54, 12: 109, 13: 218, 14: 438, 15: 881, 16: 1747},
+	192: {10: 19, 11: 37, 12: 75, 13: 152, 14: 305, 15: 611, 16: 1224},
+	256: {10: 14, 11: 29, 12: 58, 13: 118, 14: 237, 15: 476, 16: 956},
+}
+
+// sparseSecretWeight and sparseSecretRatio describe the sparse secrets of the lattigo
+// parameter sets: N16QP1546H192H32 reaches 128-bit security with a secret of Hamming
+// weight 192 and a log2(QP) of 1546, about 0.885 times the bound of a uniform secret.
+const (
+	sparseSecretWeight = 192
+	sparseSecretRatio  = 1546.0 / 1747
+)
+
+// MaxLogQP returns the largest log2(QP) of a ring of degree 2^logN with a uniform
+// ternary secret that reaches securityBits, one of 128, 192 and 256.
+func MaxLogQP(logN, securityBits int) (float64, error) {
+	bounds, ok := maxLogQP[securityBits]
+	if !ok {
+		return 0, fmt.Errorf("no modulus bound for %d-bit security, only for 128, 192 and 256 bits", securityBits)
+	}
+	bound, ok := bounds[logN]
+	if !ok {
+		return 0, fmt.Errorf("no modulus bound for LogN %d, only for LogN 10 to 16", logN)
+	}
+	return bound, nil
+}
+
+// EstimateSecurity returns an estimate of the classical security, in bits, of a ring of
+// degree 2^logN and modulus of logQP bits with the secret distribution xs.
+//
+// The security grows about linearly with N/log2(QP), so the estimate interpolates the
+// bounds of MaxLogQP linearly in N/log2(QP), and extrapolates them with the nearest
+// segment, down to zero. A sparse ternary secret of Hamming weight H is accounted for
+// by scaling the bounds by a ratio interpolated in log(H) between the sparse secrets of
+// the lattigo parameter sets, of weight 192, and uniform secrets, of weight 2N/3; the
+// ratio is extrapolated below a weight of 192, for which there is no reference.
+func EstimateSecurity(logN int, logQP float64, xs ring.DistributionParameters) (float64, error) {
+	if _, ok := maxLogQP[securityLevels[0]][logN]; !ok {
+		return 0, fmt.Errorf("no security estimate for LogN %d, only for LogN 10 to 16", logN)
+	}
+	N := float64(int(1) << logN)
+
+	ratio := 1.0
+	if ternary, ok := xs.(ring.Ternary); ok && ternary.H > 0 && float64(ternary.H) < 2*N/3 {
+		t := math.Log(float64(ternary.H)/sparseSecretWeight) / math.Log(2*N/3/sparseSecretWeight)
+		ratio = sparseSecretRatio + (1-sparseSecretRatio)*t
+	} else if !ok {
+		if _, gaussian := xs.(ring.DiscreteGaussian); !gaussian {
+			return 0, fmt.Errorf("no security estimate for secrets of distribution %s", xs.Type())
+		}
+	}
+
+	x := N / logQP
+	points := make([][2]float64, len(securityLevels))
+	for i, bits := range securityLevels {
+		points[i] = [2]float64{N / (maxLogQP[bits][logN] * ratio), float64(bits)}
+	}
+
+	// The segment of x, or the nearest one
+	i := 0
+	for i < len(points)-2 && x > points[i+1][0] {
+		i++
+	}
+	x0, y0, x1, y1 := points[i][0], points[i][1], points[i+1][0], points[i+1][1]
+	return math.Max(0, y0+(x-x0)*(y1-y0)/(x1-x0)), nil
+}
+
+// ringSecurity returns the estimated security of the ring of params.
+func ringSecurity(params rlwe.Parameters) (float64, error) {
+	return EstimateSecurity(params.LogN(), params.LogQP(), params.Xs())
+}
+
+// ParametersSecurity returns the estimated security, in bits, of the weakest of the ring
+// of params and the bootstrapping ring of btparams.
+func ParametersSecurity(params hefloat.Parameters, btparams bootstrapping.Parameters) (float64, error) {
+	bits, err := ringSecurity(*params.GetRLWEParameters())
+	if err != nil {
+		return 0, fmt.Errorf("params: %w", err)
+	}
+	btpBits, err := ringSecurity(*btparams.BootstrappingParameters.GetRLWEParameters())
+	if err != nil {
+		return 0, fmt.Errorf("btparams: %w", err)
+	}
+	return math.Min(bits, btpBits), nil
+}
+
+// CheckSecurity returns an ErrInsecureParameters if the ring of params or the bootstrapping
+// ring of btparams is estimated below DefaultSecurityFloor, or cannot be estimated.
+func CheckSecurity(params hefloat.Parameters, btparams bootstrapping.Parameters) error {
+	return CheckSecurityFloor(params, btparams, DefaultSecurityFloor)
+}
+
+// CheckSecurityFloor is CheckSecurity with a floor of floorBits instead of
+// DefaultSecurityFloor.
+func CheckSecurityFloor(params hefloat.Parameters, btparams bootstrapping.Parameters, floorBits int) error {
+	rings := []struct {
+		name   string
+		params rlwe.Parameters
+	}{
+		{"params", *params.GetRLWEParameters()},
+		{"btparams", *btparams.BootstrappingParameters.GetRLWEParameters()},
+	}
+	for _, r := range rings {
+		bits, err := ringSecurity(r.params)
+		if err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrInsecureParameters, r.name, err)
+		}
+		if bits < float64(floorBits) {
+			return fmt.Errorf("%w: %s of LogN %d and LogQP %.1f reach an estimated %.0f bits of security, below the floor of %d bits",
+				ErrInsecureParameters, r.name, r.params.LogN(), r.params.LogQP(), bits, floorBits)
+		}
+	}
+	return nil
+}
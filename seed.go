@@ -0,0 +1,213 @@
+package lattigo_key
+
+import (
+	"crypto/sha512"
+
+	"github.com/tuneinsight/lattigo/v5/core/rlwe"
+	"github.com/tuneinsight/lattigo/v5/he/hefloat"
+	"github.com/tuneinsight/lattigo/v5/he/hefloat/bootstrapping"
+	"github.com/tuneinsight/lattigo/v5/ring"
+	"github.com/tuneinsight/lattigo/v5/ring/ringqp"
+	"github.com/tuneinsight/lattigo/v5/utils"
+	"github.com/tuneinsight/lattigo/v5/utils/sampling"
+)
+
+// NewSeededContext is NewContext with every key derived from seed: the same seed
+// and parameters always give byte-identical keys, which makes test fixtures and
+// CI caches reproducible. Encryptions still draw fresh randomness.
+//
+// WARNING: the seed is the secret key. Anyone who knows it can regenerate every
+// key of the Context, so seeded contexts are insecure for production unless the
+// seed is generated with a cryptographic random source and kept as secret as
+// the secret key itself.
+func NewSeededContext(params hefloat.Parameters, btparams bootstrapping.Parameters, seed []byte) (ctx *Context) {
+	if len(seed) == 0 {
+		panic("heccfd: the key generation seed is empty")
+	}
+	return NewContextWithOptions(params, btparams, ContextOptions{Seed: seed})
+}
+
+// deriveSeed hashes seed and label into a 64 byte seed, the largest key of a
+// sampling.KeyedPRNG. Seeds derived under different labels are independent.
+func deriveSeed(seed []byte, label string) []byte {
+	h := sha512.New()
+	h.Write([]byte(label))
+	h.Write([]byte{0})
+	h.Write(seed)
+	return h.Sum(nil)
+}
+
+// seededKeyGenerator generates the keys rlwe.KeyGenerator does, with its randomness
+// read from a PRNG keyed with a seed. rlwe.KeyGenerator only ever draws it from
+// crypto/rand, so the keys are generated here with the public API of lattigo, as
+// rlwe.KeyGenerator generates them.
+type seededKeyGenerator struct {
+	params         rlwe.Parameters
+	prng           sampling.PRNG
+	xeSampler      ring.Sampler
+	xsSampler      ring.Sampler
+	uniformSampler ringqp.UniformSampler
+}
+
+// newSeededKeyGenerator returns a key generator whose randomness is read from a PRNG
+// keyed with seed and label. Each generator of a Context has its own label so that
+// their streams are independent.
+func newSeededKeyGenerator(params rlwe.ParameterProvider, seed []byte, label string) *seededKeyGenerator {
+	prng, err := sampling.NewKeyedPRNG(deriveSeed(seed, label))
+	if err != nil {
+		panic(err)
+	}
+
+	p := *params.GetRLWEParameters()
+	xeSampler, err := ring.NewSampler(prng, p.RingQ(), p.Xe(), false)
+	if err != nil {
+		panic(err)
+	}
+	xsSampler, err := ring.NewSampler(prng, p.RingQ(), p.Xs(), false)
+	if err != nil {
+		panic(err)
+	}
+
+	return &seededKeyGenerator{
+		params:         p,
+		prng:           prng,
+		xeSampler:      xeSampler,
+		xsSampler:      xsSampler,
+		uniformSampler: ringqp.NewUniformSampler(prng, *p.RingQP()),
+	}
+}
+
+// withPRNG returns kgen with the uniform components of the keys read from prng.
+func (kgen *seededKeyGenerator) withPRNG(prng sampling.PRNG) *seededKeyGenerator {
+	uniform := *kgen
+	uniform.uniformSampler = ringqp.NewUniformSampler(prng, *kgen.params.RingQP())
+	return &uniform
+}
+
+func (kgen *seededKeyGenerator) GenSecretKeyNew() *rlwe.SecretKey {
+	return kgen.genSecretKey(kgen.xsSampler)
+}
+
+func (kgen *seededKeyGenerator) GenSecretKeyWithHammingWeightNew(hw int) *rlwe.SecretKey {
+	sampler, err := ring.NewSampler(kgen.prng, kgen.params.RingQ(), ring.Ternary{H: hw}, false)
+	if err != nil {
+		panic(err)
+	}
+	return kgen.genSecretKey(sampler)
+}
+
+// genSecretKey returns a secret key of coefficients read from sampler, in the NTT and
+// Montgomery domains.
+func (kgen *seededKeyGenerator) genSecretKey(sampler ring.Sampler) *rlwe.SecretKey {
+	sk := rlwe.NewSecretKey(kgen.params)
+	ringQP := kgen.params.RingQP().AtLevel(sk.LevelQ(), sk.LevelP())
+
+	sampler.AtLevel(sk.LevelQ()).Read(sk.Value.Q)
+	if levelP := sk.LevelP(); levelP > -1 {
+		ringQP.ExtendBasisSmallNormAndCenter(sk.Value.Q, levelP, sk.Value.Q, sk.Value.P)
+	}
+	ringQP.NTT(sk.Value, sk.Value)
+	ringQP.MForm(sk.Value, sk.Value)
+	return sk
+}
+
+func (kgen *seededKeyGenerator) GenPublicKeyNew(sk *rlwe.SecretKey) *rlwe.PublicKey {
+	pk := rlwe.NewPublicKey(kgen.params)
+	kgen.encryptZero(sk.Value, pk.Value)
+	return pk
+}
+
+// encryptZero sets ct to [-a*sk + e, a] in the NTT and Montgomery domains, at the levels of ct.
+func (kgen *seededKeyGenerator) encryptZero(sk ringqp.Poly, ct rlwe.VectorQP) {
+	b, a := ct[0], ct[1]
+	levelQ, levelP := b.LevelQ(), b.LevelP()
+	ringQP := kgen.params.RingQP().AtLevel(levelQ, levelP)
+
+	kgen.uniformSampler.AtLevel(levelQ, levelP).Read(a)
+
+	kgen.xeSampler.AtLevel(levelQ).Read(b.Q)
+	if levelP != -1 {
+		ringQP.ExtendBasisSmallNormAndCenter(b.Q, levelP, b.Q, b.P)
+	}
+	ringQP.NTT(b, b)
+	ringQP.MForm(b, b)
+	ringQP.MulCoeffsMontgomeryThenSub(a, sk, b)
+}
+
+func (kgen *seededKeyGenerator) GenRelinearizationKeyNew(sk *rlwe.SecretKey, evkParams ...rlwe.EvaluationKeyParameters) *rlwe.RelinearizationKey {
+	rlk := &rlwe.RelinearizationKey{EvaluationKey: *rlwe.NewEvaluationKey(kgen.params, evkParams...)}
+
+	ringQ := kgen.params.RingQ().AtLevel(rlk.LevelQ())
+	skIn := kgen.params.RingQ().NewPoly()
+	ringQ.MulCoeffsMontgomery(sk.Value.Q, sk.Value.Q, skIn)
+	kgen.genEvaluationKey(skIn, sk.Value, &rlk.EvaluationKey)
+	return rlk
+}
+
+func (kgen *seededKeyGenerator) GenGaloisKeyNew(galEl uint64, sk *rlwe.SecretKey, evkParams ...rlwe.EvaluationKeyParameters) *rlwe.GaloisKey {
+	gk := &rlwe.GaloisKey{EvaluationKey: *rlwe.NewEvaluationKey(kgen.params, evkParams...)}
+	ringQP := kgen.params.RingQP().AtLevel(gk.LevelQ(), gk.LevelP())
+
+	// [-a * pi_{k^-1}(sk) + sk, a] is encrypted, as rlwe.KeyGenerator.GenGaloisKey does
+	index, err := ring.AutomorphismNTTIndex(ringQP.RingQ.N(), ringQP.RingQ.NthRoot(), kgen.params.ModInvGaloisElement(galEl))
+	if err != nil {
+		panic(err)
+	}
+	skOut := kgen.params.RingQP().NewPoly()
+	ringQP.RingQ.AutomorphismNTTWithIndex(sk.Value.Q, index, skOut.Q)
+	if ringQP.RingP != nil {
+		ringQP.RingP.AutomorphismNTTWithIndex(sk.Value.P, index, skOut.P)
+	}
+	kgen.genEvaluationKey(sk.Value.Q, skOut, &gk.EvaluationKey)
+
+	gk.GaloisElement = galEl
+	gk.NthRoot = ringQP.RingQ.NthRoot()
+	return gk
+}
+
+func (kgen *seededKeyGenerator) GenEvaluationKeysForRingSwapNew(skStd, skConjugateInvariant *rlwe.SecretKey, evkParams ...rlwe.EvaluationKeyParameters) (stdToci, ciToStd *rlwe.EvaluationKey) {
+	levelQ := utils.Min(skStd.Value.Q.Level(), skConjugateInvariant.Value.Q.Level())
+
+	skCIMappedToStandard := &rlwe.SecretKey{Value: kgen.params.RingQP().AtLevel(levelQ, kgen.params.MaxLevelP()).NewPoly()}
+	kgen.params.RingQ().AtLevel(levelQ).UnfoldConjugateInvariantToStandard(skConjugateInvariant.Value.Q, skCIMappedToStandard.Value.Q)
+	if kgen.params.PCount() != 0 {
+		rlwe.ExtendBasisSmallNormAndCenterNTTMontgomery(kgen.params.RingQ(), kgen.params.RingP(), skCIMappedToStandard.Value.Q, kgen.params.RingQ().NewPoly(), skCIMappedToStandard.Value.P)
+	}
+
+	stdToci = kgen.GenEvaluationKeyNew(skStd, skCIMappedToStandard, evkParams...)
+	ciToStd = kgen.GenEvaluationKeyNew(skCIMappedToStandard, skStd, evkParams...)
+	return
+}
+
+func (kgen *seededKeyGenerator) GenEvaluationKeyNew(skInput, skOutput *rlwe.SecretKey, evkParams ...rlwe.EvaluationKeyParameters) *rlwe.EvaluationKey {
+	evk := rlwe.NewEvaluationKey(kgen.params, evkParams...)
+	ringQ, ringP := kgen.params.RingQ(), kgen.params.RingP()
+
+	// The smaller key is mapped to the largest dimension with Y = X^{N/n}, and the
+	// modulus P of skOutput is extended to the one of the key
+	skOut := kgen.params.RingQP().NewPoly()
+	ring.MapSmallDimensionToLargerDimensionNTT(skOutput.Value.Q, skOut.Q)
+	if levelP := evk.LevelP(); levelP != -1 {
+		rlwe.ExtendBasisSmallNormAndCenterNTTMontgomery(ringQ, ringP.AtLevel(levelP), skOut.Q, ringQ.NewPoly(), skOut.P)
+	}
+
+	skIn := ringQ.NewPoly()
+	ring.MapSmallDimensionToLargerDimensionNTT(skInput.Value.Q, skIn)
+	rlwe.ExtendBasisSmallNormAndCenterNTTMontgomery(ringQ, ringQ.AtLevel(skOutput.Value.Q.Level()), skIn, ringQ.NewPoly(), skIn)
+
+	kgen.genEvaluationKey(skIn, skOut, evk)
+	return evk
+}
+
+// genEvaluationKey sets evk to encryptions of zero under skOut, to which skIn times the
+// gadget vector is added.
+func (kgen *seededKeyGenerator) genEvaluationKey(skIn ring.Poly, skOut ringqp.Poly, evk *rlwe.EvaluationKey) {
+	for i := range evk.Value {
+		for j := range evk.Value[i] {
+			kgen.encryptZero(skOut, evk.Value[i][j])
+		}
+	}
+	if err := rlwe.AddPolyTimesGadgetVectorToGadgetCiphertext(skIn, []rlwe.GadgetCiphertext{evk.GadgetCiphertext}, *kgen.params.RingQP(), kgen.params.RingQ().NewPoly()); err != nil {
+		panic(err)
+	}
+}
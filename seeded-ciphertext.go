@@ -0,0 +1,135 @@
+package lattigo_key
+
+import (
+	"crypto/rand"
+	"fmt"
+
+	"github.com/tuneinsight/lattigo/v5/core/rlwe"
+	"github.com/tuneinsight/lattigo/v5/ring"
+	"github.com/tuneinsight/lattigo/v5/utils/buffer"
+	"github.com/tuneinsight/lattigo/v5/utils/sampling"
+)
+
+// A symmetric encryption (b, a) = (-a*s + e + m, a) under the secret key has a uniform
+// component a, which EncryptWithOptions reads from a PRNG keyed with a seed of its own,
+// so that the ciphertext is serialized with the seed instead of a. A seeded ciphertext is
+//
+//	seed, count, moduli_0, ..., moduli_{count-1}, (b)
+//
+// where (b) is the rlwe.Ciphertext of degree 0 holding the metadata and b, and the moduli
+// are those of the ring a is expanded in, so that it is expanded without the parameters.
+
+// ciphertextSeed is the seed the uniform component of a symmetric encryption was read
+// from, with the moduli of the ring it was read in.
+type ciphertextSeed struct {
+	seed   []byte
+	moduli []uint64
+}
+
+// newCiphertextSeed returns a new seed for a ciphertext at level in the ring of params.
+func newCiphertextSeed(params rlwe.Parameters, level int) *ciphertextSeed {
+	seed := make([]byte, keySeedSize)
+	if _, err := rand.Read(seed); err != nil {
+		panic(err)
+	}
+	return &ciphertextSeed{seed: seed, moduli: append([]uint64(nil), params.Q()[:level+1]...)}
+}
+
+// expand returns the uniform component read from the seed in the ring of degree N.
+// rings caches the rings of the moduli met while reading a batch.
+func (s *ciphertextSeed) expand(N int, rings map[string]*ring.Ring) (a ring.Poly, err error) {
+	key := fmt.Sprint(N, s.moduli)
+	r, ok := rings[key]
+	if !ok {
+		if r, err = ring.NewRing(N, s.moduli); err != nil {
+			return a, fmt.Errorf("invalid ciphertext seed moduli: %w", err)
+		}
+		rings[key] = r
+	}
+	prng, err := sampling.NewKeyedPRNG(s.seed)
+	if err != nil {
+		return a, err
+	}
+	a = r.NewPoly()
+	ring.NewUniformSampler(prng, r).Read(a)
+	return a, nil
+}
+
+// matches returns true if ct is still the encryption whose uniform component was read
+// from the seed, i.e. it was not modified in place since it was encrypted.
+func (s *ciphertextSeed) matches(ct *rlwe.Ciphertext, rings map[string]*ring.Ring) bool {
+	if ct.Degree() != 1 || !ct.IsNTT || ct.Level()+1 != len(s.moduli) {
+		return false
+	}
+	a, err := s.expand(ct.Value[1].N(), rings)
+	return err == nil && a.Equal(&ct.Value[1])
+}
+
+// seededBinarySize returns the size of ct once written in seeded form.
+func (s *ciphertextSeed) seededBinarySize(ct *rlwe.Ciphertext) int {
+	return len(s.seed) + 8 + 8*len(s.moduli) + degreeZero(ct).BinarySize()
+}
+
+// degreeZero returns the rlwe.Ciphertext of degree 0 that shares the metadata and b of ct.
+func degreeZero(ct *rlwe.Ciphertext) *rlwe.Ciphertext {
+	return &rlwe.Ciphertext{Element: rlwe.Element[ring.Poly]{Value: ct.Value[:1], MetaData: ct.MetaData}}
+}
+
+// writeSeeded writes ct in seeded form to w.
+func (s *ciphertextSeed) writeSeeded(w buffer.Writer, ct *rlwe.Ciphertext) (n int64, err error) {
+	var inc int64
+	if inc, err = buffer.Write(w, s.seed); err != nil {
+		return n + inc, err
+	}
+	n += inc
+	if inc, err = buffer.WriteAsUint64(w, len(s.moduli)); err != nil {
+		return n + inc, err
+	}
+	n += inc
+	if inc, err = buffer.WriteUint64Slice(w, s.moduli); err != nil {
+		return n + inc, err
+	}
+	n += inc
+	inc, err = degreeZero(ct).WriteTo(w)
+	return n + inc, err
+}
+
+// readSeeded reads a ciphertext written by writeSeeded from r and expands its uniform
+// component from the seed.
+func readSeeded(r buffer.Reader, rings map[string]*ring.Ring) (ct *rlwe.Ciphertext, s *ciphertextSeed, n int64, err error) {
+	var inc int64
+	s = &ciphertextSeed{seed: make([]byte, keySeedSize)}
+	if inc, err = buffer.Read(r, s.seed); err != nil {
+		return nil, nil, n + inc, err
+	}
+	n += inc
+
+	var count int
+	if inc, err = buffer.ReadAsUint64(r, &count); err != nil {
+		return nil, nil, n + inc, err
+	}
+	n += inc
+	if count < 1 || count > maxModuli {
+		return nil, nil, n, fmt.Errorf("invalid seeded ciphertext of %d moduli", count)
+	}
+	s.moduli = make([]uint64, count)
+	if inc, err = buffer.ReadUint64Slice(r, s.moduli); err != nil {
+		return nil, nil, n + inc, err
+	}
+	n += inc
+
+	if ct, inc, err = readRLWECiphertext(r); err != nil {
+		return nil, nil, n + inc, err
+	}
+	n += inc
+	if ct.Degree() != 0 || !ct.IsNTT || ct.Level()+1 != count {
+		return nil, nil, n, fmt.Errorf("invalid seeded ciphertext of degree %d and level %d for %d moduli", ct.Degree(), ct.Level(), count)
+	}
+
+	a, err := s.expand(ct.Value[0].N(), rings)
+	if err != nil {
+		return nil, nil, n, err
+	}
+	ct.Value = append(ct.Value, a)
+	return ct, s, n, nil
+}
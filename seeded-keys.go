@@ -0,0 +1,440 @@
+package lattigo_key
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"io"
+
+	"github.com/tuneinsight/lattigo/v5/core/rlwe"
+	"github.com/tuneinsight/lattigo/v5/ring"
+	"github.com/tuneinsight/lattigo/v5/ring/ringqp"
+	"github.com/tuneinsight/lattigo/v5/utils"
+	"github.com/tuneinsight/lattigo/v5/utils/buffer"
+	"github.com/tuneinsight/lattigo/v5/utils/sampling"
+	"github.com/tuneinsight/lattigo/v5/utils/structs"
+)
+
+// seededKeyMagic starts the keys SaveKeys writes in seed-compressed form.
+const seededKeyMagic = "HESK"
+
+// keySeedSize is the size of the seed the uniform components of a key are expanded from.
+const keySeedSize = 32
+
+// Every public, relinearization and galois key is made of encryptions of zero
+// (b, a) = (-a*s + e, a) whose a is uniform. The keys of a Context are generated
+// with a being read from a PRNG keyed with a seed of their own, so that a
+// seed-compressed key only holds the b components and the seed.
+//
+// A seed-compressed public key is
+//
+//	magic, seed, b
+//
+// a seed-compressed relinearization or evaluation key is
+//
+//	magic, gadget
+//
+// where gadget is
+//
+//	seed, BaseTwoDecomposition, rows, then for each row: cols, b_0, ..., b_{cols-1}
+//
+// a seed-compressed galois key is
+//
+//	magic, GaloisElement, NthRoot, gadget
+//
+// and a seed-compressed MemEvaluationKeySet is
+//
+//	magic, hasRelinearizationKey, [gadget], count, then for each galois key: GaloisElement, NthRoot, gadget
+
+// uniformKeyGenerator returns kgen with the uniform components of the keys it generates
+// read from a PRNG keyed with a new seed, which is recorded under name.
+func (ctx *Context) uniformKeyGenerator(kgen keyGenerator, name string) keyGenerator {
+	seed := make([]byte, keySeedSize)
+	if ctx.uniformSeed != nil {
+		copy(seed, deriveSeed(ctx.uniformSeed, name))
+	} else if _, err := rand.Read(seed); err != nil {
+		panic(err)
+	}
+	ctx.setKeySeed(name, seed)
+
+	prng, err := sampling.NewKeyedPRNG(seed)
+	if err != nil {
+		panic(err)
+	}
+	if seeded, ok := kgen.(*seededKeyGenerator); ok {
+		return seeded.withPRNG(prng)
+	}
+	return &rlwe.KeyGenerator{Encryptor: kgen.(*rlwe.KeyGenerator).WithPRNG(prng)}
+}
+
+// galoisKeySeedName returns the name under which the seed of the galois key of galEl is recorded.
+func galoisKeySeedName(prefix string, galEl uint64) string {
+	return fmt.Sprintf("%s_%d", prefix, galEl)
+}
+
+// keySeed returns the seed recorded under name, or an error if the key was not
+// generated from a seed, e.g. when it was loaded from an uncompressed key file.
+func (ctx *Context) keySeed(name string) ([]byte, error) {
+	ctx.keySeedsMu.Lock()
+	seed, ok := ctx.keySeeds[name]
+	ctx.keySeedsMu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("key %s has no uniform seed and cannot be seed-compressed", name)
+	}
+	return seed, nil
+}
+
+// setKeySeed records seed under name. Keys are loaded concurrently, hence the lock.
+func (ctx *Context) setKeySeed(name string, seed []byte) {
+	ctx.keySeedsMu.Lock()
+	ctx.keySeeds[name] = seed
+	ctx.keySeedsMu.Unlock()
+}
+
+// isSeededKey returns true if data is a seed-compressed key.
+func isSeededKey(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(seededKeyMagic))
+}
+
+// seededKeyWriter accumulates a seed-compressed key. The first error is kept
+// and returned by Bytes.
+type seededKeyWriter struct {
+	buf bytes.Buffer
+	w   *bufio.Writer
+	err error
+}
+
+func newSeededKeyWriter() *seededKeyWriter {
+	kw := &seededKeyWriter{}
+	kw.w = bufio.NewWriter(&kw.buf)
+	kw.write([]byte(seededKeyMagic))
+	return kw
+}
+
+func (kw *seededKeyWriter) write(p []byte) {
+	if kw.err == nil {
+		_, kw.err = buffer.Write(kw.w, p)
+	}
+}
+
+func (kw *seededKeyWriter) writeUint64(v uint64) {
+	if kw.err == nil {
+		_, kw.err = buffer.WriteUint64(kw.w, v)
+	}
+}
+
+func (kw *seededKeyWriter) writePoly(p ringqp.Poly) {
+	if kw.err == nil {
+		_, kw.err = p.WriteTo(kw.w)
+	}
+}
+
+func (kw *seededKeyWriter) writeGadget(g *rlwe.GadgetCiphertext, seed []byte) {
+	kw.write(seed)
+	kw.writeUint64(uint64(g.BaseTwoDecomposition))
+	kw.writeUint64(uint64(len(g.Value)))
+	for _, row := range g.Value {
+		kw.writeUint64(uint64(len(row)))
+		for _, v := range row {
+			kw.writePoly(v[0])
+		}
+	}
+}
+
+func (kw *seededKeyWriter) writeGaloisKey(galk *rlwe.GaloisKey, seed []byte) {
+	kw.writeUint64(galk.GaloisElement)
+	kw.writeUint64(galk.NthRoot)
+	kw.writeGadget(&galk.GadgetCiphertext, seed)
+}
+
+func (kw *seededKeyWriter) Bytes() ([]byte, error) {
+	if kw.err == nil {
+		kw.err = kw.w.Flush()
+	}
+	return kw.buf.Bytes(), kw.err
+}
+
+// seededKeyReader expands a seed-compressed key, regenerating its uniform components
+// in the ring of params. The first error is kept and returned by Err.
+type seededKeyReader struct {
+	r      *bufio.Reader
+	params rlwe.Parameters
+	err    error
+}
+
+func newSeededKeyReader(data []byte, params rlwe.Parameters) *seededKeyReader {
+	kr := &seededKeyReader{r: bufio.NewReader(bytes.NewReader(data)), params: params}
+	magic := kr.read(len(seededKeyMagic))
+	if kr.err == nil && string(magic) != seededKeyMagic {
+		kr.err = fmt.Errorf("not a seed-compressed key")
+	}
+	return kr
+}
+
+func (kr *seededKeyReader) read(n int) []byte {
+	p := make([]byte, n)
+	if kr.err == nil {
+		_, kr.err = io.ReadFull(kr.r, p)
+	}
+	return p
+}
+
+func (kr *seededKeyReader) readUint64() (v uint64) {
+	if kr.err == nil {
+		_, kr.err = buffer.ReadUint64(kr.r, &v)
+	}
+	return
+}
+
+// readEncryptionsOfZero reads the b components of encryptions of zero at levels levelQ
+// and levelP and pairs them with uniform components read, in order, from the PRNG
+// keyed with seed.
+func (kr *seededKeyReader) readEncryptionsOfZero(uniform ringqp.UniformSampler, vectors []rlwe.VectorQP, levelQ, levelP int) {
+	for i := range vectors {
+		b := kr.readPolyQP(levelQ, levelP)
+		if kr.err == nil && (b.LevelQ() != levelQ || b.LevelP() != levelP) {
+			kr.err = fmt.Errorf("key polynomial at levels %d, %d instead of %d, %d", b.LevelQ(), b.LevelP(), levelQ, levelP)
+		}
+		if kr.err != nil {
+			return
+		}
+		vectors[i] = kr.encryptionOfZero(uniform, b)
+	}
+}
+
+// encryptionOfZero pairs b with a uniform component read from the PRNG of uniform.
+func (kr *seededKeyReader) encryptionOfZero(uniform ringqp.UniformSampler, b ringqp.Poly) rlwe.VectorQP {
+	a := kr.params.RingQP().AtLevel(b.LevelQ(), b.LevelP()).NewPoly()
+	uniform.AtLevel(b.LevelQ(), b.LevelP()).Read(a)
+	return rlwe.VectorQP{b, a}
+}
+
+// readPolyQP reads a polynomial in the ring of params with at most levelQ+1 moduli Q
+// and levelP+1 moduli P, checking each length read before allocating.
+func (kr *seededKeyReader) readPolyQP(levelQ, levelP int) (p ringqp.Poly) {
+	p.Q = kr.readPoly(1, levelQ+1)
+	p.P = kr.readPoly(0, levelP+1)
+	return
+}
+
+func (kr *seededKeyReader) readPoly(minModuli, maxModuli int) (p ring.Poly) {
+	rows := kr.readUint64()
+	if kr.err == nil && (rows < uint64(minModuli) || rows > uint64(maxModuli)) {
+		kr.err = fmt.Errorf("key polynomial of %d moduli, expected %d to %d", rows, minModuli, maxModuli)
+	}
+	if kr.err != nil {
+		return
+	}
+	p.Coeffs = make([][]uint64, rows)
+	for i := range p.Coeffs {
+		cols := kr.readUint64()
+		if kr.err == nil && cols != uint64(kr.params.N()) {
+			kr.err = fmt.Errorf("key polynomial of degree %d instead of %d", cols, kr.params.N())
+		}
+		if kr.err != nil {
+			return
+		}
+		p.Coeffs[i] = make([]uint64, cols)
+		_, kr.err = buffer.ReadUint64Slice(kr.r, p.Coeffs[i])
+	}
+	return
+}
+
+func (kr *seededKeyReader) uniformSampler(seed []byte) ringqp.UniformSampler {
+	prng, err := sampling.NewKeyedPRNG(seed)
+	if err != nil && kr.err == nil {
+		kr.err = err
+	}
+	return ringqp.NewUniformSampler(prng, *kr.params.RingQP())
+}
+
+// readGadget reads a gadget ciphertext. Its levels are read from its first polynomial,
+// and its numbers of rows and columns are checked against the ones params imply at
+// these levels before the gadget is allocated.
+func (kr *seededKeyReader) readGadget() (g rlwe.GadgetCiphertext, seed []byte) {
+	seed = kr.read(keySeedSize)
+	uniform := kr.uniformSampler(seed)
+
+	base := kr.readUint64()
+	rows := kr.readUint64()
+	cols := kr.readUint64()
+	first := kr.readPolyQP(kr.params.MaxLevelQ(), kr.params.MaxLevelP())
+	if kr.err != nil {
+		return
+	}
+	if base > 63 {
+		kr.err = fmt.Errorf("invalid key base two decomposition %d", base)
+		return
+	}
+	g.BaseTwoDecomposition = int(base)
+
+	levelQ, levelP := first.LevelQ(), first.LevelP()
+	wantRows := kr.params.BaseRNSDecompositionVectorSize(levelQ, levelP)
+	wantCols := kr.params.BaseTwoDecompositionVectorSize(levelQ, levelP, g.BaseTwoDecomposition)
+	if rows != uint64(wantRows) {
+		kr.err = fmt.Errorf("key of %d rows, expected %d at levels %d, %d", rows, wantRows, levelQ, levelP)
+		return
+	}
+
+	g.Value = make(structs.Matrix[rlwe.VectorQP], rows)
+	for i := range g.Value {
+		if i > 0 {
+			cols = kr.readUint64()
+		}
+		if kr.err == nil && cols != uint64(wantCols[i]) {
+			kr.err = fmt.Errorf("key row %d of %d columns, expected %d", i, cols, wantCols[i])
+		}
+		if kr.err != nil {
+			return
+		}
+		g.Value[i] = make([]rlwe.VectorQP, cols)
+		if i == 0 {
+			g.Value[0][0] = kr.encryptionOfZero(uniform, first)
+			kr.readEncryptionsOfZero(uniform, g.Value[0][1:], levelQ, levelP)
+		} else {
+			kr.readEncryptionsOfZero(uniform, g.Value[i], levelQ, levelP)
+		}
+	}
+	return
+}
+
+func (kr *seededKeyReader) readGaloisKey() (galk *rlwe.GaloisKey, seed []byte) {
+	galk = &rlwe.GaloisKey{GaloisElement: kr.readUint64(), NthRoot: kr.readUint64()}
+	galk.GadgetCiphertext, seed = kr.readGadget()
+	return
+}
+
+// Err returns the first error met while reading, or an error if data is left unread.
+func (kr *seededKeyReader) Err() error {
+	if kr.err == nil {
+		if _, err := kr.r.Peek(1); err != io.EOF {
+			return fmt.Errorf("trailing data after seed-compressed key")
+		}
+	}
+	return kr.err
+}
+
+func (ctx *Context) marshalSeededPublicKey(pk *rlwe.PublicKey) ([]byte, error) {
+	seed, err := ctx.keySeed("pk")
+	if err != nil {
+		return nil, err
+	}
+	kw := newSeededKeyWriter()
+	kw.write(seed)
+	kw.writePoly(pk.Value[0])
+	return kw.Bytes()
+}
+
+func (ctx *Context) unmarshalSeededPublicKey(data []byte) (*rlwe.PublicKey, error) {
+	kr := newSeededKeyReader(data, *ctx.params.GetRLWEParameters())
+	seed := kr.read(keySeedSize)
+	value := make([]rlwe.VectorQP, 1)
+	kr.readEncryptionsOfZero(kr.uniformSampler(seed), value, ctx.params.MaxLevelQ(), ctx.params.MaxLevelP())
+	if err := kr.Err(); err != nil {
+		return nil, err
+	}
+	ctx.setKeySeed("pk", seed)
+	return &rlwe.PublicKey{Value: value[0]}, nil
+}
+
+// marshalSeededEvaluationKey seed-compresses the relinearization or evaluation key recorded under name.
+func (ctx *Context) marshalSeededEvaluationKey(name string, evk *rlwe.EvaluationKey) ([]byte, error) {
+	seed, err := ctx.keySeed(name)
+	if err != nil {
+		return nil, err
+	}
+	kw := newSeededKeyWriter()
+	kw.writeGadget(&evk.GadgetCiphertext, seed)
+	return kw.Bytes()
+}
+
+// unmarshalSeededEvaluationKey expands a key written by marshalSeededEvaluationKey in the ring of params.
+func (ctx *Context) unmarshalSeededEvaluationKey(name string, data []byte, params rlwe.Parameters) (*rlwe.EvaluationKey, error) {
+	kr := newSeededKeyReader(data, params)
+	g, seed := kr.readGadget()
+	if err := kr.Err(); err != nil {
+		return nil, err
+	}
+	ctx.setKeySeed(name, seed)
+	return &rlwe.EvaluationKey{GadgetCiphertext: g}, nil
+}
+
+// marshalSeededGaloisKey seed-compresses a galois key whose seed is recorded under prefix.
+func (ctx *Context) marshalSeededGaloisKey(prefix string, galk *rlwe.GaloisKey) ([]byte, error) {
+	seed, err := ctx.keySeed(galoisKeySeedName(prefix, galk.GaloisElement))
+	if err != nil {
+		return nil, err
+	}
+	kw := newSeededKeyWriter()
+	kw.writeGaloisKey(galk, seed)
+	return kw.Bytes()
+}
+
+// unmarshalSeededGaloisKey expands a key written by marshalSeededGaloisKey in the ring of params.
+func (ctx *Context) unmarshalSeededGaloisKey(prefix string, data []byte, params rlwe.Parameters) (*rlwe.GaloisKey, error) {
+	kr := newSeededKeyReader(data, params)
+	galk, seed := kr.readGaloisKey()
+	if err := kr.Err(); err != nil {
+		return nil, err
+	}
+	ctx.setKeySeed(galoisKeySeedName(prefix, galk.GaloisElement), seed)
+	return galk, nil
+}
+
+// marshalSeededKeySet seed-compresses a MemEvaluationKeySet whose seeds are recorded
+// under prefix_rlk and prefix_galk.
+func (ctx *Context) marshalSeededKeySet(prefix string, set *rlwe.MemEvaluationKeySet) ([]byte, error) {
+	kw := newSeededKeyWriter()
+
+	if set.RelinearizationKey == nil {
+		kw.write([]byte{0})
+	} else {
+		seed, err := ctx.keySeed(prefix + "_rlk")
+		if err != nil {
+			return nil, err
+		}
+		kw.write([]byte{1})
+		kw.writeGadget(&set.RelinearizationKey.GadgetCiphertext, seed)
+	}
+
+	galEls := utils.GetSortedKeys(set.GaloisKeys)
+	kw.writeUint64(uint64(len(galEls)))
+	for _, galEl := range galEls {
+		seed, err := ctx.keySeed(galoisKeySeedName(prefix+"_galk", galEl))
+		if err != nil {
+			return nil, err
+		}
+		kw.writeGaloisKey(set.GaloisKeys[galEl], seed)
+	}
+
+	return kw.Bytes()
+}
+
+// unmarshalSeededKeySet expands a set written by marshalSeededKeySet in the ring of params.
+func (ctx *Context) unmarshalSeededKeySet(prefix string, data []byte, params rlwe.Parameters) (*rlwe.MemEvaluationKeySet, error) {
+	kr := newSeededKeyReader(data, params)
+	set := rlwe.NewMemEvaluationKeySet(nil)
+	seeds := map[string][]byte{}
+
+	if hasRlk := kr.read(1); kr.err == nil && hasRlk[0] == 1 {
+		var g rlwe.GadgetCiphertext
+		g, seeds[prefix+"_rlk"] = kr.readGadget()
+		set.RelinearizationKey = &rlwe.RelinearizationKey{EvaluationKey: rlwe.EvaluationKey{GadgetCiphertext: g}}
+	}
+
+	count := kr.readUint64()
+	for i := uint64(0); i < count && kr.err == nil; i++ {
+		galk, seed := kr.readGaloisKey()
+		set.GaloisKeys[galk.GaloisElement] = galk
+		seeds[galoisKeySeedName(prefix+"_galk", galk.GaloisElement)] = seed
+	}
+
+	if err := kr.Err(); err != nil {
+		return nil, err
+	}
+	for name, seed := range seeds {
+		ctx.setKeySeed(name, seed)
+	}
+	return set, nil
+}
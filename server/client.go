@@ -0,0 +1,120 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/JihunSKKU/HE-CCFD/lattigo_key"
+)
+
+// Client runs the models of a Server on samples it encrypts and decrypts with
+// the keys of its Context.
+type Client struct {
+	ctx     *lattigo_key.Context
+	baseURL string
+
+	// HTTPClient sends the requests, http.DefaultClient if it is nil.
+	HTTPClient *http.Client
+
+	// Codec compresses the posted ciphertexts.
+	Codec lattigo_key.Codec
+}
+
+// NewClient returns a Client of the server at baseURL, e.g. "http://localhost:8080".
+// ctx must hold the secret key the evaluation keys of the server were generated with.
+func NewClient(ctx *lattigo_key.Context, baseURL string) *Client {
+	return &Client{
+		ctx:     ctx,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+	}
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// Models returns the names of the models of the server. It returns an
+// ErrFingerprintMismatch if the server uses other parameters than the client.
+func (c *Client) Models() ([]string, error) {
+	resp, err := c.httpClient().Get(c.baseURL + modelsPath)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := checkResponse(resp); err != nil {
+		return nil, err
+	}
+
+	var list modelList
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("invalid model list: %w", err)
+	}
+	if fp := c.ctx.Fingerprint().String(); list.Fingerprint != fp {
+		return nil, fmt.Errorf("%w: server uses parameters %s, client uses %s", lattigo_key.ErrFingerprintMismatch, list.Fingerprint, fp)
+	}
+	return list.Models, nil
+}
+
+// Evaluate posts ctxt to the server and returns the result of model on it.
+func (c *Client) Evaluate(model string, ctxt *lattigo_key.Ciphertext) (*lattigo_key.Ciphertext, error) {
+	var body bytes.Buffer
+	if _, err := ctxt.WriteCompressedTo(&body, c.Codec); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient().Post(c.baseURL+modelsPath+"/"+url.PathEscape(model), "application/octet-stream", &body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := checkResponse(resp); err != nil {
+		return nil, err
+	}
+
+	out := new(lattigo_key.Ciphertext)
+	if _, err := out.ReadFrom(resp.Body); err != nil {
+		return nil, fmt.Errorf("invalid result of model %s: %w", model, err)
+	}
+	return out, nil
+}
+
+// Infer encrypts samples, one per ciphertext, runs model on them on the server and
+// returns the decrypted outputs, one row of the output size of the model per sample.
+func (c *Client) Infer(model string, samples [][]float64) ([][]float64, error) {
+	out, err := c.Evaluate(model, c.ctx.Encrypt(lattigo_key.NewPlaintext(samples)))
+	if err != nil {
+		return nil, err
+	}
+
+	rows := c.ctx.Decrypt(out).GetData()
+	if len(rows) != len(samples) {
+		return nil, fmt.Errorf("model %s returned %d outputs for %d samples", model, len(rows), len(samples))
+	}
+	for i := range rows {
+		if len(rows[i]) > out.Size() {
+			rows[i] = rows[i][:out.Size()]
+		}
+	}
+	return rows, nil
+}
+
+// checkResponse returns the error reported by the server, if any. Fingerprint
+// mismatches are returned as ErrFingerprintMismatch.
+func checkResponse(resp *http.Response) error {
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode == http.StatusConflict {
+		return fmt.Errorf("%w: server returned %s: %s", lattigo_key.ErrFingerprintMismatch, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return fmt.Errorf("server returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+}
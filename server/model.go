@@ -0,0 +1,34 @@
+package server
+
+import (
+	"github.com/JihunSKKU/HE-CCFD/lattigo_key"
+)
+
+// Model is an encrypted computation the server runs on the ciphertexts it receives.
+// Evaluate is called concurrently and must only evaluate with the evaluator pool of ctx.
+type Model interface {
+	Evaluate(ctx *lattigo_key.Context, in *lattigo_key.Ciphertext) (*lattigo_key.Ciphertext, error)
+}
+
+// ModelFunc turns a function into a Model.
+type ModelFunc func(ctx *lattigo_key.Context, in *lattigo_key.Ciphertext) (*lattigo_key.Ciphertext, error)
+
+func (f ModelFunc) Evaluate(ctx *lattigo_key.Context, in *lattigo_key.Ciphertext) (*lattigo_key.Ciphertext, error) {
+	return f(ctx, in)
+}
+
+// MLPModel returns a Model evaluating model with Context.EvaluateMLP.
+func MLPModel(model *lattigo_key.MLP) Model {
+	return ModelFunc(func(ctx *lattigo_key.Context, in *lattigo_key.Ciphertext) (*lattigo_key.Ciphertext, error) {
+		return ctx.EvaluateMLP(model, in)
+	})
+}
+
+// LinearScorer returns a Model computing the score <weights, x> + bias of every sample x.
+// The score of a sample is the first value of its output.
+func LinearScorer(weights []float64, bias float64) Model {
+	return MLPModel(&lattigo_key.MLP{Layers: []lattigo_key.DenseLayer{{
+		Weights: [][]float64{weights},
+		Bias:    []float64{bias},
+	}}})
+}
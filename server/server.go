@@ -0,0 +1,189 @@
+// Package server serves encrypted inference over HTTP. A Server holds the evaluation
+// keys of a client, but not its secret key, and runs registered models on the
+// ciphertexts the client posts; the Client encrypts the samples, posts them and
+// decrypts the results.
+//
+// The server answers
+//
+//	GET  /v1/models         the fingerprint of its parameters and its models, as JSON
+//	POST /v1/models/{name}  the result of model name on the serialized Ciphertext of the
+//	                        body, possibly compressed, as a serialized Ciphertext
+//
+// and reports errors as plain text, with status 400 for an invalid ciphertext, or one
+// of another shape than the parameters of the server, 404 for an unknown model, 409
+// for a ciphertext of other parameters or without their fingerprint, 413 for a body
+// larger than Server.MaxRequestBytes or a ciphertext that decompresses to more than
+// Server.MaxDecompressedBytes, and 422 when the model fails on the ciphertext.
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/JihunSKKU/HE-CCFD/lattigo_key"
+)
+
+// DefaultMaxRequestBytes bounds the size of a posted ciphertext when
+// Server.MaxRequestBytes is zero.
+const DefaultMaxRequestBytes = 1 << 30
+
+// modelsPath is the path of the model listing, and the prefix of the model paths.
+const modelsPath = "/v1/models"
+
+// modelList is the JSON body of GET /v1/models.
+type modelList struct {
+	Fingerprint string   `json:"fingerprint"`
+	Models      []string `json:"models"`
+}
+
+// Server runs registered models on ciphertexts posted over HTTP. It implements
+// http.Handler.
+type Server struct {
+	ctx *lattigo_key.Context
+
+	// MaxRequestBytes bounds the size of a request body, DefaultMaxRequestBytes if it is zero.
+	MaxRequestBytes int64
+
+	// MaxDecompressedBytes bounds the size of a posted ciphertext once decompressed,
+	// lattigo_key.DefaultMaxDecompressedBytes if it is zero.
+	MaxDecompressedBytes int64
+
+	mu     sync.RWMutex
+	models map[string]Model
+}
+
+// New returns a Server evaluating with the keys of ctx, with no model registered.
+func New(ctx *lattigo_key.Context) *Server {
+	return &Server{
+		ctx:    ctx,
+		models: map[string]Model{},
+	}
+}
+
+// Load returns a Server evaluating with the keys saved in dirPath with
+// SaveOptions.EvaluationOnly. It refuses a directory holding a secret key.
+func Load(dirPath string) (*Server, error) {
+	if _, err := os.Stat(dirPath + "/sk.key"); err == nil {
+		return nil, fmt.Errorf("%s holds a secret key, save the keys of the server with EvaluationOnly", dirPath)
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	ctx, err := lattigo_key.LoadKeys(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	return New(ctx), nil
+}
+
+// Context returns the Context the server evaluates with.
+func (s *Server) Context() *lattigo_key.Context {
+	return s.ctx
+}
+
+// Register serves model under name, replacing the model registered under it if any.
+func (s *Server) Register(name string, model Model) {
+	if name == "" || strings.Contains(name, "/") {
+		panic(fmt.Sprintf("heccfd: invalid model name %q", name))
+	}
+
+	s.mu.Lock()
+	s.models[name] = model
+	s.mu.Unlock()
+}
+
+func (s *Server) model(name string) (Model, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	model, ok := s.models[name]
+	return model, ok
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == modelsPath:
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.listModels(w)
+
+	case strings.HasPrefix(r.URL.Path, modelsPath+"/"):
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.evaluate(w, r, strings.TrimPrefix(r.URL.Path, modelsPath+"/"))
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) listModels(w http.ResponseWriter) {
+	list := modelList{Fingerprint: s.ctx.Fingerprint().String()}
+	s.mu.RLock()
+	for name := range s.models {
+		list.Models = append(list.Models, name)
+	}
+	s.mu.RUnlock()
+	sort.Strings(list.Models)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+func (s *Server) evaluate(w http.ResponseWriter, r *http.Request, name string) {
+	model, ok := s.model(name)
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown model %q", name), http.StatusNotFound)
+		return
+	}
+
+	maxBytes := s.MaxRequestBytes
+	if maxBytes == 0 {
+		maxBytes = DefaultMaxRequestBytes
+	}
+	in := new(lattigo_key.Ciphertext)
+	if _, err := in.ReadCompressedFromWithOptions(http.MaxBytesReader(w, r.Body, maxBytes), lattigo_key.DecodeOptions{MaxDecompressedBytes: s.MaxDecompressedBytes}); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) || errors.Is(err, lattigo_key.ErrDecompressedTooLarge) {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if errors.Is(err, lattigo_key.ErrFingerprintMismatch) {
+			http.Error(w, fmt.Sprintf("invalid ciphertext: %v", err), http.StatusConflict)
+			return
+		}
+		http.Error(w, fmt.Sprintf("invalid ciphertext: %v", err), http.StatusBadRequest)
+		return
+	}
+	// A ciphertext without fingerprint is refused, as it cannot be matched to the keys of
+	// the server, and so is one of another shape than the parameters, as the models would
+	// panic on it
+	if err := s.ctx.CheckCiphertext(in); err != nil {
+		if errors.Is(err, lattigo_key.ErrFingerprintMismatch) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		http.Error(w, fmt.Sprintf("invalid ciphertext: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	out, err := model.Evaluate(s.ctx, in)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("model %s: %v", name, err), http.StatusUnprocessableEntity)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	out.WriteTo(w)
+}
@@ -0,0 +1,162 @@
+package lattigo_key
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/tuneinsight/lattigo/v5/core/rlwe"
+	"github.com/tuneinsight/lattigo/v5/ring"
+	"github.com/tuneinsight/lattigo/v5/ring/ringqp"
+)
+
+// keyFileHeaderSize is the size of the header writeKeyFile puts before every key.
+const keyFileHeaderSize = len(keyFileMagic) + len(Fingerprint{})
+
+// ArtifactSize is the size of an artifact written by SaveKeys. DiskBytes is the
+// size of its file and MemoryBytes the size of its polynomial coefficients once loaded.
+type ArtifactSize struct {
+	Name        string `json:"name"`
+	DiskBytes   int64  `json:"disk_bytes"`
+	MemoryBytes int64  `json:"memory_bytes"`
+}
+
+// GaloisKeySize is the size of the galois key of one Galois element.
+type GaloisKeySize struct {
+	GaloisElement uint64 `json:"galois_element"`
+	ArtifactSize
+}
+
+// KeySizeReport holds the size of every artifact of a Context and their totals.
+// It marshals to JSON with encoding/json.
+type KeySizeReport struct {
+	Params             ArtifactSize    `json:"params"`
+	BtParams           ArtifactSize    `json:"btparams"`
+	SecretKey          ArtifactSize    `json:"sk"`
+	PublicKey          ArtifactSize    `json:"pk"`
+	RelinearizationKey ArtifactSize    `json:"rlk"`
+	GaloisKeys         []GaloisKeySize `json:"galks"`
+	BootstrappingKeys  []ArtifactSize  `json:"btpkeys"`
+
+	GaloisKeysDiskBytes          int64 `json:"galks_disk_bytes"`
+	GaloisKeysMemoryBytes        int64 `json:"galks_memory_bytes"`
+	BootstrappingKeysDiskBytes   int64 `json:"btpkeys_disk_bytes"`
+	BootstrappingKeysMemoryBytes int64 `json:"btpkeys_memory_bytes"`
+	TotalDiskBytes               int64 `json:"total_disk_bytes"`
+	TotalMemoryBytes             int64 `json:"total_memory_bytes"`
+}
+
+// JSON returns the indented JSON encoding of the report.
+func (r *KeySizeReport) JSON() ([]byte, error) {
+	return json.MarshalIndent(r, "", "  ")
+}
+
+// KeySizes returns the exact size of every key of the context, on disk as written
+// by SaveKeys and in memory.
+func (ctx *Context) KeySizes() (*KeySizeReport, error) {
+	r := &KeySizeReport{}
+
+	paramBytes, err := ctx.params.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	r.Params = ArtifactSize{Name: "params", DiskBytes: int64(len(paramBytes))}
+
+	btparamBytes, err := ctx.btparams.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	r.BtParams = ArtifactSize{Name: "btparams", DiskBytes: int64(len(btparamBytes))}
+
+	if ctx.sk != nil {
+		r.SecretKey = keyArtifactSize("sk.key", ctx.sk.BinarySize(), polyQPMemorySize(ctx.sk.Value))
+	}
+	if ctx.pk != nil {
+		r.PublicKey = keyArtifactSize("pk.key", ctx.pk.BinarySize(), vectorQPMemorySize(ctx.pk.Value))
+	}
+	if ctx.rlk != nil {
+		r.RelinearizationKey = keyArtifactSize("rlk.key", ctx.rlk.BinarySize(), gadgetMemorySize(ctx.rlk.GadgetCiphertext))
+	}
+
+	for i, galk := range ctx.galKs {
+		size := GaloisKeySize{
+			GaloisElement: galk.GaloisElement,
+			ArtifactSize:  keyArtifactSize(galoisKeyFileName(i), galk.BinarySize(), gadgetMemorySize(galk.GadgetCiphertext)),
+		}
+		r.GaloisKeys = append(r.GaloisKeys, size)
+		r.GaloisKeysDiskBytes += size.DiskBytes
+		r.GaloisKeysMemoryBytes += size.MemoryBytes
+	}
+
+	if ctx.btpkeys != nil {
+		// A shared key set is saved as rlk.key and galks
+		if set := ctx.btpkeys.MemEvaluationKeySet; set != nil && !ctx.sharedKeys {
+			var memory int64
+			if set.RelinearizationKey != nil {
+				memory += gadgetMemorySize(set.RelinearizationKey.GadgetCiphertext)
+			}
+			for _, galk := range set.GaloisKeys {
+				memory += gadgetMemorySize(galk.GadgetCiphertext)
+			}
+			// btp.key holds a copy of btp_memset.key that is loaded into the same key set
+			r.BootstrappingKeys = append(r.BootstrappingKeys,
+				keyArtifactSize("btp.key", set.BinarySize(), 0),
+				keyArtifactSize("btp_memset.key", set.BinarySize(), memory))
+		}
+		for name, evk := range btpEvaluationKeys(ctx.btpkeys) {
+			if *evk != nil {
+				r.BootstrappingKeys = append(r.BootstrappingKeys, keyArtifactSize(name+".key", (*evk).BinarySize(), gadgetMemorySize((*evk).GadgetCiphertext)))
+			}
+		}
+		sortArtifactSizes(r.BootstrappingKeys)
+
+		for _, size := range r.BootstrappingKeys {
+			r.BootstrappingKeysDiskBytes += size.DiskBytes
+			r.BootstrappingKeysMemoryBytes += size.MemoryBytes
+		}
+	}
+
+	for _, size := range []ArtifactSize{r.Params, r.BtParams, r.SecretKey, r.PublicKey, r.RelinearizationKey} {
+		r.TotalDiskBytes += size.DiskBytes
+		r.TotalMemoryBytes += size.MemoryBytes
+	}
+	r.TotalDiskBytes += r.GaloisKeysDiskBytes + r.BootstrappingKeysDiskBytes
+	r.TotalMemoryBytes += r.GaloisKeysMemoryBytes + r.BootstrappingKeysMemoryBytes
+
+	return r, nil
+}
+
+// galoisKeyFileName returns the path of the i-th galois key relative to the SaveKeys directory.
+func galoisKeyFileName(i int) string {
+	return fmt.Sprintf("galks/galk_%d.key", i)
+}
+
+func keyArtifactSize(name string, binarySize int, memory int64) ArtifactSize {
+	return ArtifactSize{Name: name, DiskBytes: int64(keyFileHeaderSize + binarySize), MemoryBytes: memory}
+}
+
+func polyMemorySize(p ring.Poly) (size int64) {
+	for _, coeffs := range p.Coeffs {
+		size += 8 * int64(len(coeffs))
+	}
+	return
+}
+
+func polyQPMemorySize(p ringqp.Poly) int64 {
+	return polyMemorySize(p.Q) + polyMemorySize(p.P)
+}
+
+func vectorQPMemorySize(v rlwe.VectorQP) (size int64) {
+	for _, p := range v {
+		size += polyQPMemorySize(p)
+	}
+	return
+}
+
+func gadgetMemorySize(g rlwe.GadgetCiphertext) (size int64) {
+	for _, row := range g.Value {
+		for _, v := range row {
+			size += vectorQPMemorySize(v)
+		}
+	}
+	return
+}
@@ -0,0 +1,222 @@
+package stream
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/JihunSKKU/HE-CCFD/lattigo_key"
+	"github.com/tuneinsight/lattigo/v5/core/rlwe"
+)
+
+// Client sends the requests of a Context to a Server over a connection, one at a time.
+type Client struct {
+	ctx  *lattigo_key.Context
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+	mu   sync.Mutex
+
+	// MaxFrameBytes bounds the payload of the frames read, DefaultMaxFrameBytes if it is zero.
+	MaxFrameBytes int64
+
+	// ChunkBytes is the size of the key chunks of UploadEvaluationKeys, DefaultChunkBytes
+	// if it is zero.
+	ChunkBytes int
+}
+
+// NewClient returns a Client of the server at the other end of conn, stamping its
+// frames with the fingerprint of ctx.
+func NewClient(ctx *lattigo_key.Context, conn net.Conn) *Client {
+	return &Client{
+		ctx:  ctx,
+		conn: conn,
+		r:    bufio.NewReader(conn),
+		w:    bufio.NewWriter(conn),
+	}
+}
+
+// Dial connects to the server at address on the named network, e.g. "tcp".
+func Dial(ctx *lattigo_key.Context, network, address string) (*Client, error) {
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(ctx, conn), nil
+}
+
+// Close closes the connection.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+func (c *Client) write(typ frameType, payload []byte) error {
+	return writeFrame(c.w, typ, c.ctx.Fingerprint(), payload)
+}
+
+// read reads the next frame of the server, and returns the error it reports if it is an error frame.
+func (c *Client) read() (frame, error) {
+	maxBytes := c.MaxFrameBytes
+	if maxBytes == 0 {
+		maxBytes = DefaultMaxFrameBytes
+	}
+	f, err := readFrame(c.r, maxBytes)
+	if err != nil {
+		return f, err
+	}
+	if f.typ == frameError {
+		return f, remoteError(f.payload)
+	}
+	if fp := c.ctx.Fingerprint(); f.fingerprint != fp {
+		return f, fmt.Errorf("%w: server uses parameters %s, client uses %s", lattigo_key.ErrFingerprintMismatch, f.fingerprint, fp)
+	}
+	return f, nil
+}
+
+// expect reads the next frame of the server, which must be of type typ.
+func (c *Client) expect(typ frameType) (frame, error) {
+	f, err := c.read()
+	if err == nil && f.typ != typ {
+		err = fmt.Errorf("expected a %s frame, server sent %s", typ, f.typ)
+	}
+	return f, err
+}
+
+// UploadEvaluationKeys sends the keys of resp, which the server adds to its keys for
+// the requests of this Client only, in chunks of ChunkBytes. resp is typically the answer of the Context of the client
+// to the EvaluationKeyRequest of the server.
+func (c *Client) UploadEvaluationKeys(resp *lattigo_key.EvaluationKeyResponse) error {
+	if fp := c.ctx.Fingerprint(); resp.Fingerprint != fp {
+		return fmt.Errorf("%w: evaluation key response was made under parameters %s, client uses %s", lattigo_key.ErrFingerprintMismatch, resp.Fingerprint, fp)
+	}
+
+	chunkBytes := c.ChunkBytes
+	if chunkBytes <= 0 {
+		chunkBytes = DefaultChunkBytes
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	sendKey := func(kind byte, key []byte) error {
+		for start := 0; start == 0 || start < len(key); start += chunkBytes {
+			end := start + chunkBytes
+			final := byte(0)
+			if end >= len(key) {
+				end, final = len(key), 1
+			}
+			if err := c.write(frameKeyChunk, append([]byte{kind, final}, key[start:end]...)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if len(resp.RelinearizationKey) != 0 {
+		if err := sendKey(keyKindRelinearization, resp.RelinearizationKey); err != nil {
+			return err
+		}
+	}
+	for _, galk := range resp.GaloisKeys {
+		if err := sendKey(keyKindGalois, galk); err != nil {
+			return err
+		}
+	}
+	if err := c.write(frameKeyDone, nil); err != nil {
+		return err
+	}
+	if err := c.w.Flush(); err != nil {
+		return err
+	}
+
+	_, err := c.expect(frameKeyAck)
+	return err
+}
+
+// Evaluate runs the model registered under modelID on ctxt and returns its result.
+func (c *Client) Evaluate(modelID string, ctxt *lattigo_key.Ciphertext) (*lattigo_key.Ciphertext, error) {
+	if len(modelID) > 0xffff {
+		return nil, fmt.Errorf("model ID of %d bytes is too long", len(modelID))
+	}
+	ctBytes, err := ctxt.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	payload := binary.LittleEndian.AppendUint16(nil, uint16(len(modelID)))
+	payload = append(payload, modelID...)
+	payload = append(payload, ctBytes...)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.write(frameEvaluate, payload); err != nil {
+		return nil, err
+	}
+	if err := c.w.Flush(); err != nil {
+		return nil, err
+	}
+	f, err := c.expect(frameResult)
+	if err != nil {
+		return nil, err
+	}
+
+	out := new(lattigo_key.Ciphertext)
+	if err := out.UnmarshalBinary(f.payload); err != nil {
+		return nil, fmt.Errorf("invalid result of model %s: %w", modelID, err)
+	}
+	return out, nil
+}
+
+// Bootstrap has the server bootstrap the ciphertexts of ctxt, and calls fn with the
+// index in ctxt.GetData() and the result of each of them as soon as it is received,
+// in the order the server completes them. The results of the ciphertexts that
+// follow an error of fn are read but not passed to it.
+func (c *Client) Bootstrap(ctxt *lattigo_key.Ciphertext, fn func(i int, ct *rlwe.Ciphertext) error) error {
+	payload, err := ctxt.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.write(frameBootstrap, payload); err != nil {
+		return err
+	}
+	if err := c.w.Flush(); err != nil {
+		return err
+	}
+
+	var fnErr error
+	for {
+		f, err := c.read()
+		if err != nil {
+			return err
+		}
+		switch f.typ {
+		case frameBootstrapDone:
+			return fnErr
+		case frameBootstrapResult:
+		default:
+			return fmt.Errorf("expected a %s frame, server sent %s", frameBootstrapResult, f.typ)
+		}
+		if fnErr != nil {
+			continue
+		}
+
+		if len(f.payload) < 8 {
+			return fmt.Errorf("truncated %s frame", f.typ)
+		}
+		i := binary.LittleEndian.Uint64(f.payload)
+		if i >= uint64(len(ctxt.GetData())) {
+			return fmt.Errorf("server returned the result of ciphertext %d of a batch of %d", i, len(ctxt.GetData()))
+		}
+		ct := new(rlwe.Ciphertext)
+		if err := ct.UnmarshalBinary(f.payload[8:]); err != nil {
+			return fmt.Errorf("invalid result of ciphertext %d: %w", i, err)
+		}
+		fnErr = fn(int(i), ct)
+	}
+}
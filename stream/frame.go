@@ -0,0 +1,189 @@
+// Package stream evaluates on ciphertexts over a framed binary protocol on a net.Conn,
+// for the evaluation key uploads of several GB and the long bootstrapping jobs that
+// do not fit HTTP requests. A Server evaluates with the keys of a Context without its
+// secret key, and a Client uploads evaluation keys, runs models and bootstraps.
+//
+// Every message is a frame
+//
+//	magic, version, type, fingerprint, length, payload
+//
+// where magic is "HEFR", version and type are one byte, fingerprint is the Fingerprint
+// of the parameters of the sender and length is the little-endian uint64 size of the
+// payload. A frame whose fingerprint differs from the parameters of the receiver is
+// answered with an error and its content is ignored.
+//
+// The client sends
+//
+//	keyChunk     kind, final, data: a chunk of a key of an EvaluationKeyResponse, where
+//	             kind is 1 for the relinearization key and 2 for a galois key, and final
+//	             is 1 on the last chunk of the key
+//	keyDone      empty: the keys sent since the last keyDone are added to the keys the
+//	             server evaluates with for this connection only, and it answers keyAck,
+//	             or the first error of the upload as keyChunk frames are not answered
+//	evaluate     model ID length (uint16), model ID, Ciphertext: answered with result,
+//	             the Ciphertext computed by the model
+//	bootstrap    Ciphertext: answered with a bootstrapResult per ciphertext of the batch,
+//	             index (uint64) then rlwe.Ciphertext, in the order they complete, then
+//	             bootstrapDone
+//
+// and the server answers any of them but keyChunk with error, code then message, where
+// code is 1 for a fingerprint mismatch and 0 otherwise. Integers are little-endian.
+// After a frame it cannot read, e.g. of another version or larger than its limit, the
+// server answers error and closes the connection.
+package stream
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/JihunSKKU/HE-CCFD/lattigo_key"
+)
+
+// ProtocolVersion is the version of the frames written by this package.
+const ProtocolVersion = 1
+
+// frameMagic starts every frame.
+const frameMagic = "HEFR"
+
+// frameHeaderSize is the size of the header of a frame: magic, version, type, fingerprint, length.
+const frameHeaderSize = len(frameMagic) + 1 + 1 + len(lattigo_key.Fingerprint{}) + 8
+
+// DefaultMaxFrameBytes bounds the payload of a frame when MaxFrameBytes is zero.
+const DefaultMaxFrameBytes = 1 << 30
+
+// DefaultMaxUploadBytes bounds the total size of the keys of an upload when
+// Server.MaxUploadBytes is zero.
+const DefaultMaxUploadBytes = 8 << 30
+
+// DefaultChunkBytes is the size of the key chunks of Client.UploadEvaluationKeys when
+// Client.ChunkBytes is zero.
+const DefaultChunkBytes = 4 << 20
+
+type frameType uint8
+
+const (
+	frameKeyChunk frameType = iota + 1
+	frameKeyDone
+	frameKeyAck
+	frameEvaluate
+	frameResult
+	frameBootstrap
+	frameBootstrapResult
+	frameBootstrapDone
+	frameError
+)
+
+func (t frameType) String() string {
+	switch t {
+	case frameKeyChunk:
+		return "keyChunk"
+	case frameKeyDone:
+		return "keyDone"
+	case frameKeyAck:
+		return "keyAck"
+	case frameEvaluate:
+		return "evaluate"
+	case frameResult:
+		return "result"
+	case frameBootstrap:
+		return "bootstrap"
+	case frameBootstrapResult:
+		return "bootstrapResult"
+	case frameBootstrapDone:
+		return "bootstrapDone"
+	case frameError:
+		return "error"
+	default:
+		return fmt.Sprintf("frameType(%d)", uint8(t))
+	}
+}
+
+// Kinds of the keys of keyChunk frames.
+const (
+	keyKindRelinearization = 1
+	keyKindGalois          = 2
+)
+
+// Codes of error frames.
+const (
+	errorCodeOther       = 0
+	errorCodeFingerprint = 1
+)
+
+// errFrameTooLarge is returned by readFrame for a payload larger than the limit, which is not read.
+var errFrameTooLarge = errors.New("frame payload too large")
+
+type frame struct {
+	typ         frameType
+	fingerprint lattigo_key.Fingerprint
+	payload     []byte
+}
+
+// writeFrame writes a frame of type typ stamped with fp.
+func writeFrame(w io.Writer, typ frameType, fp lattigo_key.Fingerprint, payload []byte) error {
+	header := make([]byte, 0, frameHeaderSize)
+	header = append(header, frameMagic...)
+	header = append(header, ProtocolVersion, byte(typ))
+	header = append(header, fp[:]...)
+	header = binary.LittleEndian.AppendUint64(header, uint64(len(payload)))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+// readFrame reads a frame whose payload is at most maxBytes.
+func readFrame(r io.Reader, maxBytes int64) (f frame, err error) {
+	header := make([]byte, frameHeaderSize)
+	if _, err = io.ReadFull(r, header); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = fmt.Errorf("truncated frame header")
+		}
+		return f, err
+	}
+	if string(header[:len(frameMagic)]) != frameMagic {
+		return f, fmt.Errorf("not a frame")
+	}
+	header = header[len(frameMagic):]
+	if version := header[0]; version != ProtocolVersion {
+		return f, fmt.Errorf("unsupported protocol version %d, expected %d", version, ProtocolVersion)
+	}
+	f.typ = frameType(header[1])
+	copy(f.fingerprint[:], header[2:])
+	length := binary.LittleEndian.Uint64(header[2+len(f.fingerprint):])
+	if length > uint64(maxBytes) {
+		return f, fmt.Errorf("%w: %s frame of %d bytes, limit is %d", errFrameTooLarge, f.typ, length, maxBytes)
+	}
+
+	f.payload = make([]byte, length)
+	if _, err = io.ReadFull(r, f.payload); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = fmt.Errorf("truncated %s frame", f.typ)
+		}
+		return f, err
+	}
+	return f, nil
+}
+
+// errorPayload returns the payload of the error frame reporting err.
+func errorPayload(err error) []byte {
+	code := byte(errorCodeOther)
+	if errors.Is(err, lattigo_key.ErrFingerprintMismatch) {
+		code = errorCodeFingerprint
+	}
+	return append([]byte{code}, err.Error()...)
+}
+
+// remoteError returns the error reported by the payload of an error frame.
+func remoteError(payload []byte) error {
+	if len(payload) == 0 {
+		return fmt.Errorf("server returned an empty error")
+	}
+	if payload[0] == errorCodeFingerprint {
+		return fmt.Errorf("%w: server returned: %s", lattigo_key.ErrFingerprintMismatch, payload[1:])
+	}
+	return fmt.Errorf("server returned: %s", payload[1:])
+}
@@ -0,0 +1,383 @@
+package stream
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/JihunSKKU/HE-CCFD/lattigo_key"
+	"github.com/JihunSKKU/HE-CCFD/lattigo_key/server"
+	"github.com/tuneinsight/lattigo/v5/core/rlwe"
+)
+
+// unreadFrameTimeout bounds the time the server tries to report a frame it could not
+// read before it closes the connection.
+const unreadFrameTimeout = time.Second
+
+// Server runs registered models on, and bootstraps, the ciphertexts of the clients
+// connected to it, with the keys of its Context and those the clients upload. The
+// keys uploaded on a connection only serve the ciphertexts of that connection.
+type Server struct {
+	ctx *lattigo_key.Context
+
+	// MaxFrameBytes bounds the payload of the frames read, DefaultMaxFrameBytes if it is zero.
+	MaxFrameBytes int64
+
+	// MaxUploadBytes bounds the total size of the keys of an upload, DefaultMaxUploadBytes
+	// if it is zero.
+	MaxUploadBytes int64
+
+	// MaxDecompressedBytes bounds the size of a ciphertext once decompressed,
+	// lattigo_key.DefaultMaxDecompressedBytes if it is zero.
+	MaxDecompressedBytes int64
+
+	// Workers is the number of ciphertexts of a batch bootstrapped at the same time,
+	// GOMAXPROCS if it is zero or negative.
+	Workers int
+
+	mu     sync.RWMutex
+	models map[string]server.Model
+}
+
+// NewServer returns a Server evaluating with the keys of ctx, with no model registered.
+func NewServer(ctx *lattigo_key.Context) *Server {
+	return &Server{
+		ctx:    ctx,
+		models: map[string]server.Model{},
+	}
+}
+
+// Register serves model under id, replacing the model registered under it if any.
+func (s *Server) Register(id string, model server.Model) {
+	if id == "" || len(id) > 0xffff {
+		panic(fmt.Sprintf("heccfd: invalid model ID %q", id))
+	}
+
+	s.mu.Lock()
+	s.models[id] = model
+	s.mu.Unlock()
+}
+
+func (s *Server) model(id string) (server.Model, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	model, ok := s.models[id]
+	return model, ok
+}
+
+// Serve serves each connection accepted on l in its own goroutine, until l is closed.
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go s.ServeConn(conn)
+	}
+}
+
+// ServeConn serves the frames of conn one after the other until the client closes it
+// or sends a frame that cannot be read, and closes conn.
+func (s *Server) ServeConn(conn net.Conn) error {
+	defer conn.Close()
+
+	maxBytes := s.MaxFrameBytes
+	if maxBytes == 0 {
+		maxBytes = DefaultMaxFrameBytes
+	}
+	sc := &serverConn{
+		Server:  s,
+		evalCtx: s.ctx,
+		r:       bufio.NewReader(conn),
+		w:       bufio.NewWriter(conn),
+	}
+
+	for {
+		f, err := readFrame(sc.r, maxBytes)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			// The stream cannot be resynchronized after a frame that was not read. The
+			// client may still be writing it, so the error is only sent if it is read soon
+			conn.SetWriteDeadline(time.Now().Add(unreadFrameTimeout))
+			sc.writeError(err)
+			return err
+		}
+		if err := sc.serveRecovered(f); err != nil {
+			return err
+		}
+	}
+}
+
+// serverConn is the state of a connection of a Server.
+type serverConn struct {
+	*Server
+	r *bufio.Reader
+	w *bufio.Writer
+
+	// The Context of the server with the keys uploaded on the connection
+	evalCtx *lattigo_key.Context
+
+	// The keys uploaded since the last keyDone frame, the chunks of the key being
+	// uploaded, the size of both and the first error of the upload
+	upload      lattigo_key.EvaluationKeyResponse
+	pending     []byte
+	uploadBytes int64
+	uploadErr   error
+}
+
+// serveRecovered is serve, with a panic met on f sent to the client as an error and
+// returned, so that it closes the connection rather than the whole server.
+func (sc *serverConn) serveRecovered(f frame) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("heccfd: %s frame: %v", f.typ, r)
+			sc.writeError(err)
+		}
+	}()
+	return sc.serve(f)
+}
+
+// serve answers f. Errors of the request are sent to the client, and only errors
+// of the connection are returned.
+func (sc *serverConn) serve(f frame) error {
+	var fpErr error
+	if fp := sc.ctx.Fingerprint(); f.fingerprint != fp {
+		fpErr = fmt.Errorf("%w: %s frame was made under parameters %s, server uses %s", lattigo_key.ErrFingerprintMismatch, f.typ, f.fingerprint, fp)
+	}
+
+	// keyChunk frames are not answered, so that the client can send a whole upload
+	// before reading; the first error of an upload answers its keyDone frame
+	if f.typ == frameKeyChunk {
+		if sc.uploadErr == nil {
+			if sc.uploadErr = fpErr; fpErr == nil {
+				sc.uploadErr = sc.keyChunk(f.payload)
+			}
+		}
+		return nil
+	}
+	if f.typ == frameKeyDone && sc.uploadErr != nil {
+		fpErr = sc.uploadErr
+	}
+	if fpErr != nil {
+		sc.resetUpload()
+		return sc.writeError(fpErr)
+	}
+
+	switch f.typ {
+	case frameKeyDone:
+		err := sc.applyUpload()
+		sc.resetUpload()
+		if err != nil {
+			return sc.writeError(err)
+		}
+		return sc.write(frameKeyAck, nil)
+
+	case frameEvaluate:
+		out, err := sc.evaluate(f.payload)
+		if err != nil {
+			return sc.writeError(err)
+		}
+		data, err := out.MarshalBinary()
+		if err != nil {
+			return sc.writeError(err)
+		}
+		return sc.write(frameResult, data)
+
+	case frameBootstrap:
+		return sc.bootstrap(f.payload)
+
+	default:
+		return sc.writeError(fmt.Errorf("unexpected %s frame", f.typ))
+	}
+}
+
+func (sc *serverConn) write(typ frameType, payload []byte) error {
+	if err := writeFrame(sc.w, typ, sc.ctx.Fingerprint(), payload); err != nil {
+		return err
+	}
+	return sc.w.Flush()
+}
+
+func (sc *serverConn) writeError(err error) error {
+	return sc.write(frameError, errorPayload(err))
+}
+
+func (sc *serverConn) resetUpload() {
+	sc.upload = lattigo_key.EvaluationKeyResponse{}
+	sc.pending = nil
+	sc.uploadBytes = 0
+	sc.uploadErr = nil
+}
+
+// keyChunk appends a chunk to the key being uploaded, which is added to the upload on its final chunk.
+func (sc *serverConn) keyChunk(payload []byte) error {
+	if len(payload) < 2 {
+		return fmt.Errorf("truncated keyChunk frame")
+	}
+	kind, final, data := payload[0], payload[1] == 1, payload[2:]
+	if kind != keyKindRelinearization && kind != keyKindGalois {
+		return fmt.Errorf("unknown key kind %d", kind)
+	}
+
+	maxBytes := sc.MaxUploadBytes
+	if maxBytes == 0 {
+		maxBytes = DefaultMaxUploadBytes
+	}
+	if sc.uploadBytes += int64(len(data)); sc.uploadBytes > maxBytes {
+		return fmt.Errorf("upload larger than %d bytes", maxBytes)
+	}
+
+	sc.pending = append(sc.pending, data...)
+	if !final {
+		return nil
+	}
+	if kind == keyKindRelinearization {
+		sc.upload.RelinearizationKey = sc.pending
+	} else {
+		sc.upload.GaloisKeys = append(sc.upload.GaloisKeys, sc.pending)
+	}
+	sc.pending = nil
+	return nil
+}
+
+func (sc *serverConn) applyUpload() error {
+	if sc.pending != nil {
+		return fmt.Errorf("keyDone frame before the final chunk of a key")
+	}
+	sc.upload.Fingerprint = sc.ctx.Fingerprint()
+
+	evalCtx, err := sc.evalCtx.WithEvaluationKeyResponse(&sc.upload)
+	if err != nil {
+		return err
+	}
+	sc.evalCtx = evalCtx
+	return nil
+}
+
+func (sc *serverConn) evaluate(payload []byte) (*lattigo_key.Ciphertext, error) {
+	if len(payload) < 2 {
+		return nil, fmt.Errorf("truncated evaluate frame")
+	}
+	n := int(binary.LittleEndian.Uint16(payload))
+	if len(payload) < 2+n {
+		return nil, fmt.Errorf("truncated evaluate frame")
+	}
+	id := string(payload[2 : 2+n])
+	model, ok := sc.model(id)
+	if !ok {
+		return nil, fmt.Errorf("unknown model %q", id)
+	}
+
+	in := new(lattigo_key.Ciphertext)
+	if err := in.UnmarshalBinaryWithOptions(payload[2+n:], lattigo_key.DecodeOptions{MaxDecompressedBytes: sc.MaxDecompressedBytes}); err != nil {
+		return nil, fmt.Errorf("invalid ciphertext: %w", err)
+	}
+	if err := checkCiphertext(sc.ctx, in); err != nil {
+		return nil, err
+	}
+
+	out, err := model.Evaluate(sc.evalCtx, in)
+	if err != nil {
+		return nil, fmt.Errorf("model %s: %w", id, err)
+	}
+	return out, nil
+}
+
+// bootstrap bootstraps the ciphertexts of the batch of payload on Workers goroutines
+// and sends each result as soon as it is ready.
+func (sc *serverConn) bootstrap(payload []byte) error {
+	in := new(lattigo_key.Ciphertext)
+	if err := in.UnmarshalBinaryWithOptions(payload, lattigo_key.DecodeOptions{MaxDecompressedBytes: sc.MaxDecompressedBytes}); err != nil {
+		return sc.writeError(fmt.Errorf("invalid ciphertext: %w", err))
+	}
+	if err := checkCiphertext(sc.ctx, in); err != nil {
+		return sc.writeError(err)
+	}
+
+	workers := sc.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	type result struct {
+		i   int
+		ct  *rlwe.Ciphertext
+		err error
+	}
+	data := in.GetData()
+	results := make(chan result)
+	sem := make(chan struct{}, workers)
+
+	go func() {
+		for i, ct := range data {
+			sem <- struct{}{}
+			go func(i int, ct *rlwe.Ciphertext) {
+				defer func() { <-sem }()
+				out, err := bootstrapRecovered(sc.evalCtx, ct)
+				results <- result{i, out, err}
+			}(i, ct)
+		}
+	}()
+
+	// All the results are received, so that no goroutine is left behind
+	var bootstrapErr, connErr error
+	for range data {
+		r := <-results
+		if bootstrapErr != nil || connErr != nil {
+			continue
+		}
+		if r.err != nil {
+			bootstrapErr = fmt.Errorf("ciphertext %d: %w", r.i, r.err)
+			continue
+		}
+		ctBytes, err := r.ct.MarshalBinary()
+		if err != nil {
+			bootstrapErr = fmt.Errorf("ciphertext %d: %w", r.i, err)
+			continue
+		}
+		connErr = sc.write(frameBootstrapResult, append(binary.LittleEndian.AppendUint64(nil, uint64(r.i)), ctBytes...))
+	}
+
+	if connErr != nil {
+		return connErr
+	}
+	if bootstrapErr != nil {
+		return sc.writeError(bootstrapErr)
+	}
+	return sc.write(frameBootstrapDone, nil)
+}
+
+// bootstrapRecovered is ctx.Bootstrap with a panic returned as an error, as it runs on
+// a goroutine that serveRecovered does not cover.
+func bootstrapRecovered(ctx *lattigo_key.Context, ct *rlwe.Ciphertext) (out *rlwe.Ciphertext, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("heccfd: bootstrapping: %v", r)
+		}
+	}()
+	return ctx.Bootstrap(ct)
+}
+
+// checkCiphertext returns an error if ct was made under other parameters than ctx, has
+// no fingerprint and cannot be matched to them, or is of another shape than them, on
+// which the models and the bootstrapping would panic on goroutines of their own.
+func checkCiphertext(ctx *lattigo_key.Context, ct *lattigo_key.Ciphertext) error {
+	if err := ctx.CheckCiphertext(ct); err != nil {
+		if errors.Is(err, lattigo_key.ErrFingerprintMismatch) {
+			return err
+		}
+		return fmt.Errorf("invalid ciphertext: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,312 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/JihunSKKU/HE-CCFD/lattigo_key"
+	"github.com/JihunSKKU/HE-CCFD/lattigo_key/cli"
+)
+
+// runKeyTool runs the hekeys command line args and returns its output.
+func runKeyTool(args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	err := cli.Run(args, &stdout, &stderr)
+	return stdout.String(), err
+}
+
+func TestKeyTool(t *testing.T) {
+	tmp := t.TempDir()
+	keys := filepath.Join(tmp, "keys")
+
+	out, err := runKeyTool("gen", "-preset", "insecure-n10", "-insecure", "-seed-compressed", "-codec", "zstd", "-out", keys)
+	if err != nil {
+		t.Fatalf("Failed to generate keys: %v", err)
+	}
+	params, btparams := initTestBtParams()
+	fp, err := lattigo_key.NewFingerprint(params, btparams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, fp.String()) {
+		t.Fatalf("gen output does not hold the fingerprint of the preset:\n%s", out)
+	}
+
+	// gen does not replace a directory unless asked to
+	if _, err := runKeyTool("gen", "-preset", "insecure-n10", "-insecure", "-out", keys); err == nil {
+		t.Fatal("gen replaced an existing directory")
+	}
+	if _, err := runKeyTool("gen", "-preset", "unknown", "-out", filepath.Join(tmp, "unknown")); err == nil {
+		t.Fatal("gen accepted an unknown preset")
+	}
+	if _, err := runKeyTool("unknown"); !errors.Is(err, cli.ErrUsage) {
+		t.Fatalf("Expected a usage error for an unknown command, got %v", err)
+	}
+
+	out, err = runKeyTool("inspect", keys)
+	if err != nil {
+		t.Fatalf("Failed to inspect keys: %v", err)
+	}
+	for _, want := range []string{fp.String(), "LogN 10", "Secret key     present", "galks/", "zstd, seed-compressed"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("inspect output does not hold %q:\n%s", want, out)
+		}
+	}
+
+	if out, err = runKeyTool("verify", "-galois-samples", "4", keys); err != nil {
+		t.Fatalf("Failed to verify keys: %v\n%s", err, out)
+	}
+
+	// A parameter file of the same parameters gives the same fingerprint
+	paramsFile := filepath.Join(tmp, "params.json")
+	config := `{
+		"params": {"LogN": 10, "LogQ": [60, 40, 40, 40, 40, 40], "LogP": [61, 61], "LogDefaultScale": 40, "RingType": "Standard"},
+		"btparams": {"LogN": 10, "LogMessageRatio": 14}
+	}`
+	if err := os.WriteFile(paramsFile, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fileKeys := filepath.Join(tmp, "file-keys")
+	if out, err = runKeyTool("gen", "-params", paramsFile, "-insecure", "-seed", "0123456789abcdef", "-out", fileKeys); err != nil {
+		t.Fatalf("Failed to generate keys from a parameter file: %v", err)
+	}
+	if !strings.Contains(out, fp.String()) {
+		t.Fatalf("Keys of the parameter file have another fingerprint:\n%s", out)
+	}
+
+	// Misspelled parameters are not replaced by their defaults
+	if err := os.WriteFile(paramsFile, []byte(`{"params": {"LogN": 10, "LogQ": [60, 40], "LogP": [61]}, "btparams": {"LogNN": 10}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runKeyTool("gen", "-params", paramsFile, "-insecure", "-out", filepath.Join(tmp, "misspelled")); err == nil {
+		t.Fatal("gen accepted a misspelled parameter")
+	}
+
+	// Keys of another secret key are detected
+	galk := filepath.Join("galks", "galk_0.key")
+	data, err := os.ReadFile(filepath.Join(fileKeys, galk))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mixed := filepath.Join(tmp, "mixed")
+	if _, err := runKeyTool("convert", "-out", mixed, keys); err != nil {
+		t.Fatalf("Failed to convert keys: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(mixed, galk), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runKeyTool("verify", "-skip-bootstrap", mixed); !errors.Is(err, lattigo_key.ErrInconsistentKeys) {
+		t.Fatalf("Expected inconsistent keys, got %v", err)
+	}
+
+	public := filepath.Join(tmp, "public")
+	if _, err := runKeyTool("export-public", "-codec", "gzip", "-out", public, keys); err != nil {
+		t.Fatalf("Failed to export the public keys: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(public, "sk.key")); !os.IsNotExist(err) {
+		t.Fatal("Exported keys hold the secret key")
+	}
+	if out, err = runKeyTool("verify", public); err != nil {
+		t.Fatalf("Failed to verify the exported keys: %v", err)
+	}
+	if !strings.Contains(out, "has no secret key") {
+		t.Fatalf("verify output of the exported keys:\n%s", out)
+	}
+
+	// Memory-mapped keys converted back to seed-compressed files lose their seeds
+	mapped := filepath.Join(tmp, "mapped")
+	if out, err = runKeyTool("convert", "-mapped", "-out", mapped, keys); err != nil {
+		t.Fatalf("Failed to convert keys: %v", err)
+	}
+	if !strings.Contains(out, "galks.mkeys") || !strings.Contains(out, fp.String()) {
+		t.Fatalf("inspect output of the converted keys:\n%s", out)
+	}
+	if _, err := runKeyTool("verify", "-galois-samples", "4", "-skip-bootstrap", mapped); err != nil {
+		t.Fatalf("Failed to verify the converted keys: %v", err)
+	}
+	failed := filepath.Join(tmp, "failed")
+	if _, err := runKeyTool("convert", "-seed-compressed", "-out", failed, mapped); err == nil {
+		t.Fatal("Converted keys without seeds to seed-compressed keys")
+	}
+	if _, err := os.Stat(failed); !os.IsNotExist(err) {
+		t.Fatal("A failed conversion left its directory")
+	}
+	if _, err := runKeyTool("convert", "-out", keys, keys); !errors.Is(err, cli.ErrUsage) {
+		t.Fatalf("Expected a usage error when converting a directory onto itself, got %v", err)
+	}
+}
+
+func TestKeyToolData(t *testing.T) {
+	tmp := t.TempDir()
+	keys := filepath.Join(tmp, "keys")
+	public := filepath.Join(tmp, "public")
+	if _, err := runKeyTool("gen", "-preset", "insecure-n10", "-insecure", "-out", keys); err != nil {
+		t.Fatalf("Failed to generate keys: %v", err)
+	}
+	if _, err := runKeyTool("export-public", "-out", public, keys); err != nil {
+		t.Fatalf("Failed to export the public keys: %v", err)
+	}
+
+	samples := [][]float64{
+		{0.1, -0.2, 0.3, 0.05},
+		{-0.5, 0.25, 0.75, -0.1},
+		{0.9, 0.9, -0.9, 0.0},
+	}
+	csvPath := filepath.Join(tmp, "samples.csv")
+	content := "amount, age, velocity, distance\n"
+	for _, x := range samples {
+		var fields []string
+		for _, v := range x {
+			fields = append(fields, strconv.FormatFloat(v, 'g', -1, 64))
+		}
+		content += strings.Join(fields, ", ") + "\n"
+	}
+	if err := os.WriteFile(csvPath, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	model := &lattigo_key.MLP{Layers: []lattigo_key.DenseLayer{
+		{
+			Weights:    [][]float64{{0.5, -0.25, 0.125, 0.25}, {-0.5, 0.5, 0.25, 0.1}},
+			Bias:       []float64{0.1, -0.1},
+			Activation: []float64{0, 1, 0.5},
+		},
+		{
+			Weights: [][]float64{{0.75, -0.5}},
+			Bias:    []float64{0.05},
+		},
+	}}
+	modelPath := filepath.Join(tmp, "model.json")
+	if err := model.Save(modelPath); err != nil {
+		t.Fatal(err)
+	}
+
+	// Encryption and evaluation only need the public keys
+	batch := filepath.Join(tmp, "samples.ct")
+	scores := filepath.Join(tmp, "scores.ct")
+	if _, err := runKeyTool("encrypt", "-keys", public, "-in", csvPath, "-out", batch, "-header", "-codec", "zstd"); err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+	if _, err := runKeyTool("eval", "-keys", public, "-model", modelPath, "-in", batch, "-out", scores); err != nil {
+		t.Fatalf("Failed to evaluate: %v", err)
+	}
+	if _, err := runKeyTool("decrypt", "-keys", public, "-in", scores, "-out", filepath.Join(tmp, "public.csv")); err == nil {
+		t.Fatal("Decrypted with the public keys")
+	}
+
+	readRows := func(path string) [][]float64 {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var rows [][]float64
+		for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+			var row []float64
+			for _, field := range strings.Split(line, ",") {
+				v, err := strconv.ParseFloat(field, 64)
+				if err != nil {
+					t.Fatal(err)
+				}
+				row = append(row, v)
+			}
+			rows = append(rows, row)
+		}
+		return rows
+	}
+
+	scoresCSV := filepath.Join(tmp, "scores.csv")
+	if _, err := runKeyTool("decrypt", "-keys", keys, "-in", scores, "-out", scoresCSV); err != nil {
+		t.Fatalf("Failed to decrypt: %v", err)
+	}
+	have := readRows(scoresCSV)
+	if len(have) != len(samples) {
+		t.Fatalf("Decrypted %d scores for %d samples", len(have), len(samples))
+	}
+	for i, x := range samples {
+		want := model.Evaluate(x)
+		if len(have[i]) != len(want) {
+			t.Fatalf("Sample %d has %d outputs, expected %d", i, len(have[i]), len(want))
+		}
+		for j := range want {
+			if math.Abs(have[i][j]-want[j]) > lattigo_key.MLPTolerance {
+				t.Fatalf("Sample %d scored %v, expected %v", i, have[i], want)
+			}
+		}
+	}
+
+	// Packed batches decrypt back to the samples
+	packed := filepath.Join(tmp, "packed.ct")
+	if _, err := runKeyTool("encrypt", "-keys", public, "-in", csvPath, "-out", packed, "-header", "-packed"); err != nil {
+		t.Fatalf("Failed to encrypt packed samples: %v", err)
+	}
+	packedCSV := filepath.Join(tmp, "packed.csv")
+	if _, err := runKeyTool("decrypt", "-keys", keys, "-in", packed, "-out", packedCSV, "-precision", "9"); err != nil {
+		t.Fatalf("Failed to decrypt packed samples: %v", err)
+	}
+	have = readRows(packedCSV)
+	for i, x := range samples {
+		for j, v := range x {
+			if math.Abs(have[i][j]-v) > 1e-6 {
+				t.Fatalf("Sample %d decrypted to %v, expected %v", i, have[i], x)
+			}
+		}
+	}
+
+	// Symmetric batches need the secret key and decrypt back to the samples, at any level
+	symmetric := filepath.Join(tmp, "symmetric.ct")
+	if _, err := runKeyTool("encrypt", "-keys", public, "-in", csvPath, "-out", symmetric, "-header", "-symmetric"); err == nil {
+		t.Fatal("Encrypted symmetrically without the secret key")
+	}
+	if _, err := runKeyTool("encrypt", "-keys", keys, "-in", csvPath, "-out", symmetric, "-header", "-symmetric", "-level", "99"); !errors.Is(err, cli.ErrUsage) {
+		t.Fatalf("Expected a usage error for a level above the parameters, got %v", err)
+	}
+	if _, err := runKeyTool("encrypt", "-keys", keys, "-in", csvPath, "-out", symmetric, "-header", "-packed", "-symmetric", "-level", "1"); err != nil {
+		t.Fatalf("Failed to encrypt symmetrically: %v", err)
+	}
+	symmetricCSV := filepath.Join(tmp, "symmetric.csv")
+	if _, err := runKeyTool("decrypt", "-keys", keys, "-in", symmetric, "-out", symmetricCSV, "-precision", "9"); err != nil {
+		t.Fatalf("Failed to decrypt symmetric samples: %v", err)
+	}
+	have = readRows(symmetricCSV)
+	for i, x := range samples {
+		for j, v := range x {
+			if math.Abs(have[i][j]-v) > 1e-6 {
+				t.Fatalf("Sample %d decrypted to %v, expected %v", i, have[i], x)
+			}
+		}
+	}
+
+	// Malformed CSV files are refused before any key is loaded
+	if err := os.WriteFile(csvPath, []byte("0.1, 0.2\n0.3, x\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runKeyTool("encrypt", "-keys", public, "-in", csvPath, "-out", batch); err == nil || !strings.Contains(err.Error(), "not a number") {
+		t.Fatalf("Expected an error on a non-numeric value, got %v", err)
+	}
+	if err := os.WriteFile(csvPath, []byte("0.1, 0.2\n0.3\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runKeyTool("encrypt", "-keys", public, "-in", csvPath, "-out", batch); err == nil {
+		t.Fatal("Encrypted rows of different sizes")
+	}
+
+	// Batches of other parameters are refused
+	other := filepath.Join(tmp, "other")
+	paramsFile := filepath.Join(tmp, "params.json")
+	config := `{"params": {"LogN": 10, "LogQ": [60, 40, 40, 40, 40, 40], "LogP": [61, 61], "LogDefaultScale": 39}, "btparams": {"LogN": 10}}`
+	if err := os.WriteFile(paramsFile, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runKeyTool("gen", "-params", paramsFile, "-insecure", "-out", other); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runKeyTool("decrypt", "-keys", other, "-in", scores, "-out", scoresCSV); !errors.Is(err, lattigo_key.ErrFingerprintMismatch) {
+		t.Fatalf("Expected a fingerprint mismatch, got %v", err)
+	}
+}
@@ -0,0 +1,177 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/JihunSKKU/HE-CCFD/lattigo_key"
+	"github.com/tuneinsight/lattigo/v5/core/rlwe"
+	"github.com/tuneinsight/lattigo/v5/he/hefloat"
+)
+
+func TestCompression(t *testing.T) {
+	params, btparams := initTestBtParams()
+	ctx := newTestContext(params, btparams)
+
+	dirPath := filepath.Join(t.TempDir(), "keys")
+	opts := lattigo_key.SaveOptions{
+		SeedCompressed: true,
+		Codec:          lattigo_key.CodecZstd,
+		ArtifactCodecs: map[string]lattigo_key.Codec{
+			"galks/":  lattigo_key.CodecGzip,
+			"params":  lattigo_key.CodecNone,
+			"rlk.key": lattigo_key.CodecNone,
+		},
+	}
+	if err := ctx.SaveKeysWithOptions(dirPath, opts); err != nil {
+		t.Fatalf("Failed to save keys: %v", err)
+	}
+
+	// The codec follows the key file header of 4 + 32 bytes
+	for name, want := range map[string]string{
+		"params":           "",
+		"btparams":         "HEZC\x02",
+		"rlk.key":          "",
+		"pk.key":           "HEZC\x02",
+		"galks/galk_0.key": "HEZC\x01",
+	} {
+		data, err := os.ReadFile(filepath.Join(dirPath, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.HasSuffix(name, ".key") {
+			data = data[36:]
+		}
+		if compressed := bytes.HasPrefix(data, []byte("HEZC")); compressed != (want != "") || compressed && !bytes.HasPrefix(data, []byte(want)) {
+			t.Errorf("%s starts with %q, expected codec header %q", name, data[:5], want)
+		}
+	}
+
+	loaded, err := lattigo_key.LoadKeys(dirPath)
+	if err != nil {
+		t.Fatalf("Failed to load compressed keys: %v", err)
+	}
+	report, err := loaded.Validate(lattigo_key.ValidateOptions{})
+	if err != nil {
+		t.Fatalf("Failed to validate keys: %v", err)
+	}
+	if !report.OK() {
+		t.Fatalf("Decompressed keys are inconsistent:\n%s", report)
+	}
+
+	// Ciphertexts, in memory and streamed through a pipe
+	ctxt := ctx.Encrypt(lattigo_key.NewPlaintext([][]float64{{1, 2, 3}, {4, 5, 6}}))
+	for _, codec := range []lattigo_key.Codec{lattigo_key.CodecNone, lattigo_key.CodecGzip, lattigo_key.CodecZstd} {
+		data, err := ctxt.MarshalBinaryCompressed(codec)
+		if err != nil {
+			t.Fatalf("%s: failed to compress ciphertext: %v", codec, err)
+		}
+		decoded := new(lattigo_key.Ciphertext)
+		if err := decoded.UnmarshalBinary(data); err != nil {
+			t.Fatalf("%s: failed to decompress ciphertext: %v", codec, err)
+		}
+		checkCiphertextValues(t, ctx, decoded, [][]float64{{1, 2, 3}, {4, 5, 6}})
+
+		r, w := io.Pipe()
+		go func() {
+			_, err := ctxt.WriteCompressedTo(w, codec)
+			w.CloseWithError(err)
+		}()
+		streamed := new(lattigo_key.Ciphertext)
+		if _, err := streamed.ReadCompressedFrom(r); err != nil {
+			t.Fatalf("%s: failed to stream ciphertext: %v", codec, err)
+		}
+		checkCiphertextValues(t, ctx, streamed, [][]float64{{1, 2, 3}, {4, 5, 6}})
+
+		// Ciphertexts larger than the limit once decompressed are refused
+		limit := lattigo_key.DecodeOptions{MaxDecompressedBytes: int64(ctxt.BinarySize()) - 1}
+		if err := new(lattigo_key.Ciphertext).UnmarshalBinaryWithOptions(data, limit); !errors.Is(err, lattigo_key.ErrDecompressedTooLarge) {
+			t.Fatalf("%s: decoding past the limit returned %v", codec, err)
+		}
+		if _, err := new(lattigo_key.Ciphertext).ReadCompressedFromWithOptions(bytes.NewReader(data), limit); !errors.Is(err, lattigo_key.ErrDecompressedTooLarge) {
+			t.Fatalf("%s: streaming past the limit returned %v", codec, err)
+		}
+		limit.MaxDecompressedBytes++
+		if err := new(lattigo_key.Ciphertext).UnmarshalBinaryWithOptions(data, limit); err != nil {
+			t.Fatalf("%s: failed to decode at the limit: %v", codec, err)
+		}
+	}
+}
+
+func checkCiphertextValues(t *testing.T, ctx *lattigo_key.Context, ctxt *lattigo_key.Ciphertext, want [][]float64) {
+	have := ctx.Decrypt(ctxt).GetData()
+	for i := range want {
+		for j := range want[i] {
+			if diff := have[i][j] - want[i][j]; diff > 1e-6 || diff < -1e-6 {
+				t.Fatalf("Sample %d feature %d: decrypted %f, expected %f", i, j, have[i][j], want[i][j])
+			}
+		}
+	}
+}
+
+// BenchmarkCompression compresses and decompresses the public key, relinearization
+// key, one galois key and one ciphertext of each parameter set with each codec.
+// The compressed size relative to the raw size is reported as "ratio".
+func BenchmarkCompression(b *testing.B) {
+	paramSets := map[string]func() hefloat.Parameters{
+		"test":   func() hefloat.Parameters { params, _ := initTestBtParams(); return params },
+		"params": initParams,
+		"btp":    func() hefloat.Parameters { params, _ := initBtParams(); return params },
+	}
+
+	for _, set := range []string{"test", "params", "btp"} {
+		params := paramSets[set]()
+		kgen := rlwe.NewKeyGenerator(params)
+		sk, pk := kgen.GenKeyPairNew()
+		ct := rlwe.NewEncryptor(params, pk).EncryptZeroNew(params.MaxLevel())
+
+		artifacts := map[string]interface{ MarshalBinary() ([]byte, error) }{
+			"pk":   pk,
+			"rlk":  kgen.GenRelinearizationKeyNew(sk),
+			"galk": kgen.GenGaloisKeyNew(params.GaloisElement(1), sk),
+			"ctxt": ct,
+		}
+		for _, artifact := range []string{"pk", "rlk", "galk", "ctxt"} {
+			data, err := artifacts[artifact].MarshalBinary()
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			for _, codec := range []lattigo_key.Codec{lattigo_key.CodecGzip, lattigo_key.CodecZstd} {
+				b.Run(fmt.Sprintf("%s/%s/%s", set, artifact, codec), func(b *testing.B) {
+					b.SetBytes(int64(len(data)))
+					var compressed bytes.Buffer
+					for i := 0; i < b.N; i++ {
+						compressed.Reset()
+						w, err := lattigo_key.NewCompressWriter(&compressed, codec)
+						if err != nil {
+							b.Fatal(err)
+						}
+						if _, err = w.Write(data); err != nil {
+							b.Fatal(err)
+						}
+						if err = w.Close(); err != nil {
+							b.Fatal(err)
+						}
+
+						r, err := lattigo_key.NewDecompressReader(bytes.NewReader(compressed.Bytes()))
+						if err != nil {
+							b.Fatal(err)
+						}
+						if _, err = io.Copy(io.Discard, r); err != nil {
+							b.Fatal(err)
+						}
+						r.Close()
+					}
+					b.ReportMetric(float64(compressed.Len())/float64(len(data)), "ratio")
+				})
+			}
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/JihunSKKU/HE-CCFD/lattigo_key"
+	"github.com/tuneinsight/lattigo/v5/ring"
+)
+
+func TestParametersConfig(t *testing.T) {
+	params, btparams := initTestBtParams()
+	want, err := lattigo_key.NewFingerprint(params, btparams)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"params.json": `{
+			"params": {"LogN": 10, "LogQ": [60, 40, 40, 40, 40, 40], "LogP": [61, 61], "LogDefaultScale": 40, "RingType": "Standard"},
+			"btparams": {"LogN": 10, "LogMessageRatio": 14, "Xs": {"Type": "Ternary", "H": 192}}
+		}`,
+		"params.yaml": `
+params:
+  LogN: 10
+  LogQ: [60, 40, 40, 40, 40, 40]
+  LogP: [61, 61]
+  LogDefaultScale: 40
+  RingType: Standard
+btparams:
+  LogN: 10
+  LogMessageRatio: 14
+  Xs:
+    Type: Ternary
+    H: 192
+`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		config, err := lattigo_key.LoadParametersConfig(path)
+		if err != nil {
+			t.Fatalf("Failed to load %s: %v", name, err)
+		}
+		if xs, ok := config.BtParams.Xs.(ring.Ternary); !ok || xs.H != 192 {
+			t.Fatalf("%s: btparams Xs is %v", name, config.BtParams.Xs)
+		}
+		p, b, err := config.NewParameters()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if have, _ := lattigo_key.NewFingerprint(p, b); have != want {
+			t.Fatalf("%s gives parameters %s, expected %s", name, have, want)
+		}
+	}
+
+	// Misspelled fields are refused in both formats
+	for name, content := range map[string]string{
+		"misspelled.json": `{"params": {"LogN": 10, "LogQ": [60, 40], "LogP": [61]}, "btparam": {"LogN": 10}}`,
+		"misspelled.yml":  "params: {LogN: 10, LogQ: [60, 40], LogP: [61]}\nbtparams: {LogNN: 10}\n",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := lattigo_key.LoadParametersConfig(path); err == nil || !strings.Contains(err.Error(), "unknown field") {
+			t.Fatalf("%s: expected an unknown field error, got %v", name, err)
+		}
+	}
+
+	// Every preset meets its targets
+	for _, preset := range lattigo_key.Presets() {
+		if err := preset.Check(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := lattigo_key.Preset(preset.Name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	config, err := lattigo_key.Preset("insecure-n10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, b, err := config.NewParameters()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, _ := lattigo_key.NewFingerprint(p, b); have != want {
+		t.Fatalf("insecure-n10 gives parameters %s, expected %s", have, want)
+	}
+	if _, err := lattigo_key.Preset("unknown"); err == nil {
+		t.Fatal("Found an unknown preset")
+	}
+
+	// The test parameters are far from any security level
+	bound, err := lattigo_key.MaxLogQP(params.LogN(), 128)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params.LogQP() <= bound {
+		t.Fatalf("LogQP %.1f of the test parameters is within the 128-bit bound %.0f", params.LogQP(), bound)
+	}
+	if _, err := lattigo_key.MaxLogQP(params.LogN(), 100); err == nil {
+		t.Fatal("Found a bound for 100-bit security")
+	}
+	if precision := lattigo_key.EncryptionPrecision(params); precision < 20 || precision > float64(params.LogDefaultScale()) {
+		t.Fatalf("Fresh encryptions of the test parameters have %.1f bits of precision", precision)
+	}
+}
@@ -0,0 +1,99 @@
+package test
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/JihunSKKU/HE-CCFD/lattigo_key"
+)
+
+func TestEvaluationKeyExchange(t *testing.T) {
+	params, btparams := initTestBtParams()
+	client := newTestContext(params, btparams)
+	server, err := lattigo_key.NewEvaluationContext(params, btparams)
+	if err != nil {
+		t.Fatalf("Failed to create evaluation context: %v", err)
+	}
+	if server.Fingerprint() != client.Fingerprint() {
+		t.Fatal("Server and client fingerprints differ")
+	}
+
+	// Rotations by 5 and 5 - slots share their key, 100 is not in genRots
+	rots := []int{1, 5, 5 - params.MaxSlots(), 100}
+	req := server.NewEvaluationKeyRequest(rots)
+	if len(req.Rotations) != 3 || !req.Relinearization {
+		t.Fatalf("Request for %v asks for rotations %v and relinearization %v", rots, req.Rotations, req.Relinearization)
+	}
+
+	reqBytes, err := req.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var received lattigo_key.EvaluationKeyRequest
+	if err := received.UnmarshalBinary(reqBytes); err != nil {
+		t.Fatalf("Failed to unmarshal request: %v", err)
+	}
+
+	resp, err := client.RespondEvaluationKeys(&received, true)
+	if err != nil {
+		t.Fatalf("Failed to respond to request: %v", err)
+	}
+	if len(resp.GaloisKeys) != 3 || resp.RelinearizationKey == nil {
+		t.Fatalf("Response holds %d galois keys and relinearization key %v", len(resp.GaloisKeys), resp.RelinearizationKey != nil)
+	}
+	respBytes, err := resp.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sent lattigo_key.EvaluationKeyResponse
+	if err := sent.UnmarshalBinary(respBytes); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if err := new(lattigo_key.EvaluationKeyResponse).UnmarshalBinary(respBytes[:len(respBytes)-1]); err == nil {
+		t.Fatal("Unmarshalled a truncated response")
+	}
+	if err := server.ApplyEvaluationKeyResponse(&sent); err != nil {
+		t.Fatalf("Failed to apply response: %v", err)
+	}
+
+	// The server now has every key it asked for
+	if again := server.NewEvaluationKeyRequest(rots); !again.Empty() {
+		t.Fatalf("Second request is not empty: %v", again.Rotations)
+	}
+
+	values := make([]float64, 8)
+	for i := range values {
+		values[i] = float64(i + 1)
+	}
+	ctxt := client.Encrypt(lattigo_key.NewPlaintext([][]float64{values}))
+	for _, rot := range rots {
+		if err := server.Rotation(ctxt.GetData()[0], rot, ctxt.GetData()[0]); err != nil {
+			t.Fatalf("Server failed to rotate by %d: %v", rot, err)
+		}
+	}
+	slots := params.MaxSlots()
+	shift := 0
+	for _, rot := range rots {
+		shift += rot
+	}
+	decrypted := client.Decrypt(ctxt).GetData()[0]
+	for i, v := range values {
+		j := ((i-shift)%slots + slots) % slots
+		if math.Abs(decrypted[j]-v) > 1e-3 {
+			t.Fatalf("Slot %d is %f after rotating by %d, expected %f", j, decrypted[j], shift, v)
+		}
+	}
+
+	// Keys of other parameters are refused on both sides
+	other := *req
+	other.Fingerprint[0] ^= 1
+	if _, err := client.RespondEvaluationKeys(&other, false); !errors.Is(err, lattigo_key.ErrFingerprintMismatch) {
+		t.Fatalf("Expected a fingerprint mismatch, got %v", err)
+	}
+	otherResp := *resp
+	otherResp.Fingerprint[0] ^= 1
+	if err := server.ApplyEvaluationKeyResponse(&otherResp); !errors.Is(err, lattigo_key.ErrFingerprintMismatch) {
+		t.Fatalf("Expected a fingerprint mismatch, got %v", err)
+	}
+}
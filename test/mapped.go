@@ -0,0 +1,108 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/JihunSKKU/HE-CCFD/lattigo_key"
+	"github.com/tuneinsight/lattigo/v5/he/hefloat"
+	"github.com/tuneinsight/lattigo/v5/he/hefloat/bootstrapping"
+	"github.com/tuneinsight/lattigo/v5/utils"
+)
+
+func TestMemoryMappedKeys(t *testing.T) {
+	params, btparams := initTestBtParams()
+	ctx := newTestContext(params, btparams)
+
+	dirPath := filepath.Join(t.TempDir(), "keys")
+	if err := ctx.SaveKeysWithOptions(dirPath, lattigo_key.SaveOptions{MemoryMapped: true}); err != nil {
+		t.Fatalf("Failed to save mapped keys: %v", err)
+	}
+	if galks, _ := os.ReadDir(filepath.Join(dirPath, "galks")); len(galks) != 0 {
+		t.Errorf("galks holds %d files next to galks.mkeys", len(galks))
+	}
+	for _, name := range []string{"galks.mkeys", "btp.mkeys"} {
+		info, err := os.Stat(filepath.Join(dirPath, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size()%4096 != 0 {
+			t.Errorf("%s is %d bytes, not a whole number of pages", name, info.Size())
+		}
+	}
+
+	loaded, err := lattigo_key.LoadKeys(dirPath)
+	if err != nil {
+		t.Fatalf("Failed to load mapped keys: %v", err)
+	}
+	report, err := loaded.Validate(lattigo_key.ValidateOptions{})
+	if err != nil {
+		t.Fatalf("Failed to validate keys: %v", err)
+	}
+	if !report.OK() {
+		t.Fatalf("Mapped keys are inconsistent:\n%s", report)
+	}
+
+	// Saving the mapped keys again gives the same files
+	resaved := filepath.Join(t.TempDir(), "keys")
+	if err := loaded.SaveKeysWithOptions(resaved, lattigo_key.SaveOptions{MemoryMapped: true}); err != nil {
+		t.Fatalf("Failed to save mapped keys again: %v", err)
+	}
+	for _, name := range []string{"galks.mkeys", "btp.mkeys"} {
+		want, err := os.ReadFile(filepath.Join(dirPath, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		have, err := os.ReadFile(filepath.Join(resaved, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(have, want) {
+			t.Errorf("%s differs when saved from mapped keys", name)
+		}
+	}
+	if err := loaded.Close(); err != nil {
+		t.Fatalf("Failed to unmap keys: %v", err)
+	}
+
+	// Truncated mapped key files and those of other parameters are refused
+	info, err := os.Stat(filepath.Join(resaved, "btp.mkeys"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(filepath.Join(resaved, "btp.mkeys"), info.Size()/2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lattigo_key.LoadKeys(resaved); err == nil || !strings.Contains(err.Error(), "btp.mkeys") {
+		t.Fatalf("Loading a truncated btp.mkeys returned %v", err)
+	}
+
+	lit := params.ParametersLiteral()
+	lit.LogDefaultScale = 39
+	otherParams, err := hefloat.NewParametersFromLiteral(hefloat.ParametersLiteral(lit))
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherBtparams, err := bootstrapping.NewParametersFromLiteral(otherParams, bootstrapping.ParametersLiteral{LogN: utils.Pointy(otherParams.LogN())})
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPath := filepath.Join(t.TempDir(), "other")
+	if err := newTestContext(otherParams, otherBtparams).SaveKeysWithOptions(otherPath, lattigo_key.SaveOptions{MemoryMapped: true}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dirPath, "galks.mkeys"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(otherPath, "galks.mkeys"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lattigo_key.LoadKeys(otherPath); !errors.Is(err, lattigo_key.ErrFingerprintMismatch) {
+		t.Fatalf("Expected a fingerprint mismatch, got %v", err)
+	}
+}
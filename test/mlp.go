@@ -0,0 +1,80 @@
+package test
+
+import (
+	"math"
+	"math/rand"
+	"path/filepath"
+	"testing"
+
+	"github.com/JihunSKKU/HE-CCFD/lattigo_key"
+)
+
+func randomLayer(out, in int, activation []float64) lattigo_key.DenseLayer {
+	layer := lattigo_key.DenseLayer{
+		Weights:    make([][]float64, out),
+		Bias:       make([]float64, out),
+		Activation: activation,
+	}
+	for j := range layer.Weights {
+		layer.Weights[j] = make([]float64, in)
+		for i := range layer.Weights[j] {
+			layer.Weights[j][i] = (2*rand.Float64() - 1) / float64(in)
+		}
+		layer.Bias[j] = (2*rand.Float64() - 1) / 4
+	}
+	return layer
+}
+
+func TestMLP(t *testing.T) {
+	params, btparams := initTestBtParams()
+	ctx := newTestContext(params, btparams)
+
+	// Degree 3 approximation of the sigmoid on [-1, 1]
+	sigmoid := []float64{0.5, 0.197, 0, -0.004}
+	model := &lattigo_key.MLP{
+		Layers: []lattigo_key.DenseLayer{
+			randomLayer(16, 30, sigmoid),
+			randomLayer(8, 16, sigmoid),
+			randomLayer(1, 8, nil),
+		},
+	}
+
+	path := filepath.Join(t.TempDir(), "model.json")
+	if err := model.Save(path); err != nil {
+		t.Fatalf("Failed to save model: %v", err)
+	}
+	model, err := lattigo_key.LoadMLP(path)
+	if err != nil {
+		t.Fatalf("Failed to load model: %v", err)
+	}
+
+	data := make([][]float64, 4)
+	for i := range data {
+		data[i] = make([]float64, 30)
+		for j := range data[i] {
+			data[i][j] = 2*rand.Float64() - 1
+		}
+	}
+
+	ctxt, err := ctx.EvaluateMLPWithOptions(model, ctx.Encrypt(lattigo_key.NewPlaintext(data)), lattigo_key.MLPOptions{Workers: 2})
+	if err != nil {
+		t.Fatalf("Failed to evaluate model: %v", err)
+	}
+	result := ctx.Decrypt(ctxt).GetData()
+
+	for i := range data {
+		want := model.Evaluate(data[i])
+		for j := range want {
+			if diff := math.Abs(result[i][j] - want[j]); diff > lattigo_key.MLPTolerance {
+				t.Errorf("sample %d output %d: got %f, want %f (error %e)", i, j, result[i][j], want[j], diff)
+			}
+		}
+	}
+
+	// A panic on a ciphertext is returned as an error
+	broken := ctx.Encrypt(lattigo_key.NewPlaintext(data))
+	broken.GetData()[1] = nil
+	if _, err := ctx.EvaluateMLPWithOptions(model, broken, lattigo_key.MLPOptions{Workers: 1}); err == nil {
+		t.Fatal("Evaluated a ciphertext without data")
+	}
+}
@@ -0,0 +1,194 @@
+package test
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/JihunSKKU/HE-CCFD/lattigo_key"
+)
+
+func TestParallelSaveLoad(t *testing.T) {
+	params, btparams := initTestBtParams()
+	ctx := lattigo_key.NewContextWithOptions(params, btparams, lattigo_key.ContextOptions{Seed: []byte("parallel"), Insecure: true})
+
+	sequential := filepath.Join(t.TempDir(), "sequential")
+	parallel := filepath.Join(t.TempDir(), "parallel")
+	if err := ctx.SaveKeysWithOptions(sequential, lattigo_key.SaveOptions{Workers: 1}); err != nil {
+		t.Fatalf("Failed to save keys: %v", err)
+	}
+	if err := ctx.SaveKeysWithOptions(parallel, lattigo_key.SaveOptions{Workers: 8}); err != nil {
+		t.Fatalf("Failed to save keys in parallel: %v", err)
+	}
+
+	// Same key files, whatever the number of workers
+	err := filepath.Walk(sequential, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || !strings.HasSuffix(path, ".key") {
+			return err
+		}
+		rel, _ := filepath.Rel(sequential, path)
+		want, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		have, err := os.ReadFile(filepath.Join(parallel, rel))
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(have, want) {
+			t.Errorf("%s differs when saved in parallel", rel)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := lattigo_key.LoadKeysWithOptions(parallel, lattigo_key.LoadOptions{Workers: 8})
+	if err != nil {
+		t.Fatalf("Failed to load keys in parallel: %v", err)
+	}
+	report, err := loaded.Validate(lattigo_key.ValidateOptions{})
+	if err != nil {
+		t.Fatalf("Failed to validate keys: %v", err)
+	}
+	if !report.OK() {
+		t.Fatalf("Keys loaded in parallel are inconsistent:\n%s", report)
+	}
+
+	// The error is the one a sequential load reports first
+	if err := os.Truncate(filepath.Join(parallel, "rlk.key"), 10); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(filepath.Join(parallel, "galks", "galk_0.key"), 10); err != nil {
+		t.Fatal(err)
+	}
+	_, seqErr := lattigo_key.LoadKeysWithOptions(parallel, lattigo_key.LoadOptions{Workers: 1})
+	_, parErr := lattigo_key.LoadKeysWithOptions(parallel, lattigo_key.LoadOptions{Workers: 8})
+	if seqErr == nil || parErr == nil {
+		t.Fatalf("Loading damaged keys succeeded: %v, %v", seqErr, parErr)
+	}
+	if !strings.Contains(parErr.Error(), "rlk.key") || parErr.Error() != seqErr.Error() {
+		t.Fatalf("Parallel load reported %q, sequential load %q", parErr, seqErr)
+	}
+}
+
+// BenchmarkSaveLoadKeys saves and loads the keys of the N16 bootstrapping
+// parameters with one worker and with GOMAXPROCS workers.
+func BenchmarkSaveLoadKeys(b *testing.B) {
+	params, btparams := initBtParams()
+	ctx := lattigo_key.NewContext(params, btparams)
+	dirPath := filepath.Join(b.TempDir(), "keys")
+
+	workers := []int{1}
+	if procs := runtime.GOMAXPROCS(0); procs > 1 {
+		workers = append(workers, procs)
+	}
+	for _, w := range workers {
+		b.Run(fmt.Sprintf("save/workers=%d", w), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if err := ctx.SaveKeysWithOptions(dirPath, lattigo_key.SaveOptions{Workers: w}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+	for _, w := range workers {
+		b.Run(fmt.Sprintf("load/workers=%d", w), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := lattigo_key.LoadKeysWithOptions(dirPath, lattigo_key.LoadOptions{Workers: w}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// newSamples returns n samples of features values.
+func newSamples(n, features int) [][]float64 {
+	samples := make([][]float64, n)
+	for i := range samples {
+		samples[i] = make([]float64, features)
+		for j := range samples[i] {
+			samples[i][j] = float64(i%100)/10 + float64(j)/100
+		}
+	}
+	return samples
+}
+
+// TestConcurrentEncrypt encrypts and decrypts batches from several goroutines sharing a
+// Context, with several workers each. Run it with -race.
+func TestConcurrentEncrypt(t *testing.T) {
+	params, btparams := initTestBtParams()
+	ctx := newTestContext(params, btparams)
+	samples := newSamples(64, 20)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			ptxt := lattigo_key.NewPlaintext(samples)
+			if g%2 == 1 {
+				ptxt = lattigo_key.NewPackedPlaintext(samples)
+			}
+			ctxt := ctx.EncryptWithOptions(ptxt, lattigo_key.EncryptOptions{Symmetric: g%4 >= 2, Workers: g % 3})
+			rows := ctx.DecryptWithOptions(ctxt, lattigo_key.DecryptOptions{Workers: 4 - g%3}).GetData()
+			if len(rows) != len(samples) {
+				errs <- fmt.Errorf("goroutine %d decrypted %d samples, want %d", g, len(rows), len(samples))
+				return
+			}
+			for i := range samples {
+				for j := range samples[i] {
+					if math.Abs(rows[i][j]-samples[i][j]) > 1e-6 {
+						errs <- fmt.Errorf("goroutine %d: sample %d feature %d: got %f, want %f", g, i, j, rows[i][j], samples[i][j])
+						return
+					}
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+// BenchmarkEncryptDecrypt encrypts and decrypts 1k samples of the test parameters, one
+// per ciphertext, with one worker and with GOMAXPROCS workers.
+func BenchmarkEncryptDecrypt(b *testing.B) {
+	params, btparams := initTestBtParams()
+	ctx := newTestContext(params, btparams)
+	ptxt := lattigo_key.NewPlaintext(newSamples(1000, 30))
+	ctxt := ctx.Encrypt(ptxt)
+
+	workers := []int{1}
+	if procs := runtime.GOMAXPROCS(0); procs > 1 {
+		workers = append(workers, procs)
+	}
+	for _, w := range workers {
+		b.Run(fmt.Sprintf("encrypt/workers=%d", w), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				ctx.EncryptWithOptions(ptxt, lattigo_key.EncryptOptions{Workers: w})
+			}
+		})
+		b.Run(fmt.Sprintf("encrypt-symmetric/workers=%d", w), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				ctx.EncryptWithOptions(ptxt, lattigo_key.EncryptOptions{Symmetric: true, Workers: w})
+			}
+		})
+		b.Run(fmt.Sprintf("decrypt/workers=%d", w), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				ctx.DecryptWithOptions(ctxt, lattigo_key.DecryptOptions{Workers: w})
+			}
+		})
+	}
+}
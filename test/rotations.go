@@ -0,0 +1,128 @@
+package test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/JihunSKKU/HE-CCFD/lattigo_key"
+)
+
+// galoisElements returns the Galois elements of the galois keys of ctx.
+func galoisElements(t *testing.T, ctx *lattigo_key.Context) map[uint64]bool {
+	report, err := ctx.KeySizes()
+	if err != nil {
+		t.Fatalf("Failed to compute key sizes: %v", err)
+	}
+	galEls := map[uint64]bool{}
+	for _, galk := range report.GaloisKeys {
+		galEls[galk.GaloisElement] = true
+	}
+	return galEls
+}
+
+func TestAddRotations(t *testing.T) {
+	params, btparams := initTestBtParams()
+	ctx := newTestContext(params, btparams)
+
+	dirPath := filepath.Join(t.TempDir(), "keys")
+	if err := ctx.SaveKeys(dirPath); err != nil {
+		t.Fatalf("Failed to save keys: %v", err)
+	}
+	galk0, err := os.ReadFile(filepath.Join(dirPath, "galks", "galk_0.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rots := []int{3, 9, 10, 100, -100}
+	before := galoisElements(t, ctx)
+	missing := map[uint64]bool{}
+	for _, galEl := range params.GaloisElements(rots) {
+		if !before[galEl] {
+			missing[galEl] = true
+		}
+	}
+	if len(missing) == 0 {
+		t.Fatal("All the rotations already have a key")
+	}
+
+	if err := ctx.AddRotationsToDir(dirPath, rots, lattigo_key.SaveOptions{}); err != nil {
+		t.Fatalf("Failed to add rotations: %v", err)
+	}
+	after := galoisElements(t, ctx)
+	if len(after) != len(before)+len(missing) {
+		t.Fatalf("%d galois keys after adding %d to %d", len(after), len(missing), len(before))
+	}
+	for galEl := range missing {
+		if !after[galEl] {
+			t.Fatalf("Galois element %d has no key", galEl)
+		}
+	}
+
+	// Only the new keys are written
+	if have, err := os.ReadFile(filepath.Join(dirPath, "galks", "galk_0.key")); err != nil || !bytes.Equal(have, galk0) {
+		t.Fatalf("galk_0.key was rewritten: %v", err)
+	}
+	if files, err := os.ReadDir(filepath.Join(dirPath, "galks")); err != nil || len(files) != len(after) {
+		t.Fatalf("galks holds %d files for %d keys: %v", len(files), len(after), err)
+	}
+
+	// Nothing is missing anymore
+	if err := ctx.AddRotations(rots); err != nil {
+		t.Fatalf("Failed to add rotations again: %v", err)
+	}
+	if again := galoisElements(t, ctx); len(again) != len(after) {
+		t.Fatalf("Adding the same rotations again gave %d keys instead of %d", len(again), len(after))
+	}
+
+	// The new keys rotate ciphertexts of ctx
+	ctxt := ctx.Encrypt(lattigo_key.NewPlaintext([][]float64{{1, 2, 3}}))
+	for _, rot := range rots {
+		if _, err := ctx.RotationNew(ctxt.GetData()[0], rot); err != nil {
+			t.Fatalf("Failed to rotate by %d: %v", rot, err)
+		}
+	}
+
+	loaded, err := lattigo_key.LoadKeys(dirPath)
+	if err != nil {
+		t.Fatalf("Failed to load keys: %v", err)
+	}
+	if have := galoisElements(t, loaded); len(have) != len(after) {
+		t.Fatalf("Loaded %d galois keys, expected %d", len(have), len(after))
+	}
+	report, err := loaded.Validate(lattigo_key.ValidateOptions{})
+	if err != nil {
+		t.Fatalf("Failed to validate keys: %v", err)
+	}
+	if !report.OK() {
+		t.Fatalf("Added keys are inconsistent:\n%s", report)
+	}
+
+	// A mapped key file is rewritten with the new keys while its keys are in use
+	mappedPath := filepath.Join(t.TempDir(), "mapped")
+	if err := loaded.SaveKeysWithOptions(mappedPath, lattigo_key.SaveOptions{MemoryMapped: true}); err != nil {
+		t.Fatalf("Failed to save mapped keys: %v", err)
+	}
+	mapped, err := lattigo_key.LoadKeys(mappedPath)
+	if err != nil {
+		t.Fatalf("Failed to load mapped keys: %v", err)
+	}
+	defer mapped.Close()
+	if err := mapped.AddRotationsToDir(mappedPath, []int{11}, lattigo_key.SaveOptions{}); err != nil {
+		t.Fatalf("Failed to add rotations to mapped keys: %v", err)
+	}
+	remapped, err := lattigo_key.LoadKeys(mappedPath)
+	if err != nil {
+		t.Fatalf("Failed to load mapped keys: %v", err)
+	}
+	defer remapped.Close()
+	if have := galoisElements(t, remapped); !have[params.GaloisElement(11)] || len(have) != len(after)+1 {
+		t.Fatalf("Loaded %d mapped galois keys, expected %d with the rotation by 11", len(have), len(after)+1)
+	}
+
+	// The directory must hold the keys of the context
+	if err := ctx.AddRotationsToDir(filepath.Join(t.TempDir(), "empty"), []int{12}, lattigo_key.SaveOptions{}); err == nil {
+		t.Fatal("Added rotations to a directory without the keys of the context")
+	}
+}
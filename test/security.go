@@ -0,0 +1,98 @@
+package test
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/JihunSKKU/HE-CCFD/lattigo_key"
+	"github.com/tuneinsight/lattigo/v5/ring"
+)
+
+func TestSecurityLevel(t *testing.T) {
+	// The estimate gives back the levels of the bounds it interpolates
+	uniform := ring.Ternary{P: 2.0 / 3.0}
+	for _, bits := range []int{128, 192, 256} {
+		for logN := 10; logN <= 16; logN++ {
+			bound, err := lattigo_key.MaxLogQP(logN, bits)
+			if err != nil {
+				t.Fatal(err)
+			}
+			have, err := lattigo_key.EstimateSecurity(logN, bound, uniform)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if have < float64(bits)-0.5 || have > float64(bits)+0.5 {
+				t.Fatalf("LogN %d and LogQP %.0f give %.1f bits, expected %d", logN, bound, have, bits)
+			}
+		}
+	}
+
+	// A sparse secret lowers the security of a same modulus
+	dense, _ := lattigo_key.EstimateSecurity(16, 1546, uniform)
+	sparse, _ := lattigo_key.EstimateSecurity(16, 1546, ring.Ternary{H: 192})
+	if sparse >= dense || sparse < 127.5 {
+		t.Fatalf("LogQP 1546 at N=2^16 gives %.1f bits with H=192 and %.1f bits with a uniform secret", sparse, dense)
+	}
+	if _, err := lattigo_key.EstimateSecurity(17, 1546, uniform); err == nil {
+		t.Fatal("Found an estimate for LogN 17")
+	}
+
+	// The HE-CCFD parameters reach 128 bits and the test parameters are far from it
+	params, btparams := initBtParams()
+	if bits, err := lattigo_key.ParametersSecurity(params, btparams); err != nil || bits < 128 {
+		t.Fatalf("The N=2^16 parameters reach %.1f bits of security: %v", bits, err)
+	}
+	testParams, testBtparams := initTestBtParams()
+	if bits, err := lattigo_key.ParametersSecurity(testParams, testBtparams); err != nil || bits > 0 {
+		t.Fatalf("The test parameters reach %.1f bits of security: %v", bits, err)
+	}
+
+	// Below the floor, NewContext and gen refuse the test parameters unless overridden
+	if err := lattigo_key.CheckSecurity(params, btparams); err != nil {
+		t.Fatal(err)
+	}
+	if err := lattigo_key.CheckSecurity(testParams, testBtparams); !errors.Is(err, lattigo_key.ErrInsecureParameters) {
+		t.Fatalf("Expected ErrInsecureParameters, got %v", err)
+	}
+	for name, newCtx := range map[string]func(){
+		"NewContext":       func() { lattigo_key.NewContext(testParams, testBtparams) },
+		"NewSeededContext": func() { lattigo_key.NewSeededContext(testParams, testBtparams, []byte("seed")) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("%s accepted the test parameters", name)
+				}
+			}()
+			newCtx()
+		}()
+	}
+	newTestContext(testParams, testBtparams).Close()
+
+	// The floor can be set per context, and the HE-CCFD parameters do not reach 192 bits
+	if err := lattigo_key.CheckSecurityFloor(params, btparams, 192); !errors.Is(err, lattigo_key.ErrInsecureParameters) {
+		t.Fatalf("Expected ErrInsecureParameters below a floor of 192 bits, got %v", err)
+	}
+	func() {
+		defer func() {
+			if r := recover(); r == nil || !strings.Contains(fmt.Sprint(r), "floor of 64 bits") {
+				t.Fatalf("NewContextWithOptions with a floor of 64 bits panicked with %v", r)
+			}
+		}()
+		lattigo_key.NewContextWithOptions(testParams, testBtparams, lattigo_key.ContextOptions{SecurityFloor: 64})
+	}()
+
+	keys := filepath.Join(t.TempDir(), "keys")
+	if _, err := runKeyTool("gen", "-preset", "insecure-n10", "-out", keys); !errors.Is(err, lattigo_key.ErrInsecureParameters) {
+		t.Fatalf("gen without -insecure: expected ErrInsecureParameters, got %v", err)
+	}
+	if _, err := runKeyTool("gen", "-preset", "insecure-n10", "-insecure", "-out", keys); err != nil {
+		t.Fatalf("gen -insecure: %v", err)
+	}
+	if _, err := runKeyTool("gen", "-preset", "n16-bootstrap", "-security-floor", "192", "-out", filepath.Join(t.TempDir(), "n16")); !errors.Is(err, lattigo_key.ErrInsecureParameters) {
+		t.Fatalf("gen -security-floor 192: expected ErrInsecureParameters, got %v", err)
+	}
+}
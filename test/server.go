@@ -0,0 +1,216 @@
+package test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/JihunSKKU/HE-CCFD/lattigo_key"
+	"github.com/JihunSKKU/HE-CCFD/lattigo_key/server"
+	"github.com/tuneinsight/lattigo/v5/core/rlwe"
+	"github.com/tuneinsight/lattigo/v5/he/hefloat"
+	"github.com/tuneinsight/lattigo/v5/he/hefloat/bootstrapping"
+	"github.com/tuneinsight/lattigo/v5/utils"
+)
+
+func TestInferenceServer(t *testing.T) {
+	params, btparams := initTestBtParams()
+	ctx := newTestContext(params, btparams)
+
+	dirPath := filepath.Join(t.TempDir(), "keys")
+	if err := ctx.SaveKeysWithOptions(dirPath, lattigo_key.SaveOptions{EvaluationOnly: true, SeedCompressed: true}); err != nil {
+		t.Fatalf("Failed to save evaluation keys: %v", err)
+	}
+	for _, name := range []string{"sk.key", "test_ctxt"} {
+		if _, err := os.Stat(filepath.Join(dirPath, name)); !os.IsNotExist(err) {
+			t.Fatalf("Evaluation keys hold %s", name)
+		}
+	}
+
+	srv, err := server.Load(dirPath)
+	if err != nil {
+		t.Fatalf("Failed to load server: %v", err)
+	}
+	weights := []float64{0.1, -0.2, 0.05, 0.3, -0.1, 0.25, 0.15, -0.05}
+	bias := 0.1
+	srv.Register("linear", server.LinearScorer(weights, bias))
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	client := server.NewClient(ctx, ts.URL)
+	client.Codec = lattigo_key.CodecZstd
+	models, err := client.Models()
+	if err != nil {
+		t.Fatalf("Failed to list models: %v", err)
+	}
+	if len(models) != 1 || models[0] != "linear" {
+		t.Fatalf("Server lists models %v", models)
+	}
+
+	samples := [][]float64{
+		{1, 0, 0, 0, 0, 0, 0, 0},
+		{0.5, -0.5, 0.25, -0.25, 0.75, -0.75, 0.1, -0.1},
+		{-1, 1, -1, 1, -1, 1, -1, 1},
+	}
+	scores, err := client.Infer("linear", samples)
+	if err != nil {
+		t.Fatalf("Failed to infer: %v", err)
+	}
+	if len(scores) != len(samples) {
+		t.Fatalf("Server returned %d scores for %d samples", len(scores), len(samples))
+	}
+	for i, x := range samples {
+		want := bias
+		for j, w := range weights {
+			want += w * x[j]
+		}
+		if len(scores[i]) != 1 || math.Abs(scores[i][0]-want) > lattigo_key.MLPTolerance {
+			t.Fatalf("Sample %d scored %v, expected %f", i, scores[i], want)
+		}
+	}
+
+	// Errors of the server are returned by the client
+	if _, err := client.Infer("unknown", samples); err == nil {
+		t.Fatal("Inferred with an unknown model")
+	}
+	if _, err := client.Infer("linear", [][]float64{{1, 2, 3}}); err == nil {
+		t.Fatal("Inferred with samples of the wrong size")
+	}
+
+	lit := params.ParametersLiteral()
+	lit.LogDefaultScale = 39
+	otherParams, err := hefloat.NewParametersFromLiteral(hefloat.ParametersLiteral(lit))
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherBtparams, err := bootstrapping.NewParametersFromLiteral(otherParams, bootstrapping.ParametersLiteral{LogN: utils.Pointy(otherParams.LogN())})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := server.NewClient(newTestContext(otherParams, otherBtparams), ts.URL)
+	if _, err := other.Models(); !errors.Is(err, lattigo_key.ErrFingerprintMismatch) {
+		t.Fatalf("Expected a fingerprint mismatch, got %v", err)
+	}
+	if _, err := other.Infer("linear", samples); !errors.Is(err, lattigo_key.ErrFingerprintMismatch) {
+		t.Fatalf("Expected a fingerprint mismatch, got %v", err)
+	}
+
+	// Forged lengths, missing fingerprints and ciphertexts of another shape than the
+	// parameters are refused without taking the server down
+	srv.Register("mlp", server.MLPModel(&lattigo_key.MLP{Layers: []lattigo_key.DenseLayer{{Weights: [][]float64{weights}, Bias: []float64{bias}}}}))
+	for name, forged := range forgedShapes(t, params, ctx.Encrypt(lattigo_key.NewPlaintext(samples))) {
+		resp, err := http.Post(ts.URL+"/v1/models/mlp", "application/octet-stream", bytes.NewReader(forged))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("%s: server returned %s, expected %d", name, resp.Status, http.StatusBadRequest)
+		}
+	}
+	valid, err := ctx.Encrypt(lattigo_key.NewPackedPlaintext(samples)).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	numCtxtAt := len("HECT") + 1 + len(lattigo_key.Fingerprint{}) + 41
+	forgedCount := append([]byte(nil), valid...)
+	binary.LittleEndian.PutUint64(forgedCount[numCtxtAt:], 1<<36)
+	noFingerprint := append([]byte(nil), valid...)
+	copy(noFingerprint[len("HECT")+1:], make([]byte, len(lattigo_key.Fingerprint{})))
+	// A few compressed bytes repeating a ciphertext decompress to 32 MiB
+	headerLen := numCtxtAt + 8
+	entry := valid[headerLen:][:(len(valid)-headerLen)/int(binary.LittleEndian.Uint64(valid[numCtxtAt:]))]
+	bomb := append([]byte(nil), forgedCount[:headerLen]...)
+	for len(bomb) < 32<<20 {
+		bomb = append(bomb, entry...)
+	}
+	srv.MaxDecompressedBytes = 8 << 20
+	for _, payload := range []struct {
+		name   string
+		data   []byte
+		status int
+	}{
+		{"ciphertexts 1<<36", forgedCount, http.StatusBadRequest},
+		{"no fingerprint", noFingerprint, http.StatusConflict},
+		{"decompressed 32 MiB", bomb, http.StatusRequestEntityTooLarge},
+	} {
+		var body bytes.Buffer
+		zw, err := lattigo_key.NewCompressWriter(&body, lattigo_key.CodecZstd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := zw.Write(payload.data); err != nil {
+			t.Fatal(err)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.Post(ts.URL+"/v1/models/linear", "application/octet-stream", &body)
+		if err != nil {
+			t.Fatalf("%s: %v", payload.name, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != payload.status {
+			t.Fatalf("%s: server returned %s, expected %d", payload.name, resp.Status, payload.status)
+		}
+	}
+	srv.MaxDecompressedBytes = 0
+	if _, err := client.Infer("linear", samples); err != nil {
+		t.Fatalf("Failed to infer after the forged requests: %v", err)
+	}
+
+	// The server refuses keys holding the secret key
+	fullPath := filepath.Join(t.TempDir(), "full")
+	if err := ctx.SaveKeys(fullPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := server.Load(fullPath); err == nil {
+		t.Fatal("Server loaded keys holding the secret key")
+	}
+}
+
+// forgedShapes returns serializations of ctxt, made under params, with its first
+// ciphertext replaced by one of another shape than params, which lattigo panics on.
+func forgedShapes(t *testing.T, params hefloat.Parameters, ctxt *lattigo_key.Ciphertext) map[string][]byte {
+	lit := params.ParametersLiteral()
+	lit.Q, lit.P = nil, nil
+	lit.LogQ, lit.LogP = initLogQ(params.MaxLevel()+2, 40), []int{61, 61}
+	moreModuli, err := hefloat.NewParametersFromLiteral(hefloat.ParametersLiteral(lit))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lit = params.ParametersLiteral()
+	lit.LogN++
+	lit.Q, lit.P = nil, nil
+	lit.LogQ, lit.LogP = initLogQ(params.MaxLevel(), 40), []int{61, 61}
+	largerRing, err := hefloat.NewParametersFromLiteral(hefloat.ParametersLiteral(lit))
+	if err != nil {
+		t.Fatal(err)
+	}
+	notNTT := hefloat.NewCiphertext(params, 1, params.MaxLevel())
+	notNTT.IsNTT = false
+
+	forged := map[string][]byte{}
+	for name, ct := range map[string]*rlwe.Ciphertext{
+		"level above the maximum": hefloat.NewCiphertext(moreModuli, 1, moreModuli.MaxLevel()),
+		"larger ring degree":      hefloat.NewCiphertext(largerRing, 1, 0),
+		"degree 2":                hefloat.NewCiphertext(params, 2, params.MaxLevel()),
+		"not in the NTT domain":   notNTT,
+	} {
+		c := ctxt.CopyNew()
+		c.GetData()[0] = ct
+		data, err := c.MarshalBinary()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		forged[name] = data
+	}
+	return forged
+}
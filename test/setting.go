@@ -1,6 +1,7 @@
 package test
 
 import (
+	"github.com/JihunSKKU/HE-CCFD/lattigo_key"
 	"github.com/tuneinsight/lattigo/v5/he/hefloat"
 	"github.com/tuneinsight/lattigo/v5/he/hefloat/bootstrapping"
 	"github.com/tuneinsight/lattigo/v5/ring"
@@ -49,4 +50,52 @@ func initBtParams() (params hefloat.Parameters, btparams bootstrapping.Parameter
 	btparams, _ = bootstrapping.NewParametersFromLiteral(params, btpParamsLit)
 
 	return
-}
\ No newline at end of file
+}
+
+// initTestBtParams returns small, insecure bootstrapping parameters for fast tests.
+func initTestBtParams() (params hefloat.Parameters, btparams bootstrapping.Parameters) {
+	params, err := hefloat.NewParametersFromLiteral(
+		hefloat.ParametersLiteral{
+			LogN: 				10,
+			LogQ: 				[]int{60, 40, 40, 40, 40, 40},
+			LogP: 				[]int{61, 61},
+			LogDefaultScale: 	40,
+			RingType: 			ring.Standard,
+		})
+	if err != nil {
+		panic(err)
+	}
+
+	btparams, err = bootstrapping.NewParametersFromLiteral(params, bootstrapping.ParametersLiteral{
+		LogN: 	utils.Pointy(params.LogN()),
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	// Uses all the slots of the ring, which is insecure but keeps the precision of N=2^16
+	btparams.SlotsToCoeffsParameters.LogSlots = btparams.BootstrappingParameters.LogN() - 1
+	btparams.CoeffsToSlotsParameters.LogSlots = btparams.BootstrappingParameters.LogN() - 1
+	btparams.Mod1ParametersLiteral.LogMessageRatio += 16 - params.LogN()
+
+	return
+}
+
+// initTestRealBtParams returns the small, insecure ConjugateInvariant parameters of the
+// insecure-n10-real preset, whose 2^10 slots are real.
+func initTestRealBtParams() (params hefloat.Parameters, btparams bootstrapping.Parameters) {
+	config, err := lattigo_key.Preset("insecure-n10-real")
+	if err != nil {
+		panic(err)
+	}
+	if params, btparams, err = config.NewParameters(); err != nil {
+		panic(err)
+	}
+	return
+}
+
+// newTestContext generates the keys of insecure test parameters, such as those of
+// initTestBtParams, which NewContext refuses.
+func newTestContext(params hefloat.Parameters, btparams bootstrapping.Parameters) *lattigo_key.Context {
+	return lattigo_key.NewContextWithOptions(params, btparams, lattigo_key.ContextOptions{Insecure: true})
+}
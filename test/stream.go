@@ -0,0 +1,292 @@
+package test
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/JihunSKKU/HE-CCFD/lattigo_key"
+	"github.com/JihunSKKU/HE-CCFD/lattigo_key/server"
+	"github.com/JihunSKKU/HE-CCFD/lattigo_key/stream"
+	"github.com/tuneinsight/lattigo/v5/core/rlwe"
+	"github.com/tuneinsight/lattigo/v5/he/hefloat"
+	"github.com/tuneinsight/lattigo/v5/he/hefloat/bootstrapping"
+	"github.com/tuneinsight/lattigo/v5/utils"
+)
+
+// checkDecrypted fails if the first values of the decryption of ctxt are not want.
+func checkDecrypted(t *testing.T, ctx *lattigo_key.Context, ctxt *lattigo_key.Ciphertext, want [][]float64, tolerance float64) {
+	have := ctx.Decrypt(ctxt).GetData()
+	if len(have) != len(want) {
+		t.Fatalf("Decrypted %d samples, expected %d", len(have), len(want))
+	}
+	for i := range want {
+		for j, v := range want[i] {
+			if math.Abs(have[i][j]-v) > tolerance {
+				t.Fatalf("Sample %d, value %d is %f, expected %f", i, j, have[i][j], v)
+			}
+		}
+	}
+}
+
+func TestStreamProtocol(t *testing.T) {
+	params, btparams := initTestBtParams()
+	ctx := newTestContext(params, btparams)
+
+	dirPath := filepath.Join(t.TempDir(), "keys")
+	if err := ctx.SaveKeysWithOptions(dirPath, lattigo_key.SaveOptions{EvaluationOnly: true}); err != nil {
+		t.Fatalf("Failed to save evaluation keys: %v", err)
+	}
+	serverCtx, err := lattigo_key.LoadKeys(dirPath)
+	if err != nil {
+		t.Fatalf("Failed to load evaluation keys: %v", err)
+	}
+
+	weights := []float64{0.5, -0.25, 0.125, 0.25}
+	srv := stream.NewServer(serverCtx)
+	srv.Register("linear", server.LinearScorer(weights, 0.1))
+	srv.Register("mlp", server.MLPModel(&lattigo_key.MLP{Layers: []lattigo_key.DenseLayer{{Weights: [][]float64{weights}, Bias: []float64{0.1}}}}))
+	srv.Register("rotate100", server.ModelFunc(func(ctx *lattigo_key.Context, in *lattigo_key.Ciphertext) (*lattigo_key.Ciphertext, error) {
+		out := in.CopyNew()
+		for _, ct := range out.GetData() {
+			if err := ctx.Rotation(ct, 100, ct); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	}))
+	srv.Register("has100", server.ModelFunc(func(ctx *lattigo_key.Context, in *lattigo_key.Ciphertext) (*lattigo_key.Ciphertext, error) {
+		if req := ctx.NewEvaluationKeyRequest([]int{100}); len(req.Rotations) != 0 {
+			return nil, fmt.Errorf("no key for rotation 100")
+		}
+		return in, nil
+	}))
+
+	samples := [][]float64{{0.1, 0.2, 0.3, 0.4}, {-0.4, 0.3, -0.2, 0.1}}
+	ctxt := ctx.Encrypt(lattigo_key.NewPlaintext(samples))
+
+	// In-process connection
+	conn, serverConn := net.Pipe()
+	go srv.ServeConn(serverConn)
+	client := stream.NewClient(ctx, conn)
+	client.ChunkBytes = 64 << 10
+
+	rots := []int{100, 101}
+	req := serverCtx.NewEvaluationKeyRequest(rots)
+	if len(req.Rotations) != len(rots) {
+		t.Fatalf("Server already has keys for %v", rots)
+	}
+	resp, err := ctx.RespondEvaluationKeys(req, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.UploadEvaluationKeys(resp); err != nil {
+		t.Fatalf("Failed to upload keys: %v", err)
+	}
+	// The uploaded keys serve this connection only, the Context of the server is unchanged
+	if again := serverCtx.NewEvaluationKeyRequest(rots); len(again.Rotations) != len(rots) {
+		t.Fatalf("Server Context holds keys for %v after the upload", rots)
+	}
+
+	scores, err := client.Evaluate("linear", ctxt)
+	if err != nil {
+		t.Fatalf("Failed to evaluate: %v", err)
+	}
+	want := make([][]float64, len(samples))
+	for i, x := range samples {
+		want[i] = []float64{0.1}
+		for j, w := range weights {
+			want[i][0] += w * x[j]
+		}
+	}
+	checkDecrypted(t, ctx, scores, want, lattigo_key.MLPTolerance)
+
+	if _, err := client.Evaluate("unknown", ctxt); err == nil || !strings.Contains(err.Error(), "unknown model") {
+		t.Fatalf("Evaluating an unknown model returned %v", err)
+	}
+
+	// The connection is still usable after an error
+	rotated, err := client.Evaluate("rotate100", ctxt)
+	if err != nil {
+		t.Fatalf("Failed to evaluate after an error: %v", err)
+	}
+	slots := params.MaxSlots()
+	for i, x := range samples {
+		want[i] = make([]float64, slots)
+		for j, v := range x {
+			want[i][((j-100)%slots+slots)%slots] = v
+		}
+	}
+	checkDecrypted(t, ctx, rotated, want, 1e-3)
+	if _, err := client.Evaluate("has100", ctxt); err != nil {
+		t.Fatalf("Uploaded keys are missing: %v", err)
+	}
+
+	// Ciphertexts of another shape than the parameters are refused, and the server
+	// keeps serving
+	for name, data := range forgedShapes(t, params, ctxt) {
+		forged := new(lattigo_key.Ciphertext)
+		if err := forged.UnmarshalBinary(data); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if _, err := client.Evaluate("mlp", forged); err == nil || !strings.Contains(err.Error(), "invalid ciphertext") {
+			t.Fatalf("%s: evaluating returned %v", name, err)
+		}
+		if err := client.Bootstrap(forged, func(int, *rlwe.Ciphertext) error { return nil }); err == nil || !strings.Contains(err.Error(), "invalid ciphertext") {
+			t.Fatalf("%s: bootstrapping returned %v", name, err)
+		}
+	}
+	if _, err := client.Evaluate("mlp", ctxt); err != nil {
+		t.Fatalf("Failed to evaluate after forged ciphertexts: %v", err)
+	}
+	client.Close()
+
+	otherConn, otherServerConn := net.Pipe()
+	go srv.ServeConn(otherServerConn)
+	otherClient := stream.NewClient(ctx, otherConn)
+	if _, err := otherClient.Evaluate("has100", ctxt); err == nil || !strings.Contains(err.Error(), "no key for rotation 100") {
+		t.Fatalf("Evaluating with keys uploaded on another connection returned %v", err)
+	}
+
+	// Uploads larger than the limit of the server are refused
+	srv.MaxUploadBytes = 1 << 10
+	if err := otherClient.UploadEvaluationKeys(resp); err == nil || !strings.Contains(err.Error(), "upload larger") {
+		t.Fatalf("Uploading keys larger than the limit returned %v", err)
+	}
+	srv.MaxUploadBytes = 0
+	otherClient.Close()
+
+	// A forged ciphertext is answered with an error
+	valid, err := ctxt.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fp := ctx.Fingerprint()
+	binary.LittleEndian.PutUint64(valid[len("HECT")+1+len(fp)+41:], 1<<36)
+	payload := append(binary.LittleEndian.AppendUint16(nil, uint16(len("linear"))), "linear"...)
+	payload = append(payload, valid...)
+	forged := append([]byte("HEFR"), stream.ProtocolVersion, 4)
+	forged = append(forged, fp[:]...)
+	forged = binary.LittleEndian.AppendUint64(forged, uint64(len(payload)))
+	forged = append(forged, payload...)
+
+	forgedConn, forgedServerConn := net.Pipe()
+	go srv.ServeConn(forgedServerConn)
+	if _, err := forgedConn.Write(forged); err != nil {
+		t.Fatal(err)
+	}
+	errorHeader := make([]byte, len("HEFR")+2+len(fp)+8)
+	if _, err := io.ReadFull(forgedConn, errorHeader); err != nil {
+		t.Fatal(err)
+	}
+	message := make([]byte, binary.LittleEndian.Uint64(errorHeader[len(errorHeader)-8:]))
+	if _, err := io.ReadFull(forgedConn, message); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(message), "invalid ciphertext") {
+		t.Fatalf("Server answered %q to a forged ciphertext", message)
+	}
+	forgedConn.Close()
+
+	// Localhost listener
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go srv.Serve(l)
+
+	tcpClient, err := stream.Dial(ctx, "tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcpClient.Close()
+
+	bootstrapped := ctxt.CopyNew()
+	received := map[int]bool{}
+	err = tcpClient.Bootstrap(ctxt, func(i int, ct *rlwe.Ciphertext) error {
+		if received[i] {
+			t.Errorf("Received ciphertext %d twice", i)
+		}
+		received[i] = true
+		if ct.Level() != params.MaxLevel() {
+			t.Errorf("Bootstrapped ciphertext %d is at level %d", i, ct.Level())
+		}
+		bootstrapped.GetData()[i] = ct
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to bootstrap: %v", err)
+	}
+	if len(received) != len(samples) {
+		t.Fatalf("Received %d bootstrapped ciphertexts for %d", len(received), len(samples))
+	}
+	checkDecrypted(t, ctx, bootstrapped, samples, 1e-2)
+
+	// Frames of other parameters are refused
+	lit := params.ParametersLiteral()
+	lit.LogDefaultScale = 39
+	otherParams, err := hefloat.NewParametersFromLiteral(hefloat.ParametersLiteral(lit))
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherBtparams, err := bootstrapping.NewParametersFromLiteral(otherParams, bootstrapping.ParametersLiteral{LogN: utils.Pointy(otherParams.LogN())})
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherCtx := newTestContext(otherParams, otherBtparams)
+	other, err := stream.Dial(otherCtx, "tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	if _, err := other.Evaluate("linear", otherCtx.Encrypt(lattigo_key.NewPlaintext(samples))); !errors.Is(err, lattigo_key.ErrFingerprintMismatch) {
+		t.Fatalf("Expected a fingerprint mismatch, got %v", err)
+	}
+	otherResp, err := otherCtx.RespondEvaluationKeys(&lattigo_key.EvaluationKeyRequest{Fingerprint: otherCtx.Fingerprint(), Rotations: []int{7}}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := other.UploadEvaluationKeys(otherResp); !errors.Is(err, lattigo_key.ErrFingerprintMismatch) {
+		t.Fatalf("Expected a fingerprint mismatch, got %v", err)
+	}
+
+	// Frames larger than the limit of the server close the connection
+	small := stream.NewServer(serverCtx)
+	small.MaxFrameBytes = 1 << 10
+	smallConn, smallServerConn := net.Pipe()
+	go small.ServeConn(smallServerConn)
+	if _, err := stream.NewClient(ctx, smallConn).Evaluate("linear", ctxt); err == nil {
+		t.Fatal("Server accepted a frame larger than its limit")
+	}
+
+	// Ciphertexts larger than the limit of the server once decompressed are refused
+	small = stream.NewServer(serverCtx)
+	small.MaxDecompressedBytes = 1 << 10
+	small.Register("linear", server.LinearScorer(weights, 0.1))
+	smallConn, smallServerConn = net.Pipe()
+	go small.ServeConn(smallServerConn)
+	if _, err := stream.NewClient(ctx, smallConn).Evaluate("linear", ctxt); err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Fatalf("Evaluating a ciphertext larger than the limit returned %v", err)
+	}
+
+	// Frames of other versions are refused
+	versionConn, versionServerConn := net.Pipe()
+	go srv.ServeConn(versionServerConn)
+	header := append([]byte("HEFR"), stream.ProtocolVersion+1, 4)
+	header = append(header, fp[:]...)
+	header = append(header, make([]byte, 8)...)
+	if _, err := versionConn.Write(header); err != nil {
+		t.Fatal(err)
+	}
+	answer, _ := io.ReadAll(versionConn)
+	if !strings.Contains(string(answer), "unsupported protocol version") {
+		t.Fatalf("Server answered %q to a frame of another version", answer)
+	}
+}
@@ -1,11 +1,21 @@
 package test
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/JihunSKKU/HE-CCFD/lattigo_key"
+	"github.com/tuneinsight/lattigo/v5/he/hefloat"
+	"github.com/tuneinsight/lattigo/v5/he/hefloat/bootstrapping"
+	"github.com/tuneinsight/lattigo/v5/utils"
 )
 
 func TestSaveKeys(t *testing.T) {
@@ -45,3 +55,1059 @@ func TestLoadKeys(t *testing.T) {
 	ctx.PrintKeySizes()
 }
 
+
+func TestPackedEncrypt(t *testing.T) {
+	params, btparams := initTestBtParams()
+	ctx := newTestContext(params, btparams)
+
+	data := make([][]float64, 100)
+	for i := range data {
+		data[i] = make([]float64, 30)
+		for j := range data[i] {
+			data[i][j] = float64(i) + float64(j)/100
+		}
+	}
+
+	ctxt := ctx.Encrypt(lattigo_key.NewPackedPlaintext(data))
+	perCtxt := params.MaxSlots() / 32
+	if want := (len(data) + perCtxt - 1) / perCtxt; len(ctxt.GetData()) != want {
+		t.Fatalf("Packed %d samples into %d ciphertexts, want %d", len(data), len(ctxt.GetData()), want)
+	}
+
+	rows := ctx.Decrypt(ctxt).GetData()
+	if len(rows) != len(data) {
+		t.Fatalf("Decrypted %d rows, want %d", len(rows), len(data))
+	}
+	for i := range data {
+		for j := range rows[i] {
+			want := 0.0
+			if j < len(data[i]) {
+				want = data[i][j]
+			}
+			if math.Abs(rows[i][j]-want) > 1e-6 {
+				t.Fatalf("Sample %d feature %d: got %f, want %f", i, j, rows[i][j], want)
+			}
+		}
+	}
+}
+
+func TestPackedInterval(t *testing.T) {
+	params, btparams := initTestBtParams()
+	ctx := newTestContext(params, btparams)
+	slots := params.MaxSlots()
+
+	// withInterval returns ctxt with the interval of its header set to interval, which
+	// follows the magic, the version, the fingerprint and the size
+	withInterval := func(ctxt *lattigo_key.Ciphertext, interval uint64) *lattigo_key.Ciphertext {
+		data, err := ctxt.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		binary.LittleEndian.PutUint64(data[len("HECT")+1+len(lattigo_key.Fingerprint{})+8:], interval)
+		out := new(lattigo_key.Ciphertext)
+		if err := out.UnmarshalBinary(data); err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+	check := func(name string, rows, want [][]float64) {
+		if len(rows) != len(want) {
+			t.Fatalf("%s: decrypted %d rows, want %d", name, len(rows), len(want))
+		}
+		for i := range want {
+			for j := range want[i] {
+				if math.Abs(rows[i][j]-want[i][j]) > 1e-6 {
+					t.Fatalf("%s: sample %d value %d: got %f, want %f", name, i, j, rows[i][j], want[i][j])
+				}
+			}
+		}
+	}
+
+	// One sample per ciphertext at interval 2 reads every other slot of the first half
+	x := [][]float64{make([]float64, slots/2)}
+	for j := range x[0] {
+		x[0][j] = float64(j%13) / 8
+	}
+	strided := make([]float64, slots/2)
+	for j := 0; 2*j < len(x[0]); j++ {
+		strided[j] = x[0][2*j]
+	}
+	ptxt := ctx.Decrypt(withInterval(ctx.Encrypt(lattigo_key.NewPlaintext(x)), 2))
+	check("interval", ptxt.GetData(), [][]float64{strided})
+	check("interval round trip", ctx.Decrypt(ctx.Encrypt(ptxt)).GetData(), [][]float64{strided})
+
+	// Packed samples at interval 2 take blocks of twice their space: the slots of one
+	// ciphertext of slots/8 samples hold slots/16 blocks
+	data := make([][]float64, slots/8)
+	for i := range data {
+		data[i] = make([]float64, 8)
+		for j := range data[i] {
+			data[i][j] = float64(i) + float64(j)/10
+		}
+	}
+	perCtxt := slots / 16
+	want := make([][]float64, perCtxt)
+	for k := range want {
+		want[k] = make([]float64, 8)
+		for j := range want[k] {
+			// Value j of block k is at slot 16k+2j, which held value 2j%8 of sample 2k+2j/8
+			want[k][j] = data[2*k+2*j/8][2*j%8]
+		}
+	}
+	ptxt = ctx.Decrypt(withInterval(ctx.Encrypt(lattigo_key.NewPackedPlaintext(data)), 2))
+	check("packed interval", ptxt.GetData(), want)
+
+	ctxt := ctx.Encrypt(ptxt)
+	if wantCtxt := (len(want) + perCtxt - 1) / perCtxt; len(ctxt.GetData()) != wantCtxt {
+		t.Fatalf("Packed %d samples at interval 2 into %d ciphertexts, want %d", len(want), len(ctxt.GetData()), wantCtxt)
+	}
+	check("packed interval round trip", ctx.Decrypt(ctxt).GetData(), want)
+}
+
+func TestCiphertextSerialization(t *testing.T) {
+	params, btparams := initTestBtParams()
+	ctx := newTestContext(params, btparams)
+
+	data := [][]float64{{1, 2, 3, 4, 5}, {6, 7, 8, 9, 10}, {11, 12, 13, 14, 15}}
+	ctxt := ctx.Encrypt(lattigo_key.NewPackedPlaintext(data))
+
+	ctxtBytes, err := ctxt.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Failed to marshal ciphertext: %v", err)
+	}
+	if len(ctxtBytes) != ctxt.BinarySize() {
+		t.Fatalf("Marshalled %d bytes, BinarySize is %d", len(ctxtBytes), ctxt.BinarySize())
+	}
+
+	// Round trips through a file to check that the format streams
+	path := filepath.Join(t.TempDir(), "ctxt")
+	if err := os.WriteFile(path, ctxtBytes, 0644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	loaded := new(lattigo_key.Ciphertext)
+	if _, err := loaded.ReadFrom(file); err != nil {
+		t.Fatalf("Failed to read ciphertext: %v", err)
+	}
+	if loaded.Fingerprint() != ctx.Fingerprint() || !loaded.IsPacked() || loaded.NumSamples() != len(data) {
+		t.Fatal("Ciphertext metadata was not preserved")
+	}
+
+	rows := ctx.Decrypt(loaded).GetData()
+	for i := range data {
+		for j := range data[i] {
+			if math.Abs(rows[i][j]-data[i][j]) > 1e-6 {
+				t.Fatalf("Sample %d feature %d: got %f, want %f", i, j, rows[i][j], data[i][j])
+			}
+		}
+	}
+}
+
+func TestHostileCiphertext(t *testing.T) {
+	params, btparams := initTestBtParams()
+	ctx := newTestContext(params, btparams)
+
+	ctxt := ctx.Encrypt(lattigo_key.NewPackedPlaintext([][]float64{{1, 2, 3}, {4, 5, 6}}))
+	valid, err := ctxt.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The header is magic, version, fingerprint, then size, interval, constVal and space,
+	// flags, numSamples and the number of ciphertexts, followed by the first ciphertext:
+	// its metadata, then its number of polynomials, of moduli and of coefficients
+	const (
+		sizeAt       = len("HECT") + 1 + len(lattigo_key.Fingerprint{})
+		intervalAt   = sizeAt + 8
+		spaceAt      = sizeAt + 24
+		numSamplesAt = sizeAt + 33
+		numCtxtAt    = sizeAt + 41
+		ctxtAt       = sizeAt + 49
+	)
+	degreeAt := ctxtAt + 1 + ctxt.GetData()[0].MetaData.BinarySize()
+	forged := func(at int, v uint64) []byte {
+		data := append([]byte(nil), valid...)
+		binary.LittleEndian.PutUint64(data[at:], v)
+		return data
+	}
+
+	payloads := map[string][]byte{
+		"ciphertexts 1<<63":            forged(numCtxtAt, 1<<63),
+		"ciphertexts 1<<36":            forged(numCtxtAt, 1<<36),
+		"ciphertexts 1<<36 truncated":  forged(numCtxtAt, 1<<36)[:ctxtAt],
+		"no ciphertexts":               forged(numCtxtAt, 0),
+		"samples 1<<36":                forged(numSamplesAt, 1<<36),
+		"interval 0":                   forged(intervalAt, 0),
+		"space 1<<40":                  forged(spaceAt, 1<<40),
+		"size 1<<40":                   forged(sizeAt, 1<<40),
+		"polynomials 1<<36":            forged(degreeAt, 1<<36),
+		"moduli 1<<36":                 forged(degreeAt+8, 1<<36),
+		"coefficients 1<<36":           forged(degreeAt+16, 1<<36),
+		"coefficients not power of 2":  forged(degreeAt+16, uint64(params.N())-1),
+	}
+	for name, data := range payloads {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Fatalf("%s: panicked: %v", name, r)
+				}
+			}()
+			if err := new(lattigo_key.Ciphertext).UnmarshalBinary(data); err == nil {
+				t.Fatalf("%s: read a forged ciphertext", name)
+			}
+		}()
+	}
+
+	if err := new(lattigo_key.Ciphertext).UnmarshalBinary(valid); err != nil {
+		t.Fatalf("Failed to read the valid ciphertext: %v", err)
+	}
+}
+
+func TestSymmetricEncrypt(t *testing.T) {
+	params, btparams := initTestBtParams()
+	ctx := newTestContext(params, btparams)
+
+	data := [][]float64{{1, 2, 3, 4, 5}, {6, 7, 8, 9, 10}, {11, 12, 13, 14, 15}}
+	check := func(name string, ctxt *lattigo_key.Ciphertext, rot int) {
+		rows := ctx.Decrypt(ctxt).GetData()
+		for i := range data {
+			for j := range data[i] {
+				want := 0.0
+				if j+rot < len(data[i]) {
+					want = data[i][j+rot]
+				}
+				if math.Abs(rows[i][j]-want) > 1e-6 {
+					t.Fatalf("%s: sample %d feature %d: got %f, want %f", name, i, j, rows[i][j], want)
+				}
+			}
+		}
+	}
+
+	public, err := ctx.Encrypt(lattigo_key.NewPlaintext(data)).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctxt := ctx.EncryptWithOptions(lattigo_key.NewPlaintext(data), lattigo_key.EncryptOptions{Symmetric: true})
+	if !ctxt.IsSeeded() {
+		t.Fatal("Symmetric encryption is not seeded")
+	}
+	check("symmetric", ctxt, 0)
+
+	// The seeds replace the uniform components, which halves the size
+	seeded, err := ctxt.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seeded) != ctxt.BinarySize() {
+		t.Fatalf("Marshalled %d bytes, BinarySize is %d", len(seeded), ctxt.BinarySize())
+	}
+	if ratio := float64(len(seeded)) / float64(len(public)); ratio > 0.51 {
+		t.Fatalf("Seeded ciphertext of %d bytes is %.2f of the public key one", len(seeded), ratio)
+	}
+
+	// The loaded ciphertext holds the expanded uniform components, and is still seeded
+	loaded := new(lattigo_key.Ciphertext)
+	if err := loaded.UnmarshalBinary(seeded); err != nil {
+		t.Fatalf("Failed to read seeded ciphertext: %v", err)
+	}
+	for i, ct := range loaded.GetData() {
+		if !ct.Value[1].Equal(&ctxt.GetData()[i].Value[1]) {
+			t.Fatalf("Ciphertext %d: the uniform component was not expanded from its seed", i)
+		}
+	}
+	check("loaded", loaded, 0)
+	if again, err := loaded.MarshalBinary(); err != nil || !bytes.Equal(again, seeded) {
+		t.Fatalf("Loaded ciphertext is not written back in seeded form: %v", err)
+	}
+
+	compressed, err := ctxt.MarshalBinaryCompressed(lattigo_key.CodecZstd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := loaded.UnmarshalBinary(compressed); err != nil {
+		t.Fatalf("Failed to read compressed seeded ciphertext: %v", err)
+	}
+	check("compressed", loaded, 0)
+
+	// A ciphertext evaluated in place no longer matches its seed and is written in full
+	for _, ct := range loaded.GetData() {
+		if err := ctx.Rotation(ct, 1, ct); err != nil {
+			t.Fatal(err)
+		}
+	}
+	evaluated, err := loaded.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(evaluated) <= len(seeded) {
+		t.Fatalf("Evaluated ciphertext of %d bytes was written with stale seeds", len(evaluated))
+	}
+	if err := loaded.UnmarshalBinary(evaluated); err != nil {
+		t.Fatal(err)
+	}
+	check("evaluated", loaded, 1)
+}
+
+func TestEncryptLevelScale(t *testing.T) {
+	params, btparams := initTestBtParams()
+	ctx := newTestContext(params, btparams)
+	eval := ctx.GetEval()
+	defer ctx.PutEval(eval)
+
+	x := [][]float64{{0.5, -0.25, 0.75, 1}, {-1, 0.125, 0.5, -0.5}}
+	w := [][]float64{{2, 0.5, -1, 0.25}, {0.5, 4, -0.5, 1}}
+	check := func(name string, ctxt *lattigo_key.Ciphertext, want func(i, j int) float64, tolerance float64) {
+		rows := ctx.Decrypt(ctxt).GetData()
+		for i := range x {
+			for j := range x[i] {
+				if math.Abs(rows[i][j]-want(i, j)) > tolerance {
+					t.Fatalf("%s: sample %d feature %d: got %f, want %f", name, i, j, rows[i][j], want(i, j))
+				}
+			}
+		}
+	}
+
+	// Lower levels give smaller ciphertexts
+	level := 2
+	ctxt := ctx.EncryptWithOptions(lattigo_key.NewPlaintext(x), lattigo_key.EncryptOptions{Level: utils.Pointy(level)})
+	full := ctx.Encrypt(lattigo_key.NewPlaintext(x))
+	if ct := ctxt.GetData()[0]; ct.Level() != level || ct.Scale.Cmp(params.DefaultScale()) != 0 {
+		t.Fatalf("Encrypted at level %d and scale %v, want level %d and the default scale", ct.Level(), ct.Scale.Float64(), level)
+	}
+	if ctxt.BinarySize() >= full.BinarySize()*(level+2)/(params.MaxLevel()+1) {
+		t.Fatalf("Ciphertext at level %d of %d bytes, %d bytes at the maximum level", level, ctxt.BinarySize(), full.BinarySize())
+	}
+	check("level", ctxt, func(i, j int) float64 { return x[i][j] }, 1e-6)
+
+	// Operands at the level and scale of an evaluated ciphertext are added to it directly
+	for _, ct := range ctxt.GetData() {
+		if err := eval.MulRelin(ct, ct, ct); err != nil {
+			t.Fatal(err)
+		}
+		if err := eval.Rescale(ct, ct); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ct := ctxt.GetData()[0]
+	matched := ctx.EncryptWithOptions(lattigo_key.NewPlaintext(w), lattigo_key.EncryptOptions{Level: utils.Pointy(ct.Level()), Scale: &ct.Scale, Symmetric: true})
+	for i, ct := range ctxt.GetData() {
+		if !ct.Scale.InDelta(matched.GetData()[i].Scale, 0) || ct.Level() != matched.GetData()[i].Level() {
+			t.Fatalf("Ciphertext %d does not match the level and scale of the operand", i)
+		}
+		if err := eval.Add(ct, matched.GetData()[i], ct); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check("sum", ctxt, func(i, j int) float64 { return x[i][j]*x[i][j] + w[i][j] }, 1e-4)
+
+	// Seeded ciphertexts at a lower level and scale round trip
+	data, err := matched.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := matched.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	check("seeded", matched, func(i, j int) float64 { return w[i][j] }, 1e-4)
+
+	// Plaintext operands at the modulus scale keep the scale of the ciphertext
+	ctxt = ctx.EncryptWithOptions(lattigo_key.NewPlaintext(x), lattigo_key.EncryptOptions{Level: utils.Pointy(level)})
+	operandScale := ctx.OperandScale(level)
+	operands := ctx.Encode(lattigo_key.NewPlaintext(w), lattigo_key.EncryptOptions{Level: utils.Pointy(level), Scale: &operandScale})
+	for i, ct := range ctxt.GetData() {
+		if err := eval.Mul(ct, operands[i], ct); err != nil {
+			t.Fatal(err)
+		}
+		if err := eval.Rescale(ct, ct); err != nil {
+			t.Fatal(err)
+		}
+		if ct.Scale.Cmp(params.DefaultScale()) != 0 {
+			t.Fatalf("Product has scale %v, want the default scale", ct.Scale.Float64())
+		}
+	}
+	check("product", ctxt, func(i, j int) float64 { return x[i][j] * w[i][j] }, 1e-4)
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("Encrypted above the maximum level")
+			}
+		}()
+		ctx.EncryptWithOptions(lattigo_key.NewPlaintext(x), lattigo_key.EncryptOptions{Level: utils.Pointy(params.MaxLevel() + 1)})
+	}()
+}
+
+func TestComplexEncrypt(t *testing.T) {
+	params, btparams := initTestBtParams()
+	ctx := newTestContext(params, btparams)
+
+	// Two real vectors per sample, as the real and imaginary parts
+	x := [][]float64{{0.5, -0.25, 0.75, 1, 0.5}, {-1, 0.125, 0.5, -0.5, 2}, {3, 1, -2, 0.25, 0}}
+	y := [][]float64{{1, 2, 3, 4, 5}, {-0.5, 0.5, -1.5, 1.5, 0}, {0.25, -0.75, 1, 0, -3}}
+	data := make([][]complex128, len(x))
+	for i := range x {
+		data[i] = make([]complex128, len(x[i]))
+		for j := range x[i] {
+			data[i][j] = complex(x[i][j], y[i][j])
+		}
+	}
+	check := func(name string, ptxt *lattigo_key.Plaintext) {
+		if !ptxt.IsComplex() || len(ptxt.GetData()) != len(x) {
+			t.Fatalf("%s: decrypted %d real samples, want %d complex samples", name, len(ptxt.GetData()), len(x))
+		}
+		re, im, values := ptxt.GetData(), ptxt.GetImagData(), ptxt.GetComplexData()
+		for i := range x {
+			for j := range x[i] {
+				if math.Abs(re[i][j]-x[i][j]) > 1e-6 || math.Abs(im[i][j]-y[i][j]) > 1e-6 || values[i][j] != complex(re[i][j], im[i][j]) {
+					t.Fatalf("%s: sample %d value %d: got %v, want %v", name, i, j, values[i][j], data[i][j])
+				}
+			}
+		}
+	}
+
+	for _, ptxt := range []*lattigo_key.Plaintext{lattigo_key.NewComplexPlaintext(data), lattigo_key.NewPackedComplexPlaintext(data)} {
+		for _, symmetric := range []bool{false, true} {
+			name := fmt.Sprintf("packed %t symmetric %t", ptxt.IsPacked(), symmetric)
+			ctxt := ctx.EncryptWithOptions(ptxt, lattigo_key.EncryptOptions{Symmetric: symmetric})
+			if !ctxt.IsComplex() {
+				t.Fatalf("%s: ciphertext is not complex", name)
+			}
+			check(name, ctx.Decrypt(ctxt))
+
+			data, err := ctxt.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(data) != ctxt.BinarySize() {
+				t.Fatalf("%s: marshalled %d bytes, BinarySize is %d", name, len(data), ctxt.BinarySize())
+			}
+			loaded := new(lattigo_key.Ciphertext)
+			if err := loaded.UnmarshalBinary(data); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if !loaded.IsComplex() || loaded.IsPacked() != ptxt.IsPacked() || loaded.IsSeeded() != symmetric {
+				t.Fatalf("%s: ciphertext metadata was not preserved", name)
+			}
+			check(name+" loaded", ctx.Decrypt(loaded))
+		}
+	}
+
+	// Real samples are still written in the first version, and decrypted without imaginary parts
+	ctxt := ctx.Encrypt(lattigo_key.NewPlaintext(x))
+	encoded, err := ctxt.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version := encoded[len("HECT")]; version != 1 {
+		t.Fatalf("Real ciphertext written in version %d, want 1", version)
+	}
+	if ptxt := ctx.Decrypt(ctxt); ptxt.IsComplex() || ptxt.GetImagData() != nil {
+		t.Fatal("Real ciphertext decrypted to complex samples")
+	}
+}
+
+func TestConjugateInvariant(t *testing.T) {
+	params, btparams := initTestRealBtParams()
+	ctx := newTestContext(params, btparams)
+	slots := params.MaxSlots()
+	if slots != params.N() {
+		t.Fatalf("ConjugateInvariant parameters have %d slots, want N = %d", slots, params.N())
+	}
+
+	// One sample over all the real slots
+	x := make([][]float64, 1)
+	x[0] = make([]float64, slots)
+	for j := range x[0] {
+		x[0][j] = float64(j%17)/16 - 0.5
+	}
+	ctxt := ctx.Encrypt(lattigo_key.NewPlaintext(x))
+	if ctxt.Slots() != slots {
+		t.Fatalf("Ciphertext has %d slots, want %d", ctxt.Slots(), slots)
+	}
+	rows := ctx.Decrypt(ctxt).GetData()
+	for j := range x[0] {
+		if math.Abs(rows[0][j]-x[0][j]) > 1e-6 {
+			t.Fatalf("Slot %d: got %f, want %f", j, rows[0][j], x[0][j])
+		}
+	}
+
+	// Rotations are over the N real slots, with a key or composed by the planner
+	for _, k := range []int{1, 5, slots / 2, 700, -333} {
+		rotated := ctxt.CopyNew()
+		if err := ctx.Rotation(ctxt.GetData()[0], k, rotated.GetData()[0]); err != nil {
+			t.Fatalf("Rotation by %d: %v", k, err)
+		}
+		rows := ctx.Decrypt(rotated).GetData()
+		for j := range x[0] {
+			if want := x[0][((j+k)%slots+slots)%slots]; math.Abs(rows[0][j]-want) > 1e-5 {
+				t.Fatalf("Rotation by %d: slot %d: got %f, want %f", k, j, rows[0][j], want)
+			}
+		}
+	}
+
+	// Packed samples fill twice the slots of Standard parameters of the same degree
+	data := make([][]float64, 100)
+	for i := range data {
+		data[i] = make([]float64, 30)
+		for j := range data[i] {
+			data[i][j] = float64(i) + float64(j)/100
+		}
+	}
+	packed := ctx.Encrypt(lattigo_key.NewPackedPlaintext(data))
+	perCtxt := slots / 32
+	if want := (len(data) + perCtxt - 1) / perCtxt; len(packed.GetData()) != want {
+		t.Fatalf("Packed %d samples into %d ciphertexts, want %d", len(data), len(packed.GetData()), want)
+	}
+	rows = ctx.Decrypt(packed).GetData()
+	for i := range data {
+		for j := range data[i] {
+			if math.Abs(rows[i][j]-data[i][j]) > 1e-6 {
+				t.Fatalf("Sample %d feature %d: got %f, want %f", i, j, rows[i][j], data[i][j])
+			}
+		}
+	}
+
+	// Bootstrapping goes through the Standard ring of twice the degree
+	refreshed, err := ctx.Bootstrap(ctxt.GetData()[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refreshed.Level() != params.MaxLevel() {
+		t.Fatalf("Bootstrapped to level %d, want %d", refreshed.Level(), params.MaxLevel())
+	}
+	ctxt.GetData()[0] = refreshed
+	rows = ctx.Decrypt(ctxt).GetData()
+	for j := range x[0] {
+		if math.Abs(rows[0][j]-x[0][j]) > 1e-4 {
+			t.Fatalf("Bootstrapped slot %d: got %f, want %f", j, rows[0][j], x[0][j])
+		}
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("Encrypted complex samples under ConjugateInvariant parameters")
+			}
+		}()
+		ctx.Encrypt(lattigo_key.NewComplexPlaintext([][]complex128{{1 + 2i}}))
+	}()
+}
+
+func TestFingerprint(t *testing.T) {
+	params, btparams := initTestBtParams()
+	ctx := newTestContext(params, btparams)
+
+	dirPath := filepath.Join(t.TempDir(), "keys")
+	if err := ctx.SaveKeys(dirPath); err != nil {
+		t.Fatalf("Failed to save keys: %v", err)
+	}
+	loaded, err := lattigo_key.LoadKeys(dirPath)
+	if err != nil {
+		t.Fatalf("Failed to load keys: %v", err)
+	}
+	if loaded.Fingerprint() != ctx.Fingerprint() {
+		t.Fatalf("Fingerprint changed from %s to %s after LoadKeys", ctx.Fingerprint(), loaded.Fingerprint())
+	}
+
+	// A context under other parameters must refuse the keys and ciphertexts of ctx
+	lit := params.ParametersLiteral()
+	lit.LogDefaultScale = 39
+	otherParams, err := hefloat.NewParametersFromLiteral(hefloat.ParametersLiteral(lit))
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherBtparams, err := bootstrapping.NewParametersFromLiteral(otherParams, bootstrapping.ParametersLiteral{LogN: utils.Pointy(otherParams.LogN())})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := newTestContext(otherParams, otherBtparams)
+	if other.Fingerprint() == ctx.Fingerprint() {
+		t.Fatal("Different parameters have the same fingerprint")
+	}
+
+	ctxt := other.Encrypt(lattigo_key.NewPlaintext([][]float64{{1, 2, 3}}))
+	model := &lattigo_key.MLP{Layers: []lattigo_key.DenseLayer{{Weights: [][]float64{{1, 1, 1}}, Bias: []float64{0}}}}
+	if _, err := ctx.EvaluateMLP(model, ctxt); !errors.Is(err, lattigo_key.ErrFingerprintMismatch) {
+		t.Fatalf("Expected a fingerprint mismatch, got %v", err)
+	}
+
+	otherDirPath := filepath.Join(t.TempDir(), "other")
+	if err := other.SaveKeys(otherDirPath); err != nil {
+		t.Fatalf("Failed to save keys: %v", err)
+	}
+	galkBytes, err := os.ReadFile(filepath.Join(otherDirPath, "galks", "galk_0.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dirPath, "galks", "galk_0.key"), galkBytes, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lattigo_key.LoadKeys(dirPath); !errors.Is(err, lattigo_key.ErrFingerprintMismatch) {
+		t.Fatalf("Expected a fingerprint mismatch, got %v", err)
+	}
+
+	// A zeroed fingerprint does not skip the check, and files without header are only read as legacy files
+	header := len("HEKY") + len(lattigo_key.Fingerprint{})
+	for _, legacy := range []bool{false, true} {
+		dirPath := filepath.Join(t.TempDir(), fmt.Sprintf("legacy-%t", legacy))
+		if err := ctx.SaveKeys(dirPath); err != nil {
+			t.Fatalf("Failed to save keys: %v", err)
+		}
+		pkPath := filepath.Join(dirPath, "pk.key")
+		pkBytes, err := os.ReadFile(pkPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(pkPath, pkBytes[header:], 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err = lattigo_key.LoadKeysWithOptions(dirPath, lattigo_key.LoadOptions{Legacy: legacy})
+		if legacy && err != nil {
+			t.Fatalf("Failed to load a key file without header as a legacy file: %v", err)
+		}
+		if !legacy && !errors.Is(err, lattigo_key.ErrFingerprintMismatch) {
+			t.Fatalf("Expected a fingerprint mismatch for a key file without header, got %v", err)
+		}
+
+		zeroed := append([]byte(nil), pkBytes...)
+		copy(zeroed[len("HEKY"):header], make([]byte, len(lattigo_key.Fingerprint{})))
+		if err := os.WriteFile(pkPath, zeroed, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := lattigo_key.LoadKeysWithOptions(dirPath, lattigo_key.LoadOptions{Legacy: legacy}); !errors.Is(err, lattigo_key.ErrFingerprintMismatch) {
+			t.Fatalf("Expected a fingerprint mismatch for a zeroed fingerprint, got %v", err)
+		}
+	}
+
+	ctxtBytes, err := ctx.Encrypt(lattigo_key.NewPlaintext([][]float64{{1, 2, 3}})).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(ctxtBytes[len("HECT")+1:], make([]byte, len(lattigo_key.Fingerprint{})))
+	if err := new(lattigo_key.Ciphertext).UnmarshalBinary(ctxtBytes); !errors.Is(err, lattigo_key.ErrFingerprintMismatch) {
+		t.Fatalf("Expected a fingerprint mismatch for a zeroed ciphertext fingerprint, got %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	params, btparams := initTestBtParams()
+	ctx := newTestContext(params, btparams)
+
+	report, err := ctx.Validate(lattigo_key.ValidateOptions{})
+	if err != nil {
+		t.Fatalf("Failed to validate keys: %v", err)
+	}
+	if !report.OK() {
+		t.Fatalf("Fresh keys are inconsistent:\n%s", report)
+	}
+
+	// Mixes up the public key and a galois key of two key directories under the same parameters
+	dirPath := filepath.Join(t.TempDir(), "keys")
+	if err := ctx.SaveKeys(dirPath); err != nil {
+		t.Fatalf("Failed to save keys: %v", err)
+	}
+	otherDirPath := filepath.Join(t.TempDir(), "other")
+	if err := newTestContext(params, btparams).SaveKeys(otherDirPath); err != nil {
+		t.Fatalf("Failed to save keys: %v", err)
+	}
+	for _, name := range []string{"pk.key", "galks/galk_0.key"} {
+		keyBytes, err := os.ReadFile(filepath.Join(otherDirPath, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dirPath, name), keyBytes, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err = lattigo_key.LoadKeys(dirPath)
+	if !errors.Is(err, lattigo_key.ErrInconsistentKeys) {
+		t.Fatalf("Expected inconsistent keys, got %v", err)
+	}
+	for _, name := range []string{"pk.key", "galks/galk_0.key"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("Error %q does not name %s", err, name)
+		}
+	}
+
+	// LoadKeys skips the bootstrapping keys, Validate names the one that was mixed up
+	if err := os.RemoveAll(dirPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.SaveKeys(dirPath); err != nil {
+		t.Fatalf("Failed to save keys: %v", err)
+	}
+	keyBytes, err := os.ReadFile(filepath.Join(otherDirPath, "btp_dense_to_sparse.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dirPath, "btp_dense_to_sparse.key"), keyBytes, 0644); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := lattigo_key.LoadKeys(dirPath)
+	if err != nil {
+		t.Fatalf("Failed to load keys: %v", err)
+	}
+	report, err = loaded.Validate(lattigo_key.ValidateOptions{GaloisSamples: 1})
+	if err != nil {
+		t.Fatalf("Failed to validate keys: %v", err)
+	}
+	inconsistent := strings.Join(report.Inconsistent(), ", ")
+	if !strings.Contains(inconsistent, "btp_dense_to_sparse.key") || strings.Contains(inconsistent, "btp_sparse_to_dense.key") {
+		t.Errorf("Expected btp_dense_to_sparse.key alone among the bootstrapping keys, got:\n%s", report)
+	}
+}
+
+func TestKeySizes(t *testing.T) {
+	params, btparams := initTestBtParams()
+	ctx := newTestContext(params, btparams)
+
+	dirPath := filepath.Join(t.TempDir(), "keys")
+	if err := ctx.SaveKeys(dirPath); err != nil {
+		t.Fatalf("Failed to save keys: %v", err)
+	}
+
+	report, err := ctx.KeySizes()
+	if err != nil {
+		t.Fatalf("Failed to compute key sizes: %v", err)
+	}
+
+	sizes := []lattigo_key.ArtifactSize{report.Params, report.BtParams, report.SecretKey, report.PublicKey, report.RelinearizationKey}
+	for _, galk := range report.GaloisKeys {
+		sizes = append(sizes, galk.ArtifactSize)
+	}
+	sizes = append(sizes, report.BootstrappingKeys...)
+
+	var total int64
+	for _, size := range sizes {
+		info, err := os.Stat(filepath.Join(dirPath, size.Name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() != size.DiskBytes {
+			t.Errorf("%s: reported %d bytes on disk, file has %d", size.Name, size.DiskBytes, info.Size())
+		}
+		total += size.DiskBytes
+	}
+	if total != report.TotalDiskBytes {
+		t.Errorf("Total disk size is %d, artifacts sum to %d", report.TotalDiskBytes, total)
+	}
+
+	if _, err := report.JSON(); err != nil {
+		t.Fatalf("Failed to marshal report: %v", err)
+	}
+	ctx.PrintKeySizes()
+}
+
+func TestEstimateKeyGen(t *testing.T) {
+	params, btparams := initTestBtParams()
+
+	estimate, err := lattigo_key.EstimateKeyGen(params, btparams, nil)
+	if err != nil {
+		t.Fatalf("Failed to estimate key generation: %v", err)
+	}
+
+	baseTime := time.Now()
+	ctx := newTestContext(params, btparams)
+	elapsedTime := time.Since(baseTime)
+	fmt.Printf("Estimated %v, made context in %v\n", estimate.Duration, elapsedTime)
+
+	report, err := ctx.KeySizes()
+	if err != nil {
+		t.Fatalf("Failed to compute key sizes: %v", err)
+	}
+
+	want, err := report.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	have, err := estimate.KeySizeReport.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(have) != string(want) {
+		t.Fatalf("Estimated sizes\n%s\ndiffer from the generated keys\n%s", have, want)
+	}
+	if estimate.PeakMemoryBytes < report.TotalMemoryBytes {
+		t.Fatalf("Estimated peak memory %d is below the memory of the keys %d", estimate.PeakMemoryBytes, report.TotalMemoryBytes)
+	}
+}
+
+func TestSeededContext(t *testing.T) {
+	params, btparams := initTestBtParams()
+
+	saveSeeded := func(seed string) string {
+		dirPath := filepath.Join(t.TempDir(), "keys")
+		if err := lattigo_key.NewContextWithOptions(params, btparams, lattigo_key.ContextOptions{Seed: []byte(seed), Insecure: true}).SaveKeys(dirPath); err != nil {
+			t.Fatalf("Failed to save keys: %v", err)
+		}
+		return dirPath
+	}
+	dirPath, sameDirPath, otherDirPath := saveSeeded("fixture"), saveSeeded("fixture"), saveSeeded("other fixture")
+
+	err := filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
+		// Only keys are seeded, the test ciphertext is a fresh encryption
+		if err != nil || info.IsDir() || !strings.HasSuffix(path, ".key") {
+			return err
+		}
+		name, _ := filepath.Rel(dirPath, path)
+		keyBytes, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		sameBytes, err := os.ReadFile(filepath.Join(sameDirPath, name))
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(keyBytes, sameBytes) {
+			t.Errorf("%s differs between two contexts of the same seed", name)
+		}
+		otherBytes, err := os.ReadFile(filepath.Join(otherDirPath, name))
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(keyBytes, otherBytes) {
+			t.Errorf("%s is the same for two different seeds", name)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Seeded keys, bootstrapping keys included, must be consistent with each other
+	ctx, err := lattigo_key.LoadKeys(dirPath)
+	if err != nil {
+		t.Fatalf("Failed to load keys: %v", err)
+	}
+	report, err := ctx.Validate(lattigo_key.ValidateOptions{})
+	if err != nil {
+		t.Fatalf("Failed to validate keys: %v", err)
+	}
+	if !report.OK() {
+		t.Fatalf("Seeded keys are inconsistent:\n%s", report)
+	}
+
+	// and so must the keys of a ring swapped to a larger bootstrapping ring
+	realParams, realBtparams := initTestRealBtParams()
+	realCtx := lattigo_key.NewContextWithOptions(realParams, realBtparams, lattigo_key.ContextOptions{Seed: []byte("fixture"), Insecure: true})
+	if report, err = realCtx.Validate(lattigo_key.ValidateOptions{}); err != nil {
+		t.Fatalf("Failed to validate keys: %v", err)
+	}
+	if !report.OK() {
+		t.Fatalf("Seeded keys of real parameters are inconsistent:\n%s", report)
+	}
+}
+
+// dirSize returns the total size of the files under dirPath.
+func dirSize(t *testing.T, dirPath string) (size int64) {
+	err := filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func TestSeedCompressedKeys(t *testing.T) {
+	params, btparams := initTestBtParams()
+	ctx := newTestContext(params, btparams)
+
+	dirPath := filepath.Join(t.TempDir(), "keys")
+	if err := ctx.SaveKeys(dirPath); err != nil {
+		t.Fatalf("Failed to save keys: %v", err)
+	}
+	compressedDirPath := filepath.Join(t.TempDir(), "compressed")
+	if err := ctx.SaveKeysWithOptions(compressedDirPath, lattigo_key.SaveOptions{SeedCompressed: true}); err != nil {
+		t.Fatalf("Failed to save compressed keys: %v", err)
+	}
+
+	size, compressedSize := dirSize(t, dirPath), dirSize(t, compressedDirPath)
+	fmt.Printf("Key directory: %d bytes, seed-compressed: %d bytes\n", size, compressedSize)
+	// btp.key is not duplicated in the compressed directory, nor saved when the keys are shared
+	var btpSize int64
+	if info, err := os.Stat(filepath.Join(dirPath, "btp.key")); err == nil {
+		btpSize = info.Size()
+	} else if !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	skSize, err := os.Stat(filepath.Join(dirPath, "sk.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if half := (size - btpSize - skSize.Size()) / 2; compressedSize-skSize.Size() > half+half/100 {
+		t.Fatalf("Seed-compressed keys take %d bytes, expected about %d", compressedSize-skSize.Size(), half)
+	}
+
+	// The expanded keys must be identical to the keys of ctx
+	loaded, err := lattigo_key.LoadKeys(compressedDirPath)
+	if err != nil {
+		t.Fatalf("Failed to load compressed keys: %v", err)
+	}
+	expandedDirPath := filepath.Join(t.TempDir(), "expanded")
+	if err := loaded.SaveKeys(expandedDirPath); err != nil {
+		t.Fatalf("Failed to save expanded keys: %v", err)
+	}
+	err = filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || !strings.HasSuffix(path, ".key") {
+			return err
+		}
+		name, _ := filepath.Rel(dirPath, path)
+		keyBytes, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		expandedBytes, err := os.ReadFile(filepath.Join(expandedDirPath, name))
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(keyBytes, expandedBytes) {
+			t.Errorf("%s differs after seed compression", name)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := loaded.Validate(lattigo_key.ValidateOptions{})
+	if err != nil {
+		t.Fatalf("Failed to validate keys: %v", err)
+	}
+	if !report.OK() {
+		t.Fatalf("Expanded keys are inconsistent:\n%s", report)
+	}
+
+	// Keys loaded uncompressed have lost their seeds
+	uncompressed, err := lattigo_key.LoadKeys(dirPath)
+	if err != nil {
+		t.Fatalf("Failed to load keys: %v", err)
+	}
+	if err := uncompressed.SaveKeysWithOptions(filepath.Join(t.TempDir(), "again"), lattigo_key.SaveOptions{SeedCompressed: true}); err == nil {
+		t.Fatal("Keys without seeds were seed-compressed")
+	}
+}
+
+func TestHostileSeededKey(t *testing.T) {
+	params, btparams := initTestBtParams()
+	ctx := newTestContext(params, btparams)
+
+	dirPath := filepath.Join(t.TempDir(), "keys")
+	if err := ctx.SaveKeysWithOptions(dirPath, lattigo_key.SaveOptions{SeedCompressed: true}); err != nil {
+		t.Fatalf("Failed to save compressed keys: %v", err)
+	}
+	rlkPath := filepath.Join(dirPath, "rlk.key")
+	valid, err := os.ReadFile(rlkPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The key file header is followed by the seeded key magic and the seed of the gadget,
+	// then its base two decomposition, its rows, the columns of its first row and its
+	// first polynomial: the number of moduli Q and the degree of the first one
+	const (
+		seededAt = len("HEKY") + len(lattigo_key.Fingerprint{})
+		rowsAt   = seededAt + len("HESK") + 32 + 8
+		colsAt   = rowsAt + 8
+		moduliAt = colsAt + 8
+	)
+	if string(valid[seededAt:seededAt+4]) != "HESK" {
+		t.Fatalf("rlk.key is not seed-compressed")
+	}
+	forged := func(at int, v uint64) []byte {
+		data := append([]byte(nil), valid...)
+		binary.LittleEndian.PutUint64(data[at:], v)
+		return data
+	}
+
+	payloads := map[string][]byte{
+		"base two 1<<40":     forged(rowsAt-8, 1<<40),
+		"rows 1<<62":         forged(rowsAt, 1<<62),
+		"rows 1<<36":         forged(rowsAt, 1<<36),
+		"rows 0":             forged(rowsAt, 0),
+		"columns 1<<36":      forged(colsAt, 1<<36),
+		"moduli 1<<36":       forged(moduliAt, 1<<36),
+		"coefficients 1<<36": forged(moduliAt+8, 1<<36),
+	}
+	for name, data := range payloads {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Fatalf("%s: panicked: %v", name, r)
+				}
+			}()
+			if err := os.WriteFile(rlkPath, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := lattigo_key.LoadKeys(dirPath); err == nil || !strings.Contains(err.Error(), "rlk.key") {
+				t.Fatalf("%s: loading the forged rlk.key returned %v", name, err)
+			}
+		}()
+	}
+
+	if err := os.WriteFile(rlkPath, valid, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lattigo_key.LoadKeys(dirPath); err != nil {
+		t.Fatalf("Failed to load the valid keys: %v", err)
+	}
+}
+
+func TestSharedEvaluationKeys(t *testing.T) {
+	params, btparams := initTestBtParams()
+	ctx := newTestContext(params, btparams)
+
+	// One key per Galois element, and no key set of the bootstrapping keys of its own
+	report, err := ctx.KeySizes()
+	if err != nil {
+		t.Fatalf("Failed to compute key sizes: %v", err)
+	}
+	galEls := map[uint64]bool{}
+	for _, galk := range report.GaloisKeys {
+		if galEls[galk.GaloisElement] {
+			t.Fatalf("Galois element %d has several keys", galk.GaloisElement)
+		}
+		galEls[galk.GaloisElement] = true
+	}
+	for _, galEl := range btparams.GaloisElements(btparams.BootstrappingParameters) {
+		if !galEls[galEl] {
+			t.Fatalf("Galois element %d of the bootstrapping has no key", galEl)
+		}
+	}
+	for _, size := range report.BootstrappingKeys {
+		if size.Name == "btp.key" || size.Name == "btp_memset.key" {
+			t.Fatalf("%s duplicates the shared keys", size.Name)
+		}
+	}
+
+	dirPath := filepath.Join(t.TempDir(), "keys")
+	if err := ctx.SaveKeys(dirPath); err != nil {
+		t.Fatalf("Failed to save keys: %v", err)
+	}
+	for _, name := range []string{"btp.key", "btp_memset.key"} {
+		if _, err := os.Stat(filepath.Join(dirPath, name)); !os.IsNotExist(err) {
+			t.Fatalf("%s was saved next to the shared keys", name)
+		}
+	}
+
+	loaded, err := lattigo_key.LoadKeys(dirPath)
+	if err != nil {
+		t.Fatalf("Failed to load keys: %v", err)
+	}
+	validation, err := loaded.Validate(lattigo_key.ValidateOptions{})
+	if err != nil {
+		t.Fatalf("Failed to validate keys: %v", err)
+	}
+	if !validation.OK() {
+		t.Fatalf("Shared keys are inconsistent:\n%s", validation)
+	}
+}
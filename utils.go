@@ -1,7 +1,11 @@
 package lattigo_key
 
 import (
+	"fmt"
+	"runtime"
 	"sort"
+	"sync"
+	"sync/atomic"
 )
 
 // genRots generates a list of rotations needed for a given number of slots.
@@ -103,4 +107,56 @@ func largestPowerOfTwoLessThan(n int) int {
 	}
 
 	return power
-}
\ No newline at end of file
+}
+
+// runTasks runs tasks on at most workers goroutines, or on GOMAXPROCS goroutines
+// if workers <= 0. No task is started once one has failed, and the error of the
+// first failed task in the order of tasks is returned, as if they had run one
+// after another. A task that panics fails with the panic as its error, as the
+// panic could not be recovered by the caller on the goroutine of the task.
+func runTasks(workers int, tasks []func() error) error {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > len(tasks) {
+		workers = len(tasks)
+	}
+
+	errs := make([]error, len(tasks))
+	var next int64 = -1
+	var failed int32
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(atomic.AddInt64(&next, 1))
+				if i >= len(tasks) || atomic.LoadInt32(&failed) != 0 {
+					return
+				}
+				if errs[i] = runTask(tasks[i]); errs[i] != nil {
+					atomic.StoreInt32(&failed, 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runTask runs task, with a panic returned as an error.
+func runTask(task func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("heccfd: %v", r)
+		}
+	}()
+	return task()
+}
@@ -0,0 +1,488 @@
+package lattigo_key
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"math/rand"
+	"strings"
+
+	"github.com/tuneinsight/lattigo/v5/core/rlwe"
+	"github.com/tuneinsight/lattigo/v5/he/hefloat"
+	"github.com/tuneinsight/lattigo/v5/ring"
+	"github.com/tuneinsight/lattigo/v5/ring/ringqp"
+	"github.com/tuneinsight/lattigo/v5/utils"
+)
+
+// validationTolerance is the maximum absolute error accepted on a trial operation
+// over values in [-1, 1]. Keys that do not belong to the secret key give errors
+// of the order of the values themselves.
+const validationTolerance = 1e-3
+
+// ErrInconsistentKeys is returned by LoadKeys when keys do not belong to the loaded secret key.
+var ErrInconsistentKeys = errors.New("inconsistent keys")
+
+// ValidateOptions selects the checks run by Validate.
+type ValidateOptions struct {
+	GaloisSamples     int  // Number of galois keys checked, all of them if <= 0, also for the bootstrapping keys
+	SkipBootstrapping bool // Skips the bootstrapping keys and the trial bootstrapping
+}
+
+// ArtifactCheck is the outcome of the check of one key artifact, named after
+// the file SaveKeys writes it to.
+type ArtifactCheck struct {
+	Artifact string
+	MaxError float64 // Maximum absolute error of the trial operation
+	Err      error   // Non-nil if the artifact is inconsistent with the secret key
+}
+
+// ValidationReport lists the checks run by Validate.
+type ValidationReport struct {
+	Checks []ArtifactCheck
+}
+
+// OK returns true if every checked artifact is consistent with the secret key.
+func (r *ValidationReport) OK() bool {
+	return len(r.Inconsistent()) == 0
+}
+
+// Inconsistent returns the names of the artifacts that failed their check.
+func (r *ValidationReport) Inconsistent() (artifacts []string) {
+	for _, check := range r.Checks {
+		if check.Err != nil {
+			artifacts = append(artifacts, check.Artifact)
+		}
+	}
+	return
+}
+
+func (r *ValidationReport) String() string {
+	var sb strings.Builder
+	for _, check := range r.Checks {
+		if check.Err != nil {
+			fmt.Fprintf(&sb, "%s: FAIL (%v)\n", check.Artifact, check.Err)
+		} else {
+			fmt.Fprintf(&sb, "%s: OK (max error %.2e)\n", check.Artifact, check.MaxError)
+		}
+	}
+	return sb.String()
+}
+
+// Validate checks with trial operations that the public key, the relinearization
+// key, a sample of the galois keys and the bootstrapping keys were all generated
+// from the secret key of the context. Each bootstrapping key is checked on its
+// own, see checkBootstrappingKeys, before a trial bootstrapping.
+func (ctx *Context) Validate(opts ValidateOptions) (*ValidationReport, error) {
+	if ctx.sk == nil {
+		return nil, fmt.Errorf("cannot validate keys without the secret key")
+	}
+
+	report := &ValidationReport{}
+	add := func(artifact string, maxErr float64, err error) {
+		if err == nil && !(maxErr <= validationTolerance) {
+			err = fmt.Errorf("trial operation error %.2e exceeds %.0e", maxErr, validationTolerance)
+		}
+		report.Checks = append(report.Checks, ArtifactCheck{Artifact: artifact, MaxError: maxErr, Err: err})
+	}
+
+	ecd := hefloat.NewEncoder(ctx.params)
+	skEnc := rlwe.NewEncryptor(ctx.params, ctx.sk)
+	dec := rlwe.NewDecryptor(ctx.params, ctx.sk)
+	level := ctx.params.MaxLevel()
+
+	// Public key: encrypt under pk, decrypt under sk
+	if ctx.pk == nil {
+		add("pk.key", 0, fmt.Errorf("missing"))
+	} else {
+		x := randomValues(ctx.params.MaxSlots())
+		ct, err := encryptValues(ecd, rlwe.NewEncryptor(ctx.params, ctx.pk), ctx.params, x, level)
+		if err == nil {
+			maxErr, err := decryptError(ecd, dec, ct, x)
+			add("pk.key", maxErr, err)
+		} else {
+			add("pk.key", 0, err)
+		}
+	}
+
+	// Relinearization key: x*y must decrypt to the product
+	if ctx.rlk == nil {
+		add("rlk.key", 0, fmt.Errorf("missing"))
+	} else {
+		maxErr, err := ctx.checkRelinearizationKey(ecd, skEnc, dec)
+		add("rlk.key", maxErr, err)
+	}
+
+	// Galois keys: an automorphism on the ciphertext must match the automorphism on the plaintext
+	for _, i := range sampleIndices(len(ctx.galKs), opts.GaloisSamples) {
+		maxErr, err := ctx.checkGaloisKey(ecd, skEnc, dec, ctx.galKs[i])
+		add(fmt.Sprintf("galks/galk_%d.key", i), maxErr, err)
+	}
+
+	// Bootstrapping keys: each key must decrypt to its input secret under its output
+	// secret, and a bootstrapped ciphertext must decrypt to its input
+	if !opts.SkipBootstrapping {
+		if ctx.btpEvalPool == nil || ctx.btpkeys == nil {
+			add("btp.key", 0, fmt.Errorf("missing"))
+		} else {
+			ctx.checkBootstrappingKeys(opts, add)
+
+			x := randomValues(ctx.params.MaxSlots())
+			ct, err := encryptValues(ecd, skEnc, ctx.params, x, 0)
+			if err == nil {
+				ct, err = ctx.Bootstrap(ct)
+			}
+			if err == nil {
+				maxErr, err := decryptError(ecd, dec, ct, x)
+				add("btp.key", maxErr, err)
+			} else {
+				add("btp.key", 0, err)
+			}
+		}
+	}
+
+	return report, nil
+}
+
+func (ctx *Context) checkRelinearizationKey(ecd *hefloat.Encoder, enc *rlwe.Encryptor, dec *rlwe.Decryptor) (float64, error) {
+	level := ctx.params.MaxLevel()
+	x, y := randomValues(ctx.params.MaxSlots()), randomValues(ctx.params.MaxSlots())
+
+	ctX, err := encryptValues(ecd, enc, ctx.params, x, level)
+	if err != nil {
+		return 0, err
+	}
+	ctY, err := encryptValues(ecd, enc, ctx.params, y, level)
+	if err != nil {
+		return 0, err
+	}
+
+	eval := hefloat.NewEvaluator(ctx.evalParams(), rlwe.NewMemEvaluationKeySet(ctx.rlk))
+	ct, err := eval.MulRelinNew(ctX, ctY)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range x {
+		x[i] *= y[i]
+	}
+	return decryptError(ecd, dec, ct, x)
+}
+
+func (ctx *Context) checkGaloisKey(ecd *hefloat.Encoder, enc *rlwe.Encryptor, dec *rlwe.Decryptor, galk *rlwe.GaloisKey) (float64, error) {
+	level := ctx.params.MaxLevel()
+
+	pt := hefloat.NewPlaintext(ctx.params, level)
+	if err := ecd.Encode(randomValues(ctx.params.MaxSlots()), pt); err != nil {
+		return 0, err
+	}
+	ct, err := enc.EncryptNew(pt)
+	if err != nil {
+		return 0, err
+	}
+
+	eval := hefloat.NewEvaluator(ctx.evalParams(), rlwe.NewMemEvaluationKeySet(nil, galk))
+	if err = eval.Automorphism(ct, galk.GaloisElement, ct); err != nil {
+		return 0, err
+	}
+
+	ptAuto := hefloat.NewPlaintext(ctx.params, level)
+	ctx.params.RingQ().AtLevel(level).AutomorphismNTT(pt.Value, galk.GaloisElement, ptAuto.Value)
+	want := make([]float64, ctx.params.MaxSlots())
+	if err = ecd.Decode(ptAuto, want); err != nil {
+		return 0, err
+	}
+
+	return decryptError(ecd, dec, ct, want)
+}
+
+// checkBootstrappingKeys checks each bootstrapping key by decrypting its gadget
+// ciphertext, and reports it under the name SaveKeys writes it to. The secret keys
+// of the bootstrapping ring are not stored: when its degree differs from the one of
+// the context, the bootstrapping secret is recovered from the key that switches it
+// back to the secret key of the context, and the sparse secret from the key that
+// switches it to the bootstrapping secret. The keys that depend on a secret that
+// cannot be recovered are not checked, as the key it comes from is already reported.
+// With shared keys, the relinearization and galois keys are checked as rlk.key and galks.
+func (ctx *Context) checkBootstrappingKeys(opts ValidateOptions, add func(artifact string, maxErr float64, err error)) {
+	paramsN2 := ctx.btparams.BootstrappingParameters
+	params := *paramsN2.GetRLWEParameters()
+	keys := ctx.btpkeys
+	scale := paramsN2.DefaultScale().Float64()
+
+	// The keys to the secret of the context or to the sparse secret are only valid up to
+	// the level of that secret, at which the bootstrapping uses them
+	check := func(artifact string, evk *rlwe.EvaluationKey, sIn []int64, sOut ringqp.Poly, levelQ int) {
+		if evk == nil {
+			add(artifact, 0, fmt.Errorf("missing"))
+			return
+		}
+		noise, err := checkGadget(params, evk, secretPoly(params, sIn).Q, sOut, levelQ)
+		add(artifact, noise/scale, err)
+	}
+
+	// recoverSecret returns the input secret of evk, nil if it is not a key to sOut
+	recoverSecret := func(artifact string, evk *rlwe.EvaluationKey, sOut []int64, levelQ int) []int64 {
+		if evk == nil {
+			add(artifact, 0, fmt.Errorf("missing"))
+			return nil
+		}
+		sIn, err := recoverGadgetSecret(params, evk, secretPoly(params, sOut))
+		if err != nil {
+			add(artifact, 0, err)
+			return nil
+		}
+		check(artifact, evk, sIn, secretPoly(params, sOut), levelQ)
+		return sIn
+	}
+
+	var skN2 []int64
+	if n1, n2 := ctx.params.N(), paramsN2.N(); n1 != n2 {
+		var sk []int64
+		if ctx.params.RingType() == ring.ConjugateInvariant {
+			ringQ := paramsN2.RingQ().AtLevel(0)
+			unfolded := ringQ.NewPoly()
+			ringQ.UnfoldConjugateInvariantToStandard(ctx.sk.Value.Q, unfolded)
+			sk = secretCoefficients(ringQ, unfolded)
+			if skN2 = recoverSecret("btp_cmplx_to_real.key", keys.EvkCmplxToReal, sk, ctx.params.MaxLevel()); skN2 != nil {
+				check("btp_real_to_cmplx.key", keys.EvkRealToCmplx, sk, secretPoly(params, skN2), params.MaxLevelQ())
+			}
+		} else {
+			// The secret key of the context is mapped to the bootstrapping ring with Y = X^{N2/N1}
+			sk = make([]int64, n2)
+			for i, c := range secretCoefficients(ctx.params.RingQ().AtLevel(0), ctx.sk.Value.Q) {
+				sk[i*(n2/n1)] = c
+			}
+			if skN2 = recoverSecret("btp_n2_to_n1.key", keys.EvkN2ToN1, sk, ctx.params.MaxLevel()); skN2 != nil {
+				check("btp_n1_to_n2.key", keys.EvkN1ToN2, sk, secretPoly(params, skN2), params.MaxLevelQ())
+			}
+		}
+	} else {
+		skN2 = secretCoefficients(ctx.params.RingQ().AtLevel(0), ctx.sk.Value.Q)
+	}
+	if skN2 == nil {
+		return
+	}
+
+	if ctx.btparams.EphemeralSecretWeight != 0 {
+		if skSparse := recoverSecret("btp_sparse_to_dense.key", keys.EvkSparseToDense, skN2, params.MaxLevelQ()); skSparse != nil {
+			check("btp_dense_to_sparse.key", keys.EvkDenseToSparse, skN2, secretPoly(params, skSparse), 0)
+		}
+	}
+
+	if ctx.sharedKeys {
+		return
+	}
+
+	// The relinearization key switches sk^2 to sk, a galois key with element k switches
+	// sk to pi_{k^-1}(sk)
+	ringQP := paramsN2.RingQP()
+	s := secretPoly(params, skN2)
+	if keys.MemEvaluationKeySet == nil || keys.RelinearizationKey == nil {
+		add("btp_memset.key rlk", 0, fmt.Errorf("missing"))
+	} else {
+		noise, err := checkGadget(params, &keys.RelinearizationKey.EvaluationKey, square(ringQP.RingQ, s.Q), s, params.MaxLevelQ())
+		add("btp_memset.key rlk", noise/scale, err)
+	}
+
+	var galEls []uint64
+	if keys.MemEvaluationKeySet != nil {
+		galEls = utils.GetSortedKeys(keys.GaloisKeys)
+	}
+	for _, i := range sampleIndices(len(galEls), opts.GaloisSamples) {
+		galEl := galEls[i]
+		artifact := fmt.Sprintf("btp_memset.key galois key %d", galEl)
+		index, err := ring.AutomorphismNTTIndex(ringQP.N(), ringQP.RingQ.NthRoot(), paramsN2.ModInvGaloisElement(galEl))
+		if err != nil {
+			add(artifact, 0, err)
+			continue
+		}
+		sOut := ringQP.NewPoly()
+		ringQP.AutomorphismNTTWithIndex(s, index, sOut)
+		noise, err := checkGadget(params, &keys.GaloisKeys[galEl].EvaluationKey, s.Q, sOut, params.MaxLevelQ())
+		add(artifact, noise/scale, err)
+	}
+}
+
+// checkGadget returns the largest noise coefficient of evk up to levelQ once the gadget
+// vector times sIn is removed from it, which is small if and only if evk switches sIn
+// to sOut. sIn and sOut are in the NTT and Montgomery domain at the levels of params.
+func checkGadget(params rlwe.Parameters, evk *rlwe.EvaluationKey, sIn ring.Poly, sOut ringqp.Poly, levelQ int) (noise float64, err error) {
+	if evk.LevelQ() > params.MaxLevelQ() || evk.LevelP() > params.MaxLevelP() {
+		return 0, fmt.Errorf("key levels %d, %d exceed the parameters", evk.LevelQ(), evk.LevelP())
+	}
+	ringQP := params.RingQP().AtLevel(evk.LevelQ(), evk.LevelP())
+
+	negIn := ringQP.RingQ.NewPoly()
+	ringQP.RingQ.Neg(sIn, negIn)
+	gct := evk.GadgetCiphertext.CopyNew()
+	if err = rlwe.AddPolyTimesGadgetVectorToGadgetCiphertext(negIn, []rlwe.GadgetCiphertext{*gct}, ringQP, ringQP.RingQ.NewPoly()); err != nil {
+		return 0, err
+	}
+
+	// Row i of the gadget ciphertext starts at the prime i*(levelP+1)
+	levelP := evk.LevelP()
+	ringQP = ringQP.AtLevel(utils.Min(levelQ, evk.LevelQ()), levelP)
+	e := ringQP.NewPoly()
+	for i := 0; i < len(gct.Value) && i*(levelP+1) <= ringQP.LevelQ(); i++ {
+		for j := range gct.Value[i] {
+			decryptGadgetEntry(ringQP, gct.Value[i][j], sOut, e)
+			noise = math.Max(noise, maxCentered(ringQP.RingQ, e.Q))
+			if ringQP.RingP != nil {
+				noise = math.Max(noise, maxCentered(ringQP.RingP, e.P))
+			}
+		}
+	}
+	return noise, nil
+}
+
+// recoverGadgetSecret returns the coefficients of the ternary input secret of evk,
+// from its first entry decrypted under sOut modulo the first prime, which is P*sIn
+// plus a small noise. It fails if evk is not a key to sOut.
+func recoverGadgetSecret(params rlwe.Parameters, evk *rlwe.EvaluationKey, sOut ringqp.Poly) ([]int64, error) {
+	if evk.LevelQ() > params.MaxLevelQ() || evk.LevelP() > params.MaxLevelP() {
+		return nil, fmt.Errorf("key levels %d, %d exceed the parameters", evk.LevelQ(), evk.LevelP())
+	}
+	ringQP := params.RingQP().AtLevel(0, evk.LevelP())
+	e := ringQP.NewPoly()
+	decryptGadgetEntry(ringQP, evk.Value[0][0], sOut, e)
+
+	q := ringQP.RingQ.SubRings[0].Modulus
+	p := uint64(1)
+	if ringQP.RingP != nil {
+		p = new(big.Int).Mod(ringQP.RingP.Modulus(), new(big.Int).SetUint64(q)).Uint64()
+	}
+
+	// The noise of a fresh key is a few standard deviations, far below P mod q
+	const maxNoise = 1 << 20
+	sIn := make([]int64, len(e.Q.Coeffs[0]))
+	for k, c := range e.Q.Coeffs[0] {
+		switch {
+		case centered(c, q) < maxNoise:
+			sIn[k] = 0
+		case centered(ring.CRed(c+q-p, q), q) < maxNoise:
+			sIn[k] = 1
+		case centered(ring.CRed(c+p, q), q) < maxNoise:
+			sIn[k] = -1
+		default:
+			return nil, fmt.Errorf("not a key to the bootstrapping secret")
+		}
+	}
+	return sIn, nil
+}
+
+// decryptGadgetEntry sets e to ct[0] + ct[1]*s out of the NTT and Montgomery domain.
+func decryptGadgetEntry(ringQP ringqp.Ring, ct []ringqp.Poly, s ringqp.Poly, e ringqp.Poly) {
+	ringQP.MulCoeffsMontgomery(ct[1], s, e)
+	ringQP.Add(e, ct[0], e)
+	ringQP.IMForm(e, e)
+	ringQP.INTT(e, e)
+}
+
+// secretCoefficients returns the centered coefficients of the first prime of sk,
+// which is in the NTT and Montgomery domain. They are those of the secret itself,
+// as secret keys have small coefficients.
+func secretCoefficients(ringQ *ring.Ring, sk ring.Poly) []int64 {
+	ringQ = ringQ.AtLevel(0)
+	buff := ringQ.NewPoly()
+	ringQ.IMForm(sk, buff)
+	ringQ.INTT(buff, buff)
+	q := ringQ.SubRings[0].Modulus
+	coeffs := make([]int64, ringQ.N())
+	for i, c := range buff.Coeffs[0] {
+		if coeffs[i] = int64(c); c > q>>1 {
+			coeffs[i] -= int64(q)
+		}
+	}
+	return coeffs
+}
+
+// secretPoly returns the secret of coefficients coeffs at the levels of params,
+// in the NTT and Montgomery domain.
+func secretPoly(params rlwe.Parameters, coeffs []int64) ringqp.Poly {
+	ringQP := params.RingQP()
+	s := ringQP.NewPoly()
+	set := func(r *ring.Ring, p ring.Poly) {
+		for i, sub := range r.SubRings {
+			for k, c := range coeffs {
+				if c < 0 {
+					p.Coeffs[i][k] = sub.Modulus - uint64(-c)
+				} else {
+					p.Coeffs[i][k] = uint64(c)
+				}
+			}
+		}
+	}
+	set(ringQP.RingQ, s.Q)
+	if ringQP.RingP != nil {
+		set(ringQP.RingP, s.P)
+	}
+	ringQP.NTT(s, s)
+	ringQP.MForm(s, s)
+	return s
+}
+
+// square returns s*s, in the NTT and Montgomery domain as s.
+func square(ringQ *ring.Ring, s ring.Poly) ring.Poly {
+	s2 := ringQ.NewPoly()
+	ringQ.MulCoeffsMontgomery(s, s, s2)
+	return s2
+}
+
+// maxCentered returns the largest absolute value of the coefficients of p in (-q/2, q/2].
+func maxCentered(r *ring.Ring, p ring.Poly) (max float64) {
+	for i := 0; i <= r.Level(); i++ {
+		for _, c := range p.Coeffs[i] {
+			max = math.Max(max, float64(centered(c, r.SubRings[i].Modulus)))
+		}
+	}
+	return
+}
+
+// centered returns the absolute value of c in (-q/2, q/2].
+func centered(c, q uint64) uint64 {
+	if c > q>>1 {
+		return q - c
+	}
+	return c
+}
+
+// randomValues returns n values uniformly distributed in [-1, 1].
+func randomValues(n int) []float64 {
+	values := make([]float64, n)
+	for i := range values {
+		values[i] = 2*rand.Float64() - 1
+	}
+	return values
+}
+
+func encryptValues(ecd *hefloat.Encoder, enc *rlwe.Encryptor, params hefloat.Parameters, values []float64, level int) (*rlwe.Ciphertext, error) {
+	pt := hefloat.NewPlaintext(params, level)
+	if err := ecd.Encode(values, pt); err != nil {
+		return nil, err
+	}
+	return enc.EncryptNew(pt)
+}
+
+// decryptError returns the maximum absolute difference between the decryption of ct and want.
+func decryptError(ecd *hefloat.Encoder, dec *rlwe.Decryptor, ct *rlwe.Ciphertext, want []float64) (maxErr float64, err error) {
+	have := make([]float64, len(want))
+	if err = ecd.Decode(dec.DecryptNew(ct), have); err != nil {
+		return 0, err
+	}
+	for i := range want {
+		maxErr = math.Max(maxErr, math.Abs(have[i]-want[i]))
+	}
+	return maxErr, nil
+}
+
+// sampleIndices returns samples indices evenly spread over [0, n), or all of them if samples <= 0.
+func sampleIndices(n, samples int) (indices []int) {
+	if samples <= 0 || samples > n {
+		samples = n
+	}
+	for i := 0; i < samples; i++ {
+		indices = append(indices, i*n/samples)
+	}
+	return
+}